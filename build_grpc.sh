@@ -1,6 +1,9 @@
 #!/bin/bash
 cd pkg/grpc || exit
 
-protoc --go_out=. --go_opt=paths=source_relative \
+protoc -I . -I ../../third_party/googleapis \
+       --go_out=. --go_opt=paths=source_relative \
        --go-grpc_out=. --go-grpc_opt=paths=source_relative \
+       --grpc-gateway_out=. --grpc-gateway_opt=paths=source_relative \
+       --openapiv2_out=. \
        url_shortener.proto
@@ -0,0 +1,142 @@
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"url_shortener/pkg/client"
+)
+
+const defaultConcurrency = 8
+
+// batchFlags flags of commands processing URLs in batch
+type batchFlags struct {
+	file        string
+	concurrency int
+}
+
+func addBatchFlags(cmd *cobra.Command, flags *batchFlags) {
+	cmd.Flags().StringVarP(&flags.file, "file", "f", "", "read URLs from file, one per line (`-` for stdin)")
+	cmd.Flags().IntVarP(&flags.concurrency, "concurrency", "c", defaultConcurrency, "count of concurrent calls in batch mode")
+}
+
+// processFunc processes single URL
+type processFunc func(ctx context.Context, c *client.Client, url string) result
+
+// runBatch processes URLs from arguments and file concurrently over single connection
+// and prints results, returns error with exit code of first failed URL
+func runBatch(cmd *cobra.Command, conn *connFlags, batch *batchFlags, args []string, process processFunc) error {
+	urls, err := readURLs(cmd.InOrStdin(), batch.file, args)
+	if err != nil {
+		return err
+	}
+	if len(urls) == 0 {
+		return &exitCodeError{code: exitInvalid, err: errors.New("no URLs given")}
+	}
+
+	c, release, err := conn.connect()
+	if err != nil {
+		return &exitCodeError{code: exitUnavailable, err: err}
+	}
+	defer release()
+
+	results := processAll(cmd.Context(), c, urls, batch.concurrency, process)
+
+	isBatch := batch.file != "" || len(urls) > 1
+	if err := printResults(cmd.OutOrStdout(), conn.output, results, isBatch); err != nil {
+		return fmt.Errorf("cannot print results: %w", err)
+	}
+	if conn.session != nil {
+		conn.session.record(cmd.ErrOrStderr(), results)
+	}
+
+	var firstErr error
+	failed := 0
+	for _, r := range results {
+		if r.err == nil {
+			continue
+		}
+		failed++
+		if firstErr == nil {
+			firstErr = r.err
+		}
+		if conn.output == outputText && isBatch {
+			_, _ = fmt.Fprintf(cmd.ErrOrStderr(), "%s: %v\n", r.input, r.err)
+		}
+	}
+	if firstErr == nil {
+		return nil
+	}
+	if !isBatch {
+		return firstErr
+	}
+	return &exitCodeError{code: exitCode(firstErr), err: fmt.Errorf("%d of %d URLs failed", failed, len(urls))}
+}
+
+// processAll processes URLs by concurrent workers keeping input order of results
+func processAll(ctx context.Context, c *client.Client, urls []string, concurrency int, process processFunc) []result {
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+
+	results := make([]result, len(urls))
+	indexes := make(chan int)
+
+	wg := sync.WaitGroup{}
+	for i := 0; i < concurrency && i < len(urls); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for idx := range indexes {
+				start := time.Now()
+				results[idx] = process(ctx, c, urls[idx])
+				results[idx].elapsed = time.Since(start)
+			}
+		}()
+	}
+	for i := range urls {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+
+	return results
+}
+
+// readURLs returns URLs of arguments followed by not empty lines of file
+func readURLs(stdin io.Reader, file string, args []string) ([]string, error) {
+	urls := append([]string{}, args...)
+	if file == "" {
+		return urls, nil
+	}
+
+	r := stdin
+	if file != "-" {
+		f, err := os.Open(file)
+		if err != nil {
+			return nil, &exitCodeError{code: exitInvalid, err: fmt.Errorf("cannot open URLs file: %w", err)}
+		}
+		defer func() { _ = f.Close() }()
+		r = f
+	}
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		if url := strings.TrimSpace(scanner.Text()); url != "" {
+			urls = append(urls, url)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("cannot read URLs: %w", err)
+	}
+	return urls, nil
+}
@@ -0,0 +1,331 @@
+package cmd
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"url_shortener/pkg/client"
+	"url_shortener/pkg/config"
+	"url_shortener/pkg/qr"
+
+	pb "url_shortener/pkg/grpc"
+)
+
+func TestExitCode(t *testing.T) {
+	assert.Equal(t, exitOK, exitCode(nil))
+	assert.Equal(t, exitNotFound, exitCode(&client.Error{Code: codes.NotFound}))
+	assert.Equal(t, exitInvalid, exitCode(&client.Error{Code: codes.InvalidArgument}))
+	assert.Equal(t, exitUnavailable, exitCode(&client.Error{Code: codes.Unavailable}))
+	assert.Equal(t, exitUnavailable, exitCode(&client.Error{Code: codes.DeadlineExceeded}))
+	assert.Equal(t, exitExhausted, exitCode(&client.Error{Code: codes.ResourceExhausted}))
+	inactive, err := status.New(codes.FailedPrecondition, "link expired").WithDetails(&errdetails.ErrorInfo{Reason: "LINK_INACTIVE"})
+	assert.Nil(t, err)
+	assert.Equal(t, exitInactive, exitCode(client.FromStatus(inactive)))
+	assert.Equal(t, exitError, exitCode(&client.Error{Code: codes.FailedPrecondition}))
+	assert.Equal(t, exitError, exitCode(&client.Error{Code: codes.Unknown}))
+	assert.Equal(t, exitError, exitCode(errors.New("error")))
+	assert.Equal(t, exitNotFound, exitCode(&exitCodeError{code: exitNotFound, err: errors.New("error")}))
+}
+
+func TestReadURLs(t *testing.T) {
+	urls, err := readURLs(strings.NewReader("a\n\n  b \n"), "-", []string{"c"})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"c", "a", "b"}, urls)
+
+	urls, err = readURLs(strings.NewReader("a\n"), "", []string{"c"})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"c"}, urls)
+
+	_, err = readURLs(nil, "/not/exist", nil)
+	assert.Equal(t, exitInvalid, exitCode(err))
+}
+
+func TestPrintResults(t *testing.T) {
+	results := []result{
+		{OriginalURL: "google.com", ShortURL: "3PjSsTTFog", value: "3PjSsTTFog"},
+		{OriginalURL: "", ShortURL: "", Error: "InvalidArgument: cannot short empty URL", err: errors.New("error")},
+	}
+
+	buf := &bytes.Buffer{}
+	assert.Nil(t, printResults(buf, outputText, results, true))
+	assert.Equal(t, "3PjSsTTFog\n", buf.String())
+
+	buf.Reset()
+	assert.Nil(t, printResults(buf, outputJSON, results[:1], false))
+	assert.JSONEq(t, `{"original_url":"google.com","short_url":"3PjSsTTFog"}`, buf.String())
+
+	buf.Reset()
+	assert.Nil(t, printResults(buf, outputJSON, results, true))
+	assert.JSONEq(t, `[
+		{"original_url":"google.com","short_url":"3PjSsTTFog"},
+		{"original_url":"","short_url":"","error":"InvalidArgument: cannot short empty URL"}
+	]`, buf.String())
+
+	buf.Reset()
+	assert.Nil(t, printResults(buf, outputYAML, results[:1], false))
+	assert.Equal(t, "original_url: google.com\nshort_url: 3PjSsTTFog\n", buf.String())
+
+	buf.Reset()
+	assert.Nil(t, printResults(buf, outputTable, results[:1], true))
+	assert.Equal(t, "ORIGINAL URL  SHORT URL   ERROR\ngoogle.com    3PjSsTTFog  \n", buf.String())
+
+	assert.Equal(t, exitInvalid, exitCode(checkOutput("xml")))
+	assert.Nil(t, checkOutput(outputTable))
+}
+
+func TestSplitArgs(t *testing.T) {
+	args, err := splitArgs(`  -o json  create "a b" '' c`)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"-o", "json", "create", "a b", "", "c"}, args)
+
+	args, err = splitArgs("   ")
+	assert.Nil(t, err)
+	assert.Empty(t, args)
+
+	_, err = splitArgs(`get "a`)
+	assert.NotNil(t, err)
+}
+
+func TestHasSecret(t *testing.T) {
+	assert.False(t, hasSecret([]string{"create", "google.com", "--max-clicks", "3"}))
+	assert.True(t, hasSecret([]string{"create", "google.com", "--password", "secret"}))
+	assert.True(t, hasSecret([]string{"get", "--password=secret", "3PjSsTTFog"}))
+	assert.True(t, hasSecret([]string{"--token", "secret", "list"}))
+	assert.True(t, hasSecret([]string{"config", "set", "prod", "address=sho.rt:443", "token=secret"}))
+	assert.True(t, hasSecret([]string{"--config", "client.yml", "config", "set", "prod", "token=secret"}))
+	assert.False(t, hasSecret([]string{"config", "set", "prod", "address=sho.rt:443"}))
+	assert.False(t, hasSecret([]string{"create", "token=value"}))
+}
+
+func TestSessionRecord(t *testing.T) {
+	s := &session{shortURLs: map[string]struct{}{}}
+	buf := &bytes.Buffer{}
+	s.record(buf, []result{
+		{ShortURL: "3PjSsTTFog", input: "google.com"},
+		{ShortURL: "failed", input: "failed", err: errors.New("error")},
+	})
+
+	assert.Equal(t, map[string]struct{}{"3PjSsTTFog": {}}, s.shortURLs)
+	assert.Equal(t, "# google.com: 0s\n# failed: 0s\n", buf.String())
+}
+
+func TestResolveProfile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "client.yml")
+	cfg := &config.ClientConfig{
+		CurrentProfile: "dev",
+		Profiles: map[string]config.ProfileConfig{
+			"dev":  {Address: "localhost:9876", Timeout: time.Second},
+			"prod": {Address: "urls.example.com:443", TLS: true, Token: "secret"},
+		},
+	}
+	assert.Nil(t, cfg.Save(path))
+
+	resolve := func(args ...string) (*connFlags, error) {
+		flags := &connFlags{}
+		root := newRootCmd(flags)
+		root.SetArgs(append([]string{"--config", path}, args...))
+		root.SetOut(&bytes.Buffer{})
+		// help is run as root command has no subcommand
+		err := root.Execute()
+		return flags, err
+	}
+
+	flags, err := resolve()
+	assert.Nil(t, err)
+	assert.Equal(t, "localhost:9876", flags.address)
+	assert.Equal(t, time.Second, flags.timeout)
+
+	flags, err = resolve("-p", "prod", "-a", "localhost:443")
+	assert.Nil(t, err)
+	assert.Equal(t, "localhost:443", flags.address)
+	assert.True(t, flags.tls)
+	assert.Equal(t, "secret", flags.token)
+
+	assert.Nil(t, os.Setenv("URL_SHORTENER_PROFILE", "prod"))
+	assert.Nil(t, os.Setenv("URL_SHORTENER_TOKEN", "env"))
+	defer func() {
+		_ = os.Unsetenv("URL_SHORTENER_PROFILE")
+		_ = os.Unsetenv("URL_SHORTENER_TOKEN")
+	}()
+	flags, err = resolve()
+	assert.Nil(t, err)
+	assert.Equal(t, "urls.example.com:443", flags.address)
+	assert.Equal(t, "env", flags.token)
+
+	_, err = resolve("-p", "staging")
+	assert.Equal(t, exitInvalid, exitCode(err))
+}
+
+func TestPrintQRResult(t *testing.T) {
+	res := qrResult{ShortURL: "3PjSsTTFog", URL: "https://sho.rt/3PjSsTTFog", ContentType: "image/png"}
+
+	buf := &bytes.Buffer{}
+	assert.Nil(t, printQRResult(buf, outputText, res, qr.LevelMedium))
+	assert.Contains(t, buf.String(), "█")
+
+	buf.Reset()
+	res.File = "qr.png"
+	assert.Nil(t, printQRResult(buf, outputText, res, qr.LevelMedium))
+	assert.Equal(t, "https://sho.rt/3PjSsTTFog written to qr.png\n", buf.String())
+
+	buf.Reset()
+	assert.Nil(t, printQRResult(buf, outputJSON, res, qr.LevelMedium))
+	assert.JSONEq(t, `{"short_url":"3PjSsTTFog","url":"https://sho.rt/3PjSsTTFog","content_type":"image/png","file":"qr.png"}`, buf.String())
+}
+
+func TestListRequest(t *testing.T) {
+	lf := &listFlags{order: "clicks", pageSize: 10, createdAfter: "2021-08-30T10:00:00Z", domain: "example.com"}
+	req, err := lf.request()
+	assert.Nil(t, err)
+	assert.Equal(t, pb.ListOrder_LIST_ORDER_CLICKS_DESC, req.GetOrder())
+	assert.Equal(t, time.Date(2021, 8, 30, 10, 0, 0, 0, time.UTC), req.GetCreatedAfter().AsTime())
+	assert.Nil(t, req.GetCreatedBefore())
+
+	lf.createdBefore = "2021-09-01"
+	req, err = lf.request()
+	assert.Nil(t, err)
+	assert.Equal(t, time.Date(2021, 9, 1, 0, 0, 0, 0, time.Local), req.GetCreatedBefore().AsTime().In(time.Local))
+
+	lf.createdBefore = "yesterday"
+	_, err = lf.request()
+	assert.NotNil(t, err)
+
+	lf.createdBefore, lf.order = "", "random"
+	_, err = lf.request()
+	assert.NotNil(t, err)
+}
+
+func TestPrintLinks(t *testing.T) {
+	createdAt := time.Date(2021, 8, 30, 10, 0, 0, 0, time.UTC)
+	links := []linkResult{
+		{ShortURL: "3PjSsTTFog", OriginalURL: "google.com", CreatedAt: createdAt, Clicks: 42},
+		{ShortURL: "4QkTtUUGph", OriginalURL: "evil.com", CreatedAt: createdAt, Disabled: true, DisabledReason: "phishing"},
+	}
+
+	buf := &bytes.Buffer{}
+	assert.Nil(t, printLinks(buf, outputText, links))
+	assert.Equal(t, "3PjSsTTFog google.com\n4QkTtUUGph evil.com\n", buf.String())
+
+	buf.Reset()
+	assert.Nil(t, printLinks(buf, outputJSON, links[:1]))
+	assert.JSONEq(t, `[{"short_url":"3PjSsTTFog","original_url":"google.com","created_at":"2021-08-30T10:00:00Z","clicks":42}]`, buf.String())
+
+	buf.Reset()
+	assert.Nil(t, printLinks(buf, outputJSON, nil))
+	assert.JSONEq(t, `[]`, buf.String())
+
+	buf.Reset()
+	assert.Nil(t, printLinks(buf, outputTable, links))
+	assert.Contains(t, buf.String(), "yes: phishing")
+}
+
+func TestPrintMeta(t *testing.T) {
+	res := metaResult{ShortURL: "3PjSsTTFog", Title: "Launch", Tags: []string{"promo", "q3"}}
+
+	buf := &bytes.Buffer{}
+	assert.Nil(t, printMeta(buf, outputText, res))
+	assert.Equal(t, "title: Launch\ntags: promo, q3\nnotes: \n", buf.String())
+
+	buf.Reset()
+	assert.Nil(t, printMeta(buf, outputJSON, res))
+	assert.JSONEq(t, `{"short_url":"3PjSsTTFog","title":"Launch","tags":["promo","q3"]}`, buf.String())
+
+	mf := &metadataFlags{}
+	assert.Nil(t, mf.metadata())
+	mf.tags = []string{"promo"}
+	assert.Equal(t, []string{"promo"}, mf.metadata().GetTags())
+}
+
+func TestPrintInfo(t *testing.T) {
+	createdAt := time.Date(2021, 8, 30, 10, 0, 0, 0, time.UTC)
+	res := newInfoResult(&pb.Link{
+		ShortUrl:    "3PjSsTTFog",
+		OriginalUrl: "google.com",
+		Owner:       "oncall",
+		Source:      pb.LinkSource_LINK_SOURCE_IMPORT,
+		CreatedAt:   timestamppb.New(createdAt),
+		UpdatedAt:   timestamppb.New(createdAt.Add(time.Hour)),
+		Clicks:      42,
+	})
+
+	buf := &bytes.Buffer{}
+	assert.Nil(t, printInfo(buf, outputJSON, res))
+	assert.JSONEq(t, `{"short_url":"3PjSsTTFog","original_url":"google.com","owner":"oncall","source":"import",
+		"created_at":"2021-08-30T10:00:00Z","updated_at":"2021-08-30T11:00:00Z","clicks":42}`, buf.String())
+
+	buf.Reset()
+	assert.Nil(t, printInfo(buf, outputText, res))
+	assert.Contains(t, buf.String(), "source:        import\n")
+	assert.NotContains(t, buf.String(), "disabled")
+	assert.NotContains(t, buf.String(), "clicks left")
+
+	// exhausted one-time link
+	res = newInfoResult(&pb.Link{ShortUrl: "3PjSsTTFog", MaxClicks: 1})
+	buf.Reset()
+	assert.Nil(t, printInfo(buf, outputText, res))
+	assert.Contains(t, buf.String(), "clicks left:   0 of 1\n")
+
+	// country URLs are sorted by country
+	res = newInfoResult(&pb.Link{ShortUrl: "3PjSsTTFog", CountryUrls: map[string]string{"SE": "se.example", "DE": "de.example"}})
+	buf.Reset()
+	assert.Nil(t, printInfo(buf, outputText, res))
+	assert.Contains(t, buf.String(), "country DE:    de.example\ncountry SE:    se.example\n")
+
+	res = newInfoResult(&pb.Link{ShortUrl: "3PjSsTTFog", Variants: []*pb.Variant{{DestinationUrl: "a.example", Weight: 70, Clicks: 7}}})
+	buf.Reset()
+	assert.Nil(t, printInfo(buf, outputText, res))
+	assert.Contains(t, buf.String(), "variant 1:     70=a.example (7 clicks)\n")
+}
+
+func TestParseVariant(t *testing.T) {
+	variant, err := parseVariant("30=https://example.com/b?x=1")
+	assert.Nil(t, err)
+	assert.Equal(t, int32(30), variant.GetWeight())
+	assert.Equal(t, "https://example.com/b?x=1", variant.GetDestinationUrl())
+
+	for _, flag := range []string{"https://example.com/b", "half=https://example.com/b"} {
+		_, err := parseVariant(flag)
+		assert.NotNil(t, err, flag)
+	}
+}
+
+func TestWindowFlags(t *testing.T) {
+	wf := &windowFlags{notAfter: "2021-09-01T10:00:00Z", fallback: "https://example.com/ended"}
+	req := &pb.CreateRequest{}
+	assert.Nil(t, wf.apply(req))
+	assert.Nil(t, req.GetNotBefore())
+	assert.Equal(t, time.Date(2021, 9, 1, 10, 0, 0, 0, time.UTC), req.GetNotAfter().AsTime())
+	assert.Equal(t, "https://example.com/ended", req.GetFallbackUrl())
+
+	wf.notBefore = "tomorrow"
+	assert.NotNil(t, wf.apply(req))
+}
+
+func TestParseRule(t *testing.T) {
+	rule, err := parseRule("device=ios;lang=de;time=22:00-06:00;query=ref=qr;url=https://example.com/a;b")
+	assert.Nil(t, err)
+	assert.Equal(t, pb.DeviceClass_DEVICE_CLASS_IOS, rule.GetDevice())
+	assert.Equal(t, "de", rule.GetLanguage())
+	assert.Equal(t, "22:00", rule.GetTimeStart())
+	assert.Equal(t, "06:00", rule.GetTimeEnd())
+	assert.Equal(t, "ref", rule.GetQueryParam())
+	assert.Equal(t, "qr", rule.GetQueryValue())
+	assert.Equal(t, "https://example.com/a;b", rule.GetDestinationUrl())
+	assert.Equal(t, "device=ios;lang=de;time=22:00-06:00;query=ref=qr;url=https://example.com/a;b", formatRule(rule))
+
+	for _, flag := range []string{"device=ios", "device=tv;url=https://example.com", "time=9;url=https://example.com", "os=ios;url=https://example.com"} {
+		_, err := parseRule(flag)
+		assert.NotNil(t, err, flag)
+	}
+}
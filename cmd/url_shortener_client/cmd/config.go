@@ -0,0 +1,186 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+
+	"url_shortener/pkg/config"
+)
+
+const maskedSecret = "********"
+
+func newConfigCmd(flags *connFlags) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "config",
+		Short: "View and edit client config profiles",
+		// config commands don't connect, so profile isn't resolved
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			return nil
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return cmd.Help()
+		},
+	}
+
+	cmd.AddCommand(newConfigPathCmd(flags))
+	cmd.AddCommand(newConfigViewCmd(flags))
+	cmd.AddCommand(newConfigProfilesCmd(flags))
+	cmd.AddCommand(newConfigSetCmd(flags))
+	cmd.AddCommand(newConfigUseCmd(flags))
+	cmd.AddCommand(newConfigDeleteCmd(flags))
+
+	return cmd
+}
+
+func newConfigPathCmd(flags *connFlags) *cobra.Command {
+	return &cobra.Command{
+		Use:   "path",
+		Short: "Print client config file path",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			path, err := flags.configFilePath()
+			if err != nil {
+				return err
+			}
+			_, err = fmt.Fprintln(cmd.OutOrStdout(), path)
+			return err
+		},
+	}
+}
+
+func newConfigViewCmd(flags *connFlags) *cobra.Command {
+	showSecrets := false
+
+	cmd := &cobra.Command{
+		Use:   "view",
+		Short: "Print client config, tokens are masked",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, _, err := flags.loadConfig()
+			if err != nil {
+				return err
+			}
+			if !showSecrets {
+				for name, p := range cfg.Profiles {
+					if p.Token != "" {
+						p.Token = maskedSecret
+						cfg.Profiles[name] = p
+					}
+				}
+			}
+
+			enc := yaml.NewEncoder(cmd.OutOrStdout())
+			defer func() { _ = enc.Close() }()
+			return enc.Encode(cfg)
+		},
+	}
+	cmd.Flags().BoolVar(&showSecrets, "show-secrets", false, "print tokens as is")
+
+	return cmd
+}
+
+func newConfigProfilesCmd(flags *connFlags) *cobra.Command {
+	return &cobra.Command{
+		Use:   "profiles",
+		Short: "List profiles, current profile is marked by `*`",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, _, err := flags.loadConfig()
+			if err != nil {
+				return err
+			}
+			for _, name := range cfg.ProfileNames() {
+				mark := " "
+				if name == cfg.CurrentProfile {
+					mark = "*"
+				}
+				if _, err := fmt.Fprintf(cmd.OutOrStdout(), "%s %s\n", mark, name); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	}
+}
+
+func newConfigSetCmd(flags *connFlags) *cobra.Command {
+	return &cobra.Command{
+		Use:   "set profile key=value...",
+		Short: "Create or update profile settings: address, timeout, tls, ca_file, server_name, token",
+		Args:  cobra.MinimumNArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return editConfig(flags, func(cfg *config.ClientConfig) error {
+				p := cfg.Profiles[args[0]]
+				for _, setting := range args[1:] {
+					kv := strings.SplitN(setting, "=", 2)
+					if len(kv) != 2 {
+						return fmt.Errorf("setting `%s` isn't in key=value format", setting)
+					}
+					if err := p.Set(kv[0], kv[1]); err != nil {
+						return err
+					}
+				}
+				if cfg.Profiles == nil {
+					cfg.Profiles = map[string]config.ProfileConfig{}
+				}
+				cfg.Profiles[args[0]] = p
+				return nil
+			})
+		},
+	}
+}
+
+func newConfigUseCmd(flags *connFlags) *cobra.Command {
+	return &cobra.Command{
+		Use:   "use profile",
+		Short: "Set current profile",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return editConfig(flags, func(cfg *config.ClientConfig) error {
+				if _, err := cfg.Profile(args[0]); err != nil {
+					return err
+				}
+				cfg.CurrentProfile = args[0]
+				return nil
+			})
+		},
+	}
+}
+
+func newConfigDeleteCmd(flags *connFlags) *cobra.Command {
+	return &cobra.Command{
+		Use:   "delete profile",
+		Short: "Delete profile",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return editConfig(flags, func(cfg *config.ClientConfig) error {
+				if _, err := cfg.Profile(args[0]); err != nil {
+					return err
+				}
+				delete(cfg.Profiles, args[0])
+				if cfg.CurrentProfile == args[0] {
+					cfg.CurrentProfile = ""
+				}
+				return nil
+			})
+		},
+	}
+}
+
+// editConfig loads client config, edits it by fn and saves it
+func editConfig(flags *connFlags, fn func(cfg *config.ClientConfig) error) error {
+	cfg, path, err := flags.loadConfig()
+	if err != nil {
+		return err
+	}
+	if err := fn(cfg); err != nil {
+		return &exitCodeError{code: exitInvalid, err: err}
+	}
+	if err := cfg.Save(path); err != nil {
+		return fmt.Errorf("cannot save client config: %w", err)
+	}
+	return nil
+}
@@ -2,48 +2,132 @@ package cmd
 
 import (
 	"context"
-	"fmt"
-	"log"
-	"time"
 
 	"github.com/spf13/cobra"
+	"google.golang.org/protobuf/proto"
 
-	"google.golang.org/grpc"
+	"url_shortener/pkg/client"
 
 	pb "url_shortener/pkg/grpc"
 )
 
-func newCreateCmd(address string) *cobra.Command {
-
-	return &cobra.Command{
-		Use:                "create originalURL",
-		Short:              "Create short URL from given original URL",
-		Args:               cobra.ExactArgs(1),
-		FParseErrWhitelist: cobra.FParseErrWhitelist{UnknownFlags: true},
-		Run: func(cmd *cobra.Command, args []string) {
-			originalURL := args[0]
-
-			conn, err := grpc.Dial(
-				address,
-				grpc.WithInsecure(),
-				grpc.WithBlock(),
-				grpc.FailOnNonTempDialError(true),
-			)
-			if err != nil {
-				log.Fatalf("cannot connect to `%s`: %v", address, err)
-			}
-			defer func() { _ = conn.Close() }()
+// windowFlags activation window flags
+type windowFlags struct {
+	notBefore string
+	notAfter  string
+	fallback  string
+}
+
+// apply sets activation window of flags to request
+func (wf *windowFlags) apply(req *pb.CreateRequest) error {
+	var err error
+	if req.NotBefore, err = parseTime(wf.notBefore); err != nil {
+		return err
+	}
+	if req.NotAfter, err = parseTime(wf.notAfter); err != nil {
+		return err
+	}
+	req.FallbackUrl = wf.fallback
+	return nil
+}
+
+// metadataFlags link metadata flags
+type metadataFlags struct {
+	title string
+	notes string
+	tags  []string
+}
 
-			ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
-			defer cancel()
+func newCreateCmd(flags *connFlags) *cobra.Command {
+	batch := &batchFlags{}
+	mf := &metadataFlags{}
+	var interstitial bool
+	var password string
+	var maxClicks int64
+	wf := &windowFlags{}
+	var rules []string
+	var countryURLs map[string]string
+	var variants []string
 
-			client := pb.NewURLShortenerClient(conn)
-			resp, err := client.Create(ctx, &pb.CreateRequest{OriginalUrl: originalURL})
-			if err != nil {
-				log.Fatalf("cannot create short URL: %v", err)
+	cmd := &cobra.Command{
+		Use:   "create [originalURL...]",
+		Short: "Create short URLs from given original URLs",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			// links of file are imported
+			source := pb.LinkSource_LINK_SOURCE_CLI
+			if batch.file != "" {
+				source = pb.LinkSource_LINK_SOURCE_IMPORT
+			}
+			req := &pb.CreateRequest{
+				Interstitial: interstitial,
+				Metadata:     mf.metadata(),
+				Source:       source,
+				Password:     password,
+				MaxClicks:    maxClicks,
+			}
+			if err := wf.apply(req); err != nil {
+				return &exitCodeError{code: exitInvalid, err: err}
 			}
-			fmt.Println(resp.GetShortUrl())
+			for _, flag := range rules {
+				rule, err := parseRule(flag)
+				if err != nil {
+					return &exitCodeError{code: exitInvalid, err: err}
+				}
+				req.Rules = append(req.Rules, rule)
+			}
+			req.CountryUrls = countryURLs
+			for _, flag := range variants {
+				variant, err := parseVariant(flag)
+				if err != nil {
+					return &exitCodeError{code: exitInvalid, err: err}
+				}
+				req.Variants = append(req.Variants, variant)
+			}
+			return runBatch(cmd, flags, batch, args, create(req))
 		},
 	}
+	addBatchFlags(cmd, batch)
+	addMetadataFlags(cmd, mf)
+	cmd.Flags().BoolVar(&interstitial, "interstitial", false, "show confirmation page before redirect of new links")
+	cmd.Flags().StringVar(&password, "password", "", "password required to resolve new links")
+	cmd.Flags().Int64Var(&maxClicks, "max-clicks", 0, "resolutions count after which new links stop working, 1 for one-time links")
+	cmd.Flags().StringVar(&wf.notBefore, "not-before", "", "activation time of new links (RFC 3339 or YYYY-MM-DD)")
+	cmd.Flags().StringVar(&wf.notAfter, "not-after", "", "expiration time of new links (RFC 3339 or YYYY-MM-DD)")
+	cmd.Flags().StringVar(&wf.fallback, "fallback", "", "destination of new links outside of activation window")
+	cmd.Flags().StringArrayVar(&rules, "rule", nil,
+		"conditional destination of new links as key=value pairs of device, lang, time, query and url separated by ; and repeated in match order")
+	cmd.Flags().StringToStringVar(&countryURLs, "country-url", nil,
+		"destination of new links for clients of country as CC=URL, repeated or comma separated")
+	cmd.Flags().StringArrayVar(&variants, "variant", nil,
+		"weighted A/B split destination of new links as WEIGHT=URL, repeated for every variant")
+
+	return cmd
+}
+
+func addMetadataFlags(cmd *cobra.Command, mf *metadataFlags) {
+	cmd.Flags().StringVar(&mf.title, "title", "", "link title")
+	cmd.Flags().StringVar(&mf.notes, "notes", "", "link notes")
+	cmd.Flags().StringSliceVar(&mf.tags, "tag", nil, "link tag, repeated or comma separated")
+}
+
+// metadata returns metadata of flags, nil if no flag is set
+func (mf *metadataFlags) metadata() *pb.Metadata {
+	if mf.title == "" && mf.notes == "" && len(mf.tags) == 0 {
+		return nil
+	}
+	return &pb.Metadata{Title: mf.title, Notes: mf.notes, Tags: mf.tags}
+}
 
+// create returns processFunc creating links with options of given request
+func create(options *pb.CreateRequest) processFunc {
+	return func(ctx context.Context, c *client.Client, originalURL string) result {
+		req := proto.Clone(options).(*pb.CreateRequest)
+		req.OriginalUrl = originalURL
+		shortURL, err := c.CreateLink(ctx, req)
+		r := result{OriginalURL: originalURL, ShortURL: shortURL, input: originalURL, value: shortURL, err: err}
+		if err != nil {
+			r.Error = err.Error()
+		}
+		return r
+	}
 }
@@ -0,0 +1,55 @@
+package cmd
+
+import (
+	"errors"
+
+	"url_shortener/pkg/client"
+)
+
+// process exit codes
+const (
+	exitOK          = 0
+	exitError       = 1 // server or unexpected error
+	exitInvalid     = 2 // invalid input URL, flags or arguments
+	exitNotFound    = 3 // short URL isn't found
+	exitUnavailable = 4 // server is unreachable or unavailable
+	exitExhausted   = 5 // link click limit is reached
+	exitInactive    = 6 // link isn't active yet or expired
+)
+
+// exitCodeError error with explicit process exit code
+type exitCodeError struct {
+	code int
+	err  error
+}
+
+func (e *exitCodeError) Error() string {
+	return e.err.Error()
+}
+
+func (e *exitCodeError) Unwrap() error {
+	return e.err
+}
+
+// exitCode returns process exit code of error
+func exitCode(err error) int {
+	var codeErr *exitCodeError
+	switch {
+	case err == nil:
+		return exitOK
+	case errors.As(err, &codeErr):
+		return codeErr.code
+	case errors.Is(err, client.ErrNotFound):
+		return exitNotFound
+	case errors.Is(err, client.ErrInvalidArgument):
+		return exitInvalid
+	case errors.Is(err, client.ErrUnavailable), errors.Is(err, client.ErrTimeout):
+		return exitUnavailable
+	case errors.Is(err, client.ErrExhausted):
+		return exitExhausted
+	case errors.Is(err, client.ErrInactive):
+		return exitInactive
+	default:
+		return exitError
+	}
+}
@@ -2,48 +2,43 @@ package cmd
 
 import (
 	"context"
-	"fmt"
-	"log"
-	"time"
 
 	"github.com/spf13/cobra"
 
-	"google.golang.org/grpc"
-
-	pb "url_shortener/pkg/grpc"
+	"url_shortener/pkg/client"
 )
 
-func newGetCmd(address string) *cobra.Command {
-
-	return &cobra.Command{
-		Use:                "get shortURL",
-		Short:              "Get original URL from given short URL",
-		Args:               cobra.ExactArgs(1),
-		FParseErrWhitelist: cobra.FParseErrWhitelist{UnknownFlags: true},
-		Run: func(cmd *cobra.Command, args []string) {
-			shortURL := args[0]
-
-			conn, err := grpc.Dial(
-				address,
-				grpc.WithInsecure(),
-				grpc.WithBlock(),
-				grpc.FailOnNonTempDialError(true),
-			)
-			if err != nil {
-				log.Fatalf("cannot connect to `%s`: %v", address, err)
-			}
-			defer func() { _ = conn.Close() }()
-
-			ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
-			defer cancel()
+func newGetCmd(flags *connFlags) *cobra.Command {
+	batch := &batchFlags{}
+	var password string
 
-			client := pb.NewURLShortenerClient(conn)
-			resp, err := client.Get(ctx, &pb.GetRequest{ShortUrl: shortURL})
-			if err != nil {
-				log.Fatalf("cannot get original URL: %v", err)
-			}
-			fmt.Println(resp.GetOriginalUrl())
+	cmd := &cobra.Command{
+		Use:   "get [shortURL...]",
+		Short: "Get original URLs from given short URLs",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runBatch(cmd, flags, batch, args, get(password))
 		},
 	}
+	addBatchFlags(cmd, batch)
+	cmd.Flags().StringVar(&password, "password", "", "password of protected links")
 
+	return cmd
+}
+
+// get returns processFunc getting original URLs, links are requested with password if set
+func get(password string) processFunc {
+	return func(ctx context.Context, c *client.Client, shortURL string) result {
+		var originalURL string
+		var err error
+		if password != "" {
+			originalURL, err = c.GetProtected(ctx, shortURL, password)
+		} else {
+			originalURL, err = c.Get(ctx, shortURL)
+		}
+		r := result{OriginalURL: originalURL, ShortURL: shortURL, input: shortURL, value: originalURL, err: err}
+		if err != nil {
+			r.Error = err.Error()
+		}
+		return r
+	}
 }
@@ -0,0 +1,201 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+
+	pb "url_shortener/pkg/grpc"
+)
+
+// linkSourceNames names of link sources
+var linkSourceNames = map[pb.LinkSource]string{
+	pb.LinkSource_LINK_SOURCE_API:    "api",
+	pb.LinkSource_LINK_SOURCE_CLI:    "cli",
+	pb.LinkSource_LINK_SOURCE_IMPORT: "import",
+}
+
+// infoResult full link record, clicks left and activation window times are nil if not set,
+// rules are in rule flag format, country URLs are by country codes,
+// variants are in variant flag format followed by their clicks
+type infoResult struct {
+	ShortURL       string            `json:"short_url" yaml:"short_url"`
+	OriginalURL    string            `json:"original_url" yaml:"original_url"`
+	Owner          string            `json:"owner,omitempty" yaml:"owner,omitempty"`
+	Source         string            `json:"source,omitempty" yaml:"source,omitempty"`
+	Title          string            `json:"title,omitempty" yaml:"title,omitempty"`
+	Notes          string            `json:"notes,omitempty" yaml:"notes,omitempty"`
+	Tags           []string          `json:"tags,omitempty" yaml:"tags,omitempty"`
+	CreatedAt      time.Time         `json:"created_at" yaml:"created_at"`
+	UpdatedAt      time.Time         `json:"updated_at" yaml:"updated_at"`
+	Clicks         int64             `json:"clicks" yaml:"clicks"`
+	MaxClicks      int64             `json:"max_clicks,omitempty" yaml:"max_clicks,omitempty"`
+	ClicksLeft     *int64            `json:"clicks_left,omitempty" yaml:"clicks_left,omitempty"`
+	NotBefore      *time.Time        `json:"not_before,omitempty" yaml:"not_before,omitempty"`
+	NotAfter       *time.Time        `json:"not_after,omitempty" yaml:"not_after,omitempty"`
+	FallbackURL    string            `json:"fallback_url,omitempty" yaml:"fallback_url,omitempty"`
+	Inactive       bool              `json:"inactive,omitempty" yaml:"inactive,omitempty"`
+	Rules          []string          `json:"rules,omitempty" yaml:"rules,omitempty"`
+	CountryURLs    map[string]string `json:"country_urls,omitempty" yaml:"country_urls,omitempty"`
+	Variants       []string          `json:"variants,omitempty" yaml:"variants,omitempty"`
+	Interstitial   bool              `json:"interstitial,omitempty" yaml:"interstitial,omitempty"`
+	Protected      bool              `json:"password_protected,omitempty" yaml:"password_protected,omitempty"`
+	Disabled       bool              `json:"disabled,omitempty" yaml:"disabled,omitempty"`
+	DisabledReason string            `json:"disabled_reason,omitempty" yaml:"disabled_reason,omitempty"`
+}
+
+func newInfoCmd(flags *connFlags) *cobra.Command {
+	return &cobra.Command{
+		Use:   "info shortURL",
+		Short: "Show full link record: owner, source, metadata, timestamps and clicks",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			c, release, err := flags.connect()
+			if err != nil {
+				return &exitCodeError{code: exitUnavailable, err: err}
+			}
+			defer release()
+
+			link, err := c.Info(cmd.Context(), args[0])
+			if err != nil {
+				return err
+			}
+			return printInfo(cmd.OutOrStdout(), flags.output, newInfoResult(link))
+		},
+	}
+}
+
+func newInfoResult(link *pb.Link) infoResult {
+	r := infoResult{
+		ShortURL:       link.GetShortUrl(),
+		OriginalURL:    link.GetOriginalUrl(),
+		Owner:          link.GetOwner(),
+		Source:         linkSourceNames[link.GetSource()],
+		Title:          link.GetMetadata().GetTitle(),
+		Notes:          link.GetMetadata().GetNotes(),
+		Tags:           link.GetMetadata().GetTags(),
+		Clicks:         link.GetClicks(),
+		MaxClicks:      link.GetMaxClicks(),
+		FallbackURL:    link.GetFallbackUrl(),
+		Inactive:       link.GetInactive(),
+		Interstitial:   link.GetInterstitial(),
+		Protected:      link.GetPasswordProtected(),
+		Disabled:       link.GetDisabled(),
+		DisabledReason: link.GetDisabledReason(),
+	}
+	if link.GetCreatedAt() != nil {
+		r.CreatedAt = link.GetCreatedAt().AsTime()
+	}
+	if link.GetUpdatedAt() != nil {
+		r.UpdatedAt = link.GetUpdatedAt().AsTime()
+	}
+	if link.GetNotBefore() != nil {
+		notBefore := link.GetNotBefore().AsTime()
+		r.NotBefore = &notBefore
+	}
+	if link.GetNotAfter() != nil {
+		notAfter := link.GetNotAfter().AsTime()
+		r.NotAfter = &notAfter
+	}
+	if link.GetMaxClicks() != 0 {
+		left := link.GetClicksLeft()
+		r.ClicksLeft = &left
+	}
+	for _, rule := range link.GetRules() {
+		r.Rules = append(r.Rules, formatRule(rule))
+	}
+	r.CountryURLs = link.GetCountryUrls()
+	for _, variant := range link.GetVariants() {
+		r.Variants = append(r.Variants, formatVariant(variant))
+	}
+	return r
+}
+
+// printInfo prints link record in given format, text format prints field per line
+func printInfo(w io.Writer, format string, res infoResult) error {
+	switch format {
+	case outputJSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(res)
+	case outputYAML:
+		enc := yaml.NewEncoder(w)
+		defer func() { _ = enc.Close() }()
+		return enc.Encode(res)
+	default:
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fields := [][2]string{
+			{"short url", res.ShortURL},
+			{"original url", res.OriginalURL},
+			{"owner", res.Owner},
+			{"source", res.Source},
+			{"title", res.Title},
+			{"notes", res.Notes},
+			{"tags", strings.Join(res.Tags, ", ")},
+			{"created", formatTime(res.CreatedAt)},
+			{"updated", formatTime(res.UpdatedAt)},
+			{"clicks", fmt.Sprint(res.Clicks)},
+		}
+		if res.ClicksLeft != nil {
+			fields = append(fields, [2]string{"clicks left", fmt.Sprintf("%d of %d", *res.ClicksLeft, res.MaxClicks)})
+		}
+		if res.NotBefore != nil || res.NotAfter != nil {
+			active := "yes"
+			if res.Inactive {
+				active = "no"
+			}
+			fields = append(fields,
+				[2]string{"not before", formatTimePtr(res.NotBefore)},
+				[2]string{"not after", formatTimePtr(res.NotAfter)},
+				[2]string{"fallback url", res.FallbackURL},
+				[2]string{"active", active})
+		}
+		for i, rule := range res.Rules {
+			fields = append(fields, [2]string{fmt.Sprintf("rule %d", i+1), rule})
+		}
+		countries := make([]string, 0, len(res.CountryURLs))
+		for country := range res.CountryURLs {
+			countries = append(countries, country)
+		}
+		sort.Strings(countries)
+		for _, country := range countries {
+			fields = append(fields, [2]string{"country " + country, res.CountryURLs[country]})
+		}
+		for i, variant := range res.Variants {
+			fields = append(fields, [2]string{fmt.Sprintf("variant %d", i+1), variant})
+		}
+		if res.Protected {
+			fields = append(fields, [2]string{"password", "required"})
+		}
+		if res.Disabled {
+			fields = append(fields, [2]string{"disabled", res.DisabledReason})
+		}
+		for _, f := range fields {
+			_, _ = fmt.Fprintf(tw, "%s:\t%s\n", f[0], f[1])
+		}
+		return tw.Flush()
+	}
+}
+
+// formatTime formats time in local time zone, zero time is empty
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Local().Format(time.RFC3339)
+}
+
+// formatTimePtr formats time like formatTime, nil is empty
+func formatTimePtr(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return formatTime(*t)
+}
@@ -0,0 +1,201 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"gopkg.in/yaml.v3"
+
+	pb "url_shortener/pkg/grpc"
+)
+
+var listOrders = map[string]pb.ListOrder{
+	"created-desc": pb.ListOrder_LIST_ORDER_CREATED_DESC,
+	"created-asc":  pb.ListOrder_LIST_ORDER_CREATED_ASC,
+	"clicks":       pb.ListOrder_LIST_ORDER_CLICKS_DESC,
+	"short-url":    pb.ListOrder_LIST_ORDER_SHORT_URL,
+}
+
+// listFlags flags of list command
+type listFlags struct {
+	owner         string
+	domain        string
+	tag           string
+	createdAfter  string
+	createdBefore string
+	order         string
+	pageSize      int
+	limit         int
+}
+
+// linkResult listed link
+type linkResult struct {
+	ShortURL       string    `json:"short_url" yaml:"short_url"`
+	OriginalURL    string    `json:"original_url" yaml:"original_url"`
+	Owner          string    `json:"owner,omitempty" yaml:"owner,omitempty"`
+	Title          string    `json:"title,omitempty" yaml:"title,omitempty"`
+	Tags           []string  `json:"tags,omitempty" yaml:"tags,omitempty"`
+	CreatedAt      time.Time `json:"created_at" yaml:"created_at"`
+	Clicks         int64     `json:"clicks" yaml:"clicks"`
+	Interstitial   bool      `json:"interstitial,omitempty" yaml:"interstitial,omitempty"`
+	Disabled       bool      `json:"disabled,omitempty" yaml:"disabled,omitempty"`
+	DisabledReason string    `json:"disabled_reason,omitempty" yaml:"disabled_reason,omitempty"`
+}
+
+func newListCmd(flags *connFlags) *cobra.Command {
+	lf := &listFlags{}
+
+	cmd := &cobra.Command{
+		Use:   "list",
+		Short: "List links matching filters, pages are requested until limit",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runList(cmd, flags, lf)
+		},
+	}
+	cmd.Flags().StringVar(&lf.owner, "owner", "", "links created by identity")
+	cmd.Flags().StringVar(&lf.domain, "domain", "", "links to domain and its subdomains")
+	cmd.Flags().StringVar(&lf.tag, "tag", "", "links with tag")
+	cmd.Flags().StringVar(&lf.createdAfter, "created-after", "", "links created after time (RFC 3339 or YYYY-MM-DD)")
+	cmd.Flags().StringVar(&lf.createdBefore, "created-before", "", "links created before time (RFC 3339 or YYYY-MM-DD)")
+	cmd.Flags().StringVar(&lf.order, "order", "created-desc", "order: created-desc, created-asc, clicks or short-url")
+	cmd.Flags().IntVar(&lf.pageSize, "page-size", 50, "links per request")
+	cmd.Flags().IntVar(&lf.limit, "limit", 0, "max links to list, all if 0")
+
+	return cmd
+}
+
+func runList(cmd *cobra.Command, flags *connFlags, lf *listFlags) error {
+	req, err := lf.request()
+	if err != nil {
+		return &exitCodeError{code: exitInvalid, err: err}
+	}
+
+	c, release, err := flags.connect()
+	if err != nil {
+		return &exitCodeError{code: exitUnavailable, err: err}
+	}
+	defer release()
+
+	var links []linkResult
+	for {
+		if lf.limit > 0 && lf.limit-len(links) < int(req.PageSize) {
+			req.PageSize = int32(lf.limit - len(links))
+		}
+		resp, err := c.List(cmd.Context(), req)
+		if err != nil {
+			return err
+		}
+		for _, link := range resp.GetLinks() {
+			links = append(links, newLinkResult(link))
+		}
+
+		if resp.GetNextPageToken() == "" || lf.limit > 0 && len(links) >= lf.limit {
+			break
+		}
+		req.PageToken = resp.GetNextPageToken()
+	}
+
+	return printLinks(cmd.OutOrStdout(), flags.output, links)
+}
+
+// request converts flags to first page request
+func (lf *listFlags) request() (*pb.ListLinksRequest, error) {
+	if lf.pageSize <= 0 {
+		return nil, fmt.Errorf("page size must be positive")
+	}
+	order, ok := listOrders[lf.order]
+	if !ok {
+		return nil, fmt.Errorf("unknown order `%s`", lf.order)
+	}
+	req := &pb.ListLinksRequest{
+		PageSize: int32(lf.pageSize),
+		Owner:    lf.owner,
+		Domain:   lf.domain,
+		Tag:      lf.tag,
+		Order:    order,
+	}
+
+	var err error
+	if req.CreatedAfter, err = parseTime(lf.createdAfter); err != nil {
+		return nil, err
+	}
+	if req.CreatedBefore, err = parseTime(lf.createdBefore); err != nil {
+		return nil, err
+	}
+	return req, nil
+}
+
+// parseTime parses RFC 3339 time or date in local time zone, empty string is nil
+func parseTime(s string) (*timestamppb.Timestamp, error) {
+	if s == "" {
+		return nil, nil
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		if t, err = time.ParseInLocation("2006-01-02", s, time.Local); err != nil {
+			return nil, fmt.Errorf("invalid time `%s`, expected RFC 3339 or YYYY-MM-DD", s)
+		}
+	}
+	return timestamppb.New(t), nil
+}
+
+func newLinkResult(link *pb.Link) linkResult {
+	r := linkResult{
+		ShortURL:       link.GetShortUrl(),
+		OriginalURL:    link.GetOriginalUrl(),
+		Owner:          link.GetOwner(),
+		Title:          link.GetMetadata().GetTitle(),
+		Tags:           link.GetMetadata().GetTags(),
+		Clicks:         link.GetClicks(),
+		Interstitial:   link.GetInterstitial(),
+		Disabled:       link.GetDisabled(),
+		DisabledReason: link.GetDisabledReason(),
+	}
+	if link.GetCreatedAt() != nil {
+		r.CreatedAt = link.GetCreatedAt().AsTime()
+	}
+	return r
+}
+
+// printLinks prints links in given format, text format prints short and original URL per line
+func printLinks(w io.Writer, format string, links []linkResult) error {
+	switch format {
+	case outputJSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		if links == nil {
+			links = []linkResult{}
+		}
+		return enc.Encode(links)
+	case outputYAML:
+		enc := yaml.NewEncoder(w)
+		defer func() { _ = enc.Close() }()
+		return enc.Encode(links)
+	case outputTable:
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		_, _ = fmt.Fprintln(tw, "SHORT URL\tORIGINAL URL\tTITLE\tTAGS\tOWNER\tCREATED\tCLICKS\tDISABLED")
+		for _, l := range links {
+			disabled := ""
+			if l.Disabled {
+				disabled = "yes: " + l.DisabledReason
+			}
+			_, _ = fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%d\t%s\n", l.ShortURL, l.OriginalURL, l.Title, strings.Join(l.Tags, ","),
+				l.Owner, l.CreatedAt.Local().Format(time.RFC3339), l.Clicks, disabled)
+		}
+		return tw.Flush()
+	default:
+		for _, l := range links {
+			if _, err := fmt.Fprintf(w, "%s %s\n", l.ShortURL, l.OriginalURL); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
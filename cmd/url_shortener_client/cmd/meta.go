@@ -0,0 +1,104 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
+	"gopkg.in/yaml.v3"
+
+	pb "url_shortener/pkg/grpc"
+)
+
+// metadata fields by flag names
+var metadataFlagFields = map[string]string{
+	"title": "title",
+	"notes": "notes",
+	"tag":   "tags",
+}
+
+// metaResult link metadata
+type metaResult struct {
+	ShortURL string   `json:"short_url" yaml:"short_url"`
+	Title    string   `json:"title,omitempty" yaml:"title,omitempty"`
+	Notes    string   `json:"notes,omitempty" yaml:"notes,omitempty"`
+	Tags     []string `json:"tags,omitempty" yaml:"tags,omitempty"`
+}
+
+func newMetaCmd(flags *connFlags) *cobra.Command {
+	mf := &metadataFlags{}
+
+	cmd := &cobra.Command{
+		Use:   "meta shortURL",
+		Short: "Show link title, notes and tags or update given ones (`--tag ''` clears tags)",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runMeta(cmd, flags, mf, args[0])
+		},
+	}
+	addMetadataFlags(cmd, mf)
+
+	return cmd
+}
+
+func runMeta(cmd *cobra.Command, flags *connFlags, mf *metadataFlags, shortURL string) error {
+	c, release, err := flags.connect()
+	if err != nil {
+		return &exitCodeError{code: exitUnavailable, err: err}
+	}
+	defer release()
+
+	// only changed fields are updated
+	mask := &fieldmaskpb.FieldMask{}
+	for flag, field := range metadataFlagFields {
+		if cmd.Flags().Changed(flag) {
+			mask.Paths = append(mask.Paths, field)
+		}
+	}
+
+	var m *pb.Metadata
+	if len(mask.GetPaths()) == 0 {
+		link, err := c.Info(cmd.Context(), shortURL)
+		if err != nil {
+			return err
+		}
+		m = link.GetMetadata()
+	} else {
+		m, err = c.UpdateMetadata(cmd.Context(), &pb.UpdateMetadataRequest{
+			ShortUrl:   shortURL,
+			Metadata:   &pb.Metadata{Title: mf.title, Notes: mf.notes, Tags: mf.tags},
+			UpdateMask: mask,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	res := metaResult{ShortURL: shortURL, Title: m.GetTitle(), Notes: m.GetNotes(), Tags: m.GetTags()}
+	return printMeta(cmd.OutOrStdout(), flags.output, res)
+}
+
+func printMeta(w io.Writer, format string, res metaResult) error {
+	switch format {
+	case outputJSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(res)
+	case outputYAML:
+		enc := yaml.NewEncoder(w)
+		defer func() { _ = enc.Close() }()
+		return enc.Encode(res)
+	case outputTable:
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		_, _ = fmt.Fprintln(tw, "SHORT URL\tTITLE\tTAGS\tNOTES")
+		_, _ = fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", res.ShortURL, res.Title, strings.Join(res.Tags, ","), res.Notes)
+		return tw.Flush()
+	default:
+		_, err := fmt.Fprintf(w, "title: %s\ntags: %s\nnotes: %s\n", res.Title, strings.Join(res.Tags, ", "), res.Notes)
+		return err
+	}
+}
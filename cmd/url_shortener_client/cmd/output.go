@@ -0,0 +1,80 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// output formats
+const (
+	outputText  = "text"
+	outputJSON  = "json"
+	outputYAML  = "yaml"
+	outputTable = "table"
+)
+
+// result of single URL processing
+type result struct {
+	OriginalURL string `json:"original_url" yaml:"original_url"`
+	ShortURL    string `json:"short_url" yaml:"short_url"`
+	Error       string `json:"error,omitempty" yaml:"error,omitempty"`
+
+	// processed URL and value printed in text format
+	input   string
+	value   string
+	err     error
+	elapsed time.Duration
+}
+
+func checkOutput(format string) error {
+	switch format {
+	case outputText, outputJSON, outputYAML, outputTable:
+		return nil
+	}
+	return &exitCodeError{
+		code: exitInvalid,
+		err:  fmt.Errorf("unknown output format `%s`, expected text, json, yaml or table", format),
+	}
+}
+
+// printResults prints results in given format, single result isn't wrapped into list.
+// Text format prints values of succeeded results only, errors are reported by caller
+func printResults(w io.Writer, format string, results []result, batch bool) error {
+	switch format {
+	case outputJSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		if batch {
+			return enc.Encode(results)
+		}
+		return enc.Encode(results[0])
+	case outputYAML:
+		enc := yaml.NewEncoder(w)
+		defer func() { _ = enc.Close() }()
+		if batch {
+			return enc.Encode(results)
+		}
+		return enc.Encode(results[0])
+	case outputTable:
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		_, _ = fmt.Fprintln(tw, "ORIGINAL URL\tSHORT URL\tERROR")
+		for _, r := range results {
+			_, _ = fmt.Fprintf(tw, "%s\t%s\t%s\n", r.OriginalURL, r.ShortURL, r.Error)
+		}
+		return tw.Flush()
+	default:
+		for _, r := range results {
+			if r.err == nil {
+				if _, err := fmt.Fprintln(w, r.value); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+}
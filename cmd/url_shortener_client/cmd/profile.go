@@ -0,0 +1,99 @@
+package cmd
+
+import (
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"url_shortener/pkg/config"
+)
+
+// environment variables of client config path and profile selection
+const (
+	envConfig  = "URL_SHORTENER_CONFIG"
+	envProfile = "URL_SHORTENER_PROFILE"
+)
+
+// profileEnv environment variables overriding profile settings by setting key
+var profileEnv = map[string]string{
+	"address":     "URL_SHORTENER_ADDRESS",
+	"timeout":     "URL_SHORTENER_TIMEOUT",
+	"tls":         "URL_SHORTENER_TLS",
+	"ca_file":     "URL_SHORTENER_CA_FILE",
+	"server_name": "URL_SHORTENER_SERVER_NAME",
+	"token":       "URL_SHORTENER_TOKEN",
+}
+
+// configFilePath returns client config path from flag, environment or default one
+func (f *connFlags) configFilePath() (string, error) {
+	if f.configPath != "" {
+		return f.configPath, nil
+	}
+	if path := os.Getenv(envConfig); path != "" {
+		return path, nil
+	}
+	return config.ClientConfigPath()
+}
+
+// loadConfig loads client config
+func (f *connFlags) loadConfig() (*config.ClientConfig, string, error) {
+	path, err := f.configFilePath()
+	if err != nil {
+		return nil, "", err
+	}
+	cfg, err := config.LoadClient(path)
+	if err != nil {
+		return nil, "", &exitCodeError{code: exitInvalid, err: err}
+	}
+	return cfg, path, nil
+}
+
+// resolve sets connection settings not set by flags from environment
+// and then from selected profile
+func (f *connFlags) resolve(cmd *cobra.Command) error {
+	cfg, _, err := f.loadConfig()
+	if err != nil {
+		return err
+	}
+
+	name := f.profile
+	if name == "" {
+		name = os.Getenv(envProfile)
+	}
+	p, err := cfg.Profile(name)
+	if err != nil {
+		return &exitCodeError{code: exitInvalid, err: err}
+	}
+
+	for key, env := range profileEnv {
+		if value, ok := os.LookupEnv(env); ok {
+			if err := p.Set(key, value); err != nil {
+				return &exitCodeError{code: exitInvalid, err: err}
+			}
+		}
+	}
+
+	changed := func(name string) bool {
+		flag := cmd.Flag(name)
+		return flag != nil && flag.Changed
+	}
+	if !changed("address") && p.Address != "" {
+		f.address = p.Address
+	}
+	if !changed("timeout") && p.Timeout != 0 {
+		f.timeout = p.Timeout
+	}
+	if !changed("tls") && p.TLS {
+		f.tls = p.TLS
+	}
+	if !changed("ca-file") && p.CAFile != "" {
+		f.caFile = p.CAFile
+	}
+	if !changed("server-name") && p.ServerName != "" {
+		f.serverName = p.ServerName
+	}
+	if !changed("token") && p.Token != "" {
+		f.token = p.Token
+	}
+	return nil
+}
@@ -0,0 +1,140 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+
+	"url_shortener/pkg/qr"
+
+	pb "url_shortener/pkg/grpc"
+)
+
+var qrLevels = map[string]pb.QRLevel{
+	"low":     pb.QRLevel_QR_LEVEL_LOW,
+	"medium":  pb.QRLevel_QR_LEVEL_MEDIUM,
+	"high":    pb.QRLevel_QR_LEVEL_HIGH,
+	"highest": pb.QRLevel_QR_LEVEL_HIGHEST,
+}
+
+// terminal rendering levels of QR code levels
+var qrTerminalLevels = map[string]qr.Level{
+	"low":     qr.LevelLow,
+	"medium":  qr.LevelMedium,
+	"high":    qr.LevelHigh,
+	"highest": qr.LevelHighest,
+}
+
+// qrFlags flags of qr command
+type qrFlags struct {
+	file   string
+	format string
+	size   int
+	level  string
+}
+
+// qrResult rendered QR code description
+type qrResult struct {
+	ShortURL    string `json:"short_url" yaml:"short_url"`
+	URL         string `json:"url" yaml:"url"`
+	ContentType string `json:"content_type" yaml:"content_type"`
+	File        string `json:"file,omitempty" yaml:"file,omitempty"`
+}
+
+func newQRCmd(flags *connFlags) *cobra.Command {
+	qf := &qrFlags{}
+
+	cmd := &cobra.Command{
+		Use:   "qr shortURL",
+		Short: "Render QR code of short URL in terminal or write it to image file",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runQR(cmd, flags, qf, args[0])
+		},
+	}
+	cmd.Flags().StringVarP(&qf.file, "file", "f", "", "write image to file instead of terminal")
+	cmd.Flags().StringVar(&qf.format, "format", "", "image format: png or svg (default by file extension, png otherwise)")
+	cmd.Flags().IntVar(&qf.size, "size", qr.DefaultSize, "image width and height in pixels")
+	cmd.Flags().StringVar(&qf.level, "level", "medium", "error correction level: low, medium, high or highest")
+
+	return cmd
+}
+
+func runQR(cmd *cobra.Command, flags *connFlags, qf *qrFlags, shortURL string) error {
+	req := &pb.GetQRCodeRequest{ShortUrl: shortURL, Size: int32(qf.size)}
+
+	level, ok := qrLevels[qf.level]
+	if !ok {
+		return &exitCodeError{code: exitInvalid, err: fmt.Errorf("unknown level `%s`", qf.level)}
+	}
+	req.Level = level
+
+	format := qf.format
+	if format == "" && strings.EqualFold(filepath.Ext(qf.file), ".svg") {
+		format = "svg"
+	}
+	switch format {
+	case "", "png":
+		req.Format = pb.QRFormat_QR_FORMAT_PNG
+	case "svg":
+		req.Format = pb.QRFormat_QR_FORMAT_SVG
+	default:
+		return &exitCodeError{code: exitInvalid, err: fmt.Errorf("unknown format `%s`", format)}
+	}
+
+	c, release, err := flags.connect()
+	if err != nil {
+		return &exitCodeError{code: exitUnavailable, err: err}
+	}
+	defer release()
+
+	resp, err := c.QRCode(cmd.Context(), req)
+	if err != nil {
+		return err
+	}
+
+	res := qrResult{ShortURL: shortURL, URL: resp.GetUrl(), ContentType: resp.GetContentType(), File: qf.file}
+	if qf.file != "" {
+		if err := os.WriteFile(qf.file, resp.GetImage(), 0644); err != nil {
+			return fmt.Errorf("cannot write QR code: %w", err)
+		}
+	}
+	return printQRResult(cmd.OutOrStdout(), flags.output, res, qrTerminalLevels[qf.level])
+}
+
+// printQRResult prints QR code description, text format renders QR code if it isn't written to file
+func printQRResult(w io.Writer, format string, res qrResult, level qr.Level) error {
+	switch format {
+	case outputJSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(res)
+	case outputYAML:
+		enc := yaml.NewEncoder(w)
+		defer func() { _ = enc.Close() }()
+		return enc.Encode(res)
+	case outputTable:
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		_, _ = fmt.Fprintln(tw, "SHORT URL\tURL\tCONTENT TYPE\tFILE")
+		_, _ = fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", res.ShortURL, res.URL, res.ContentType, res.File)
+		return tw.Flush()
+	default:
+		if res.File != "" {
+			_, err := fmt.Fprintf(w, "%s written to %s\n", res.URL, res.File)
+			return err
+		}
+		s, err := qr.Terminal(res.URL, level)
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprint(w, s)
+		return err
+	}
+}
@@ -1,24 +1,125 @@
 package cmd
 
 import (
+	"context"
+	"fmt"
+	"time"
+
 	"github.com/spf13/cobra"
-	"os"
+
+	"url_shortener/pkg/client"
 )
 
-func NewCLI(address string) *cobra.Command {
+// connFlags server connection flags shared by all commands
+type connFlags struct {
+	address string
+	timeout time.Duration
+	token   string
+	tls     bool
+	caFile  string
+	output  string
+
+	serverName string
+	profile    string
+	configPath string
+
+	// shell session sharing connection between commands, nil outside of shell
+	session *session
+}
+
+func NewCLI() *cobra.Command {
+	return newRootCmd(&connFlags{})
+}
 
+// newRootCmd creates command tree parsing flags into given flags
+func newRootCmd(flags *connFlags) *cobra.Command {
 	root := &cobra.Command{
-		Use:                "url_shortener",
-		Short:              "URL Shortener",
-		FParseErrWhitelist: cobra.FParseErrWhitelist{UnknownFlags: true},
-		Run: func(cmd *cobra.Command, args []string) {
-			_ = cmd.Help()
-			os.Exit(0)
+		Use:   "url_shortener",
+		Short: "URL Shortener",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return cmd.Help()
+		},
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			if err := checkOutput(flags.output); err != nil {
+				return err
+			}
+			// shell commands share already resolved connection
+			if flags.session != nil {
+				return nil
+			}
+			return flags.resolve(cmd)
 		},
+		// errors are printed by Execute with exit code
+		SilenceErrors: true,
+		SilenceUsage:  true,
 	}
+	root.SetFlagErrorFunc(func(cmd *cobra.Command, err error) error {
+		return &exitCodeError{code: exitInvalid, err: err}
+	})
+
+	root.PersistentFlags().StringVarP(&flags.address, "address", "a", "localhost:9876", "server address")
+	root.PersistentFlags().DurationVarP(&flags.timeout, "timeout", "t", client.DefaultTimeout, "call timeout")
+	root.PersistentFlags().StringVar(&flags.token, "token", "", "authorization token")
+	root.PersistentFlags().BoolVar(&flags.tls, "tls", false, "use TLS")
+	root.PersistentFlags().StringVar(&flags.caFile, "ca-file", "", "PEM file with trusted CA certificates for TLS")
+	root.PersistentFlags().StringVar(&flags.serverName, "server-name", "", "TLS server name, host of address if not set")
+	root.PersistentFlags().StringVarP(&flags.profile, "profile", "p", "", "client config profile, current profile if not set")
+	root.PersistentFlags().StringVar(&flags.configPath, "config", "", "client config file (default $XDG_CONFIG_HOME/url_shortener/client.yml)")
+	root.PersistentFlags().StringVarP(&flags.output, "output", "o", outputText, "output format: text, json, yaml or table")
 
-	root.AddCommand(newCreateCmd(address))
-	root.AddCommand(newGetCmd(address))
+	root.AddCommand(newCreateCmd(flags))
+	root.AddCommand(newGetCmd(flags))
+	root.AddCommand(newQRCmd(flags))
+	root.AddCommand(newListCmd(flags))
+	root.AddCommand(newMetaCmd(flags))
+	root.AddCommand(newInfoCmd(flags))
+	root.AddCommand(newConfigCmd(flags))
+	if flags.session == nil {
+		root.AddCommand(newShellCmd(flags))
+	}
 
 	return root
 }
+
+// Execute runs CLI and returns process exit code
+func Execute() int {
+	root := NewCLI()
+	if err := root.Execute(); err != nil {
+		_, _ = fmt.Fprintf(root.ErrOrStderr(), "error: %v\n", err)
+		return exitCode(err)
+	}
+	return exitOK
+}
+
+// connect connects to server by connection flags, returns shell session client if any
+// and release function closing connection of not shared client
+func (f *connFlags) connect() (*client.Client, func(), error) {
+	if f.session != nil {
+		return f.session.client, func() {}, nil
+	}
+	c, err := f.dial()
+	if err != nil {
+		return nil, nil, err
+	}
+	return c, func() { _ = c.Close() }, nil
+}
+
+// dial connects to server by connection flags
+func (f *connFlags) dial() (*client.Client, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), f.timeout)
+	defer cancel()
+
+	opts := []client.Option{client.WithTimeout(f.timeout), client.WithBlock()}
+	if f.token != "" {
+		opts = append(opts, client.WithToken(f.token))
+	}
+	if f.tls || f.caFile != "" || f.serverName != "" {
+		tlsConfig, err := client.LoadTLSConfig(f.caFile, f.serverName)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, client.WithTLS(tlsConfig))
+	}
+
+	return client.New(ctx, f.address, opts...)
+}
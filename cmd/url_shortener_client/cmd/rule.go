@@ -0,0 +1,92 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	pb "url_shortener/pkg/grpc"
+)
+
+// deviceNames device classes by names of rule flag
+var deviceNames = map[string]pb.DeviceClass{
+	"ios":     pb.DeviceClass_DEVICE_CLASS_IOS,
+	"android": pb.DeviceClass_DEVICE_CLASS_ANDROID,
+	"mobile":  pb.DeviceClass_DEVICE_CLASS_MOBILE,
+	"desktop": pb.DeviceClass_DEVICE_CLASS_DESKTOP,
+	"bot":     pb.DeviceClass_DEVICE_CLASS_BOT,
+}
+
+// parseRule parses rule flag `device=ios;lang=de;time=22:00-06:00;query=ref=promo;url=https://...`,
+// url key is the last one and takes the rest of flag, so destination may contain `;`
+func parseRule(flag string) (*pb.Rule, error) {
+	rule := &pb.Rule{}
+	rest := flag
+	for rest != "" {
+		var part string
+		if strings.HasPrefix(rest, "url=") {
+			part, rest = rest, ""
+		} else if i := strings.Index(rest, ";"); i >= 0 {
+			part, rest = rest[:i], rest[i+1:]
+		} else {
+			part, rest = rest, ""
+		}
+
+		key, value := part, ""
+		if i := strings.Index(part, "="); i >= 0 {
+			key, value = part[:i], part[i+1:]
+		}
+		switch key {
+		case "device":
+			device, ok := deviceNames[value]
+			if !ok {
+				return nil, fmt.Errorf("rule `%s`: unknown device `%s`, expected ios, android, mobile, desktop or bot", flag, value)
+			}
+			rule.Device = device
+		case "lang":
+			rule.Language = value
+		case "time":
+			i := strings.Index(value, "-")
+			if i < 0 {
+				return nil, fmt.Errorf("rule `%s`: time range isn't HH:MM-HH:MM", flag)
+			}
+			rule.TimeStart, rule.TimeEnd = value[:i], value[i+1:]
+		case "query":
+			rule.QueryParam, rule.QueryValue = value, ""
+			if i := strings.Index(value, "="); i >= 0 {
+				rule.QueryParam, rule.QueryValue = value[:i], value[i+1:]
+			}
+		case "url":
+			rule.DestinationUrl = value
+		default:
+			return nil, fmt.Errorf("rule `%s`: unknown key `%s`, expected device, lang, time, query or url", flag, key)
+		}
+	}
+	if rule.GetDestinationUrl() == "" {
+		return nil, fmt.Errorf("rule `%s`: no url", flag)
+	}
+	return rule, nil
+}
+
+// formatRule formats rule as rule flag
+func formatRule(rule *pb.Rule) string {
+	var parts []string
+	for name, device := range deviceNames {
+		if device == rule.GetDevice() {
+			parts = append(parts, "device="+name)
+		}
+	}
+	if rule.GetLanguage() != "" {
+		parts = append(parts, "lang="+rule.GetLanguage())
+	}
+	if rule.GetTimeStart() != "" {
+		parts = append(parts, "time="+rule.GetTimeStart()+"-"+rule.GetTimeEnd())
+	}
+	if rule.GetQueryParam() != "" {
+		query := rule.GetQueryParam()
+		if rule.GetQueryValue() != "" {
+			query += "=" + rule.GetQueryValue()
+		}
+		parts = append(parts, "query="+query)
+	}
+	return strings.Join(append(parts, "url="+rule.GetDestinationUrl()), ";")
+}
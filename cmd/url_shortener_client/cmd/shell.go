@@ -0,0 +1,228 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/chzyer/readline"
+	"github.com/spf13/cobra"
+
+	"url_shortener/pkg/client"
+)
+
+const shellPrompt = "url_shortener> "
+
+var (
+	// secretFlags flags whose values aren't written to shell history
+	secretFlags = []string{"--password", "--token"}
+	// secretSettings profile settings of `config set` whose values aren't written to shell history
+	secretSettings = []string{"token"}
+)
+
+// session shell session: shared connection and short URLs seen during session
+type session struct {
+	client *client.Client
+
+	mu        sync.Mutex
+	shortURLs map[string]struct{}
+}
+
+func newShellCmd(flags *connFlags) *cobra.Command {
+	return &cobra.Command{
+		Use:   "shell",
+		Short: "Run interactive shell keeping single connection",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			c, err := flags.dial()
+			if err != nil {
+				return &exitCodeError{code: exitUnavailable, err: err}
+			}
+			defer func() { _ = c.Close() }()
+
+			s := &session{client: c, shortURLs: map[string]struct{}{}}
+			return s.run(flags, cmd.InOrStdin(), cmd.OutOrStdout(), cmd.ErrOrStderr())
+		},
+	}
+}
+
+// run reads and executes commands until EOF or exit command
+func (s *session) run(flags *connFlags, stdin io.Reader, stdout, stderr io.Writer) error {
+	rl, err := readline.NewEx(&readline.Config{
+		Prompt:          shellPrompt,
+		HistoryFile:     historyFile(),
+		AutoComplete:    s.completer(),
+		InterruptPrompt: "^C",
+		EOFPrompt:       "exit",
+		Stdin:           io.NopCloser(stdin),
+		Stdout:          stdout,
+		Stderr:          stderr,
+		// lines are saved after check for secrets
+		DisableAutoSaveHistory: true,
+	})
+	if err != nil {
+		return fmt.Errorf("cannot start shell: %w", err)
+	}
+	defer func() { _ = rl.Close() }()
+
+	for {
+		line, err := rl.Readline()
+		if errors.Is(err, readline.ErrInterrupt) {
+			continue
+		}
+		if err != nil {
+			// io.EOF
+			return nil
+		}
+
+		args, err := splitArgs(line)
+		if err != nil {
+			_, _ = fmt.Fprintf(stderr, "error: %v\n", err)
+			continue
+		}
+		if len(args) == 0 {
+			continue
+		}
+		if !hasSecret(args) {
+			_ = rl.SaveHistory(line)
+		}
+		if args[0] == "exit" || args[0] == "quit" {
+			return nil
+		}
+
+		// every line is parsed by new command tree with flags of shell command as defaults
+		lineFlags := *flags
+		lineFlags.session = s
+
+		root := newRootCmd(&lineFlags)
+		root.CompletionOptions.DisableDefaultCmd = true
+		root.SetArgs(args)
+		root.SetIn(stdin)
+		root.SetOut(stdout)
+		root.SetErr(stderr)
+		if err := root.Execute(); err != nil {
+			_, _ = fmt.Fprintf(stderr, "error: %v\n", err)
+		}
+	}
+}
+
+// record remembers short URLs of succeeded results and prints timing of calls
+func (s *session) record(w io.Writer, results []result) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, r := range results {
+		if r.err == nil && r.ShortURL != "" {
+			s.shortURLs[r.ShortURL] = struct{}{}
+		}
+		_, _ = fmt.Fprintf(w, "# %s: %v\n", r.input, r.elapsed)
+	}
+}
+
+// completer completes commands and short URLs returned during session
+func (s *session) completer() readline.AutoCompleter {
+	shortURLs := readline.PcItemDynamic(func(string) []string {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		urls := make([]string, 0, len(s.shortURLs))
+		for url := range s.shortURLs {
+			urls = append(urls, url)
+		}
+		sort.Strings(urls)
+		return urls
+	})
+
+	return readline.NewPrefixCompleter(
+		readline.PcItem("create"),
+		readline.PcItem("get", shortURLs),
+		readline.PcItem("qr", shortURLs),
+		readline.PcItem("list"),
+		readline.PcItem("meta", shortURLs),
+		readline.PcItem("info", shortURLs),
+		readline.PcItem("help", readline.PcItem("create"), readline.PcItem("get"), readline.PcItem("qr"),
+			readline.PcItem("list"), readline.PcItem("meta"), readline.PcItem("info")),
+		readline.PcItem("exit"),
+		readline.PcItem("quit"),
+	)
+}
+
+// splitArgs splits line into arguments by spaces, single or double quotes group arguments
+func splitArgs(line string) ([]string, error) {
+	var args []string
+	var arg strings.Builder
+	var quote rune
+	inArg := false
+
+	for _, r := range line {
+		switch {
+		case quote != 0 && r == quote:
+			quote = 0
+		case quote != 0:
+			arg.WriteRune(r)
+		case r == '"' || r == '\'':
+			quote, inArg = r, true
+		case r == ' ' || r == '\t':
+			if inArg {
+				args = append(args, arg.String())
+				arg.Reset()
+				inArg = false
+			}
+		default:
+			arg.WriteRune(r)
+			inArg = true
+		}
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("unclosed quote %c", quote)
+	}
+	if inArg {
+		args = append(args, arg.String())
+	}
+	return args, nil
+}
+
+// hasSecret checks arguments have flag of secretFlags or `config set` has setting of
+// secretSettings, such lines aren't saved to history
+func hasSecret(args []string) bool {
+	configSet := false
+	for i, arg := range args {
+		for _, flag := range secretFlags {
+			if arg == flag || strings.HasPrefix(arg, flag+"=") {
+				return true
+			}
+		}
+		if arg == "set" && i > 0 && args[i-1] == "config" {
+			configSet = true
+			continue
+		}
+		if !configSet {
+			continue
+		}
+		for _, setting := range secretSettings {
+			if strings.HasPrefix(arg, setting+"=") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// historyFile returns shell history file path in user cache directory,
+// empty path disables history file
+func historyFile() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+	dir = filepath.Join(dir, "url_shortener")
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "shell_history")
+}
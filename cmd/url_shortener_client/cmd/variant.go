@@ -0,0 +1,27 @@
+package cmd
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	pb "url_shortener/pkg/grpc"
+)
+
+// parseVariant parses variant flag `70=https://...`, destination may contain `=`
+func parseVariant(flag string) (*pb.Variant, error) {
+	i := strings.Index(flag, "=")
+	if i < 0 {
+		return nil, fmt.Errorf("variant `%s` isn't WEIGHT=URL", flag)
+	}
+	weight, err := strconv.ParseInt(flag[:i], 10, 32)
+	if err != nil {
+		return nil, fmt.Errorf("variant `%s`: invalid weight: %w", flag, err)
+	}
+	return &pb.Variant{Weight: int32(weight), DestinationUrl: flag[i+1:]}, nil
+}
+
+// formatVariant formats variant as variant flag followed by its clicks
+func formatVariant(variant *pb.Variant) string {
+	return fmt.Sprintf("%d=%s (%d clicks)", variant.GetWeight(), variant.GetDestinationUrl(), variant.GetClicks())
+}
@@ -1,5 +1,31 @@
 CREATE TABLE url_db
 (
-    original_url text        NOT NULL UNIQUE PRIMARY KEY,
-    short_url    varchar(10) NOT NULL UNIQUE
+    original_url    text        NOT NULL UNIQUE PRIMARY KEY,
+    short_url       varchar(10) NOT NULL UNIQUE,
+    interstitial    boolean     NOT NULL DEFAULT false,
+    owner           text        NOT NULL DEFAULT '',
+    original_host   text        NOT NULL DEFAULT '',
+    metadata        jsonb       NOT NULL DEFAULT '{}',
+    source          text        NOT NULL DEFAULT '',
+    created_at      timestamptz NOT NULL DEFAULT now(),
+    updated_at      timestamptz NOT NULL DEFAULT now(),
+    clicks          bigint      NOT NULL DEFAULT 0,
+    disabled        boolean     NOT NULL DEFAULT false,
+    disabled_reason text        NOT NULL DEFAULT '',
+    password_hash   text        NOT NULL DEFAULT '',
+    max_clicks      bigint      NOT NULL DEFAULT 0,
+    clicks_left     bigint      NOT NULL DEFAULT 0,
+    not_before      timestamptz,
+    not_after       timestamptz,
+    fallback_url    text        NOT NULL DEFAULT '',
+    rules           jsonb       NOT NULL DEFAULT '[]',
+    country_urls    jsonb       NOT NULL DEFAULT '{}',
+    variants        jsonb       NOT NULL DEFAULT '[]'
 );
+
+-- links listing filters and orders
+CREATE INDEX url_db_created_at_idx ON url_db (created_at, short_url);
+CREATE INDEX url_db_clicks_idx ON url_db (clicks, short_url);
+CREATE INDEX url_db_owner_idx ON url_db (owner, created_at);
+CREATE INDEX url_db_original_host_idx ON url_db (reverse(original_host) text_pattern_ops);
+CREATE INDEX url_db_tags_idx ON url_db USING gin ((metadata -> 'tags'));
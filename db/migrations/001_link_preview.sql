@@ -0,0 +1,5 @@
+-- link preview and interstitial page, existing links get migration time as creation time
+ALTER TABLE url_db
+    ADD COLUMN IF NOT EXISTS interstitial boolean     NOT NULL DEFAULT false,
+    ADD COLUMN IF NOT EXISTS created_at   timestamptz NOT NULL DEFAULT now(),
+    ADD COLUMN IF NOT EXISTS clicks       bigint      NOT NULL DEFAULT 0;
@@ -0,0 +1,4 @@
+-- links disabled by destination policy
+ALTER TABLE url_db
+    ADD COLUMN IF NOT EXISTS disabled        boolean NOT NULL DEFAULT false,
+    ADD COLUMN IF NOT EXISTS disabled_reason text    NOT NULL DEFAULT '';
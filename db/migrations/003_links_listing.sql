@@ -0,0 +1,16 @@
+-- links listing: owner, destination host and metadata tags filters
+ALTER TABLE url_db
+    ADD COLUMN IF NOT EXISTS owner         text  NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS original_host text  NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS metadata      jsonb NOT NULL DEFAULT '{}';
+
+-- host of existing links, new links get host normalized by server
+UPDATE url_db
+SET original_host = coalesce(lower(substring(original_url from '^(?:[a-zA-Z][a-zA-Z0-9+.-]*://)?([^/:?#]+)')), '')
+WHERE original_host = '';
+
+CREATE INDEX IF NOT EXISTS url_db_created_at_idx ON url_db (created_at, short_url);
+CREATE INDEX IF NOT EXISTS url_db_clicks_idx ON url_db (clicks, short_url);
+CREATE INDEX IF NOT EXISTS url_db_owner_idx ON url_db (owner, created_at);
+CREATE INDEX IF NOT EXISTS url_db_original_host_idx ON url_db (reverse(original_host) text_pattern_ops);
+CREATE INDEX IF NOT EXISTS url_db_tags_idx ON url_db USING gin ((metadata -> 'tags'));
@@ -0,0 +1,8 @@
+-- link info: creation source and time of last change
+ALTER TABLE url_db
+    ADD COLUMN IF NOT EXISTS source     text        NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS updated_at timestamptz NOT NULL DEFAULT now();
+
+-- existing links weren't changed since creation
+UPDATE url_db
+SET updated_at = created_at;
@@ -0,0 +1,3 @@
+-- password protected links
+ALTER TABLE url_db
+    ADD COLUMN IF NOT EXISTS password_hash text NOT NULL DEFAULT '';
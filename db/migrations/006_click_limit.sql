@@ -0,0 +1,4 @@
+-- click limited links
+ALTER TABLE url_db
+    ADD COLUMN IF NOT EXISTS max_clicks  bigint NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS clicks_left bigint NOT NULL DEFAULT 0;
@@ -0,0 +1,5 @@
+-- scheduled activation windows
+ALTER TABLE url_db
+    ADD COLUMN IF NOT EXISTS not_before   timestamptz,
+    ADD COLUMN IF NOT EXISTS not_after    timestamptz,
+    ADD COLUMN IF NOT EXISTS fallback_url text NOT NULL DEFAULT '';
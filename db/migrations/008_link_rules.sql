@@ -0,0 +1,3 @@
+-- conditional redirect rules
+ALTER TABLE url_db
+    ADD COLUMN IF NOT EXISTS rules jsonb NOT NULL DEFAULT '[]';
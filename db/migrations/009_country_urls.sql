@@ -0,0 +1,3 @@
+-- geo targeted destinations
+ALTER TABLE url_db
+    ADD COLUMN IF NOT EXISTS country_urls jsonb NOT NULL DEFAULT '{}';
@@ -0,0 +1,3 @@
+-- weighted A/B split destinations with their clicks
+ALTER TABLE url_db
+    ADD COLUMN IF NOT EXISTS variants jsonb NOT NULL DEFAULT '[]';
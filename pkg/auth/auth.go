@@ -0,0 +1,164 @@
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"url_shortener/pkg/config"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Identity authenticated caller
+type Identity struct {
+	Name  string
+	Admin bool
+}
+
+type identityKey struct{}
+
+// FromContext returns identity of authenticated caller
+func FromContext(ctx context.Context) (Identity, bool) {
+	identity, ok := ctx.Value(identityKey{}).(Identity)
+	return identity, ok
+}
+
+// NewContext returns context with caller identity
+func NewContext(ctx context.Context, identity Identity) context.Context {
+	return context.WithValue(ctx, identityKey{}, identity)
+}
+
+// Authenticator authenticates gRPC calls by static bearer tokens from `authorization` metadata
+type Authenticator struct {
+	enabled  bool
+	required bool
+
+	// sha256(token) -> identity
+	tokens map[[sha256.Size]byte]Identity
+	// full method name prefixes available to admins only
+	adminOnly []string
+}
+
+func New(cfg config.AuthConfig) *Authenticator {
+	a := &Authenticator{
+		enabled:  cfg.Enabled,
+		required: cfg.Required,
+		tokens:   map[[sha256.Size]byte]Identity{},
+	}
+	for _, t := range cfg.Tokens {
+		a.tokens[sha256.Sum256([]byte(t.Token))] = Identity{Name: t.Name, Admin: t.Admin}
+	}
+	return a
+}
+
+// Enabled returns true if calls are authenticated
+func (a *Authenticator) Enabled() bool {
+	return a.enabled
+}
+
+// RequireAdmin restricts methods with given full method name prefix
+// (e.g. `/grpc.reflection.v1alpha.ServerReflection/`) to admins
+func (a *Authenticator) RequireAdmin(prefix string) {
+	a.adminOnly = append(a.adminOnly, prefix)
+}
+
+func (a *Authenticator) UnaryInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		ctx, err := a.authenticate(ctx, info.FullMethod)
+		if err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+func (a *Authenticator) StreamInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, err := a.authenticate(ss.Context(), info.FullMethod)
+		if err != nil {
+			return err
+		}
+		return handler(srv, &identityStream{ServerStream: ss, ctx: ctx})
+	}
+}
+
+// authenticate checks call token and returns context with caller identity
+func (a *Authenticator) authenticate(ctx context.Context, method string) (context.Context, error) {
+	if !a.enabled {
+		return ctx, nil
+	}
+
+	token, ok := bearerToken(ctx)
+	if !ok {
+		if a.required || a.isAdminOnly(method) {
+			return nil, status.Error(codes.Unauthenticated, "authorization token is required")
+		}
+		return ctx, nil
+	}
+
+	identity, ok := a.Authenticate(token)
+	if !ok {
+		log.Debugf("auth: invalid token for method=%s", method)
+		return nil, status.Error(codes.Unauthenticated, "invalid authorization token")
+	}
+	if !identity.Admin && a.isAdminOnly(method) {
+		log.Debugf("auth: %s isn't admin for method=%s", identity.Name, method)
+		return nil, status.Error(codes.PermissionDenied, "method is available to admins only")
+	}
+
+	return NewContext(ctx, identity), nil
+}
+
+// Authenticate returns identity of token
+func (a *Authenticator) Authenticate(token string) (Identity, bool) {
+	identity, ok := a.tokens[sha256.Sum256([]byte(token))]
+	return identity, ok
+}
+
+func (a *Authenticator) isAdminOnly(method string) bool {
+	for _, prefix := range a.adminOnly {
+		if strings.HasPrefix(method, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// bearerToken returns token from `authorization: Bearer <token>` metadata
+func bearerToken(ctx context.Context) (string, bool) {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return "", false
+	}
+	for _, v := range md.Get("authorization") {
+		if token, ok := ParseBearer(v); ok {
+			return token, true
+		}
+	}
+	return "", false
+}
+
+// ParseBearer returns token from `Bearer <token>` authorization value
+func ParseBearer(authorization string) (string, bool) {
+	const prefix = "bearer "
+	if len(authorization) <= len(prefix) || !strings.EqualFold(authorization[:len(prefix)], prefix) {
+		return "", false
+	}
+	return authorization[len(prefix):], true
+}
+
+// identityStream server stream with authenticated context
+type identityStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *identityStream) Context() context.Context {
+	return s.ctx
+}
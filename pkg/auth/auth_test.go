@@ -0,0 +1,102 @@
+package auth
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"url_shortener/pkg/config"
+)
+
+const adminMethod = "/grpc.reflection.v1alpha.ServerReflection/ServerReflectionInfo"
+
+func newAuthenticator(required bool) *Authenticator {
+	a := New(config.AuthConfig{
+		Enabled:  true,
+		Required: required,
+		Tokens: []config.TokenConfig{
+			{Name: "user", Token: "user-token"},
+			{Name: "admin", Token: "admin-token", Admin: true},
+		},
+	})
+	a.RequireAdmin("/grpc.reflection.v1alpha.ServerReflection/")
+	return a
+}
+
+// call calls unary interceptor with token and returns caller identity seen by handler
+func call(a *Authenticator, method, token string) (Identity, error) {
+	ctx := context.Background()
+	if token != "" {
+		ctx = metadata.NewIncomingContext(ctx, metadata.Pairs("authorization", "Bearer "+token))
+	}
+
+	var identity Identity
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		identity, _ = FromContext(ctx)
+		return nil, nil
+	}
+	_, err := a.UnaryInterceptor()(ctx, nil, &grpc.UnaryServerInfo{FullMethod: method}, handler)
+	return identity, err
+}
+
+func TestAuthenticator_Disabled(t *testing.T) {
+	a := New(config.AuthConfig{})
+
+	_, err := call(a, adminMethod, "")
+	assert.Nil(t, err)
+}
+
+func TestAuthenticator_Anonymous(t *testing.T) {
+	identity, err := call(newAuthenticator(false), "/grpc.URLShortener/Get", "")
+	assert.Nil(t, err)
+	assert.Equal(t, Identity{}, identity)
+
+	_, err = call(newAuthenticator(true), "/grpc.URLShortener/Get", "")
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+}
+
+func TestAuthenticator_Token(t *testing.T) {
+	a := newAuthenticator(true)
+
+	identity, err := call(a, "/grpc.URLShortener/Get", "user-token")
+	assert.Nil(t, err)
+	assert.Equal(t, Identity{Name: "user"}, identity)
+
+	_, err = call(a, "/grpc.URLShortener/Get", "wrong-token")
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+}
+
+func TestAuthenticator_AdminOnly(t *testing.T) {
+	a := newAuthenticator(false)
+
+	_, err := call(a, adminMethod, "")
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	_, err = call(a, adminMethod, "user-token")
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	identity, err := call(a, adminMethod, "admin-token")
+	assert.Nil(t, err)
+	assert.Equal(t, Identity{Name: "admin", Admin: true}, identity)
+}
+
+func TestParseBearer(t *testing.T) {
+	token, ok := ParseBearer("Bearer abc")
+	assert.True(t, ok)
+	assert.Equal(t, "abc", token)
+
+	token, ok = ParseBearer("bearer abc")
+	assert.True(t, ok)
+	assert.Equal(t, "abc", token)
+
+	_, ok = ParseBearer("Basic abc")
+	assert.False(t, ok)
+
+	_, ok = ParseBearer("Bearer ")
+	assert.False(t, ok)
+}
@@ -0,0 +1,50 @@
+package backoff
+
+import (
+	"context"
+	"math"
+	"math/rand"
+	"time"
+)
+
+// Backoff exponential backoff with jitter
+type Backoff struct {
+	// first delay
+	Initial time.Duration
+	// max delay
+	Max time.Duration
+	// delay growth per attempt, 2 if not set
+	Multiplier float64
+	// random part of delay in [0, 1], delay is reduced by up to Jitter*delay
+	Jitter float64
+}
+
+// Delay returns delay before attempt, attempts start from 0
+func (b Backoff) Delay(attempt int) time.Duration {
+	multiplier := b.Multiplier
+	if multiplier <= 1 {
+		multiplier = 2
+	}
+
+	delay := float64(b.Initial) * math.Pow(multiplier, float64(attempt))
+	if b.Max > 0 && delay > float64(b.Max) {
+		delay = float64(b.Max)
+	}
+	if b.Jitter > 0 {
+		delay -= delay * math.Min(b.Jitter, 1) * rand.Float64()
+	}
+	return time.Duration(delay)
+}
+
+// Sleep waits d or until context is done
+func Sleep(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
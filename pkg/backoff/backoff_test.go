@@ -0,0 +1,37 @@
+package backoff
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBackoff_Delay(t *testing.T) {
+	b := Backoff{Initial: 10 * time.Millisecond, Max: 100 * time.Millisecond}
+
+	assert.Equal(t, 10*time.Millisecond, b.Delay(0))
+	assert.Equal(t, 20*time.Millisecond, b.Delay(1))
+	assert.Equal(t, 40*time.Millisecond, b.Delay(2))
+	assert.Equal(t, 80*time.Millisecond, b.Delay(3))
+	assert.Equal(t, 100*time.Millisecond, b.Delay(4))
+	assert.Equal(t, 100*time.Millisecond, b.Delay(100))
+}
+
+func TestBackoff_DelayJitter(t *testing.T) {
+	b := Backoff{Initial: 10 * time.Millisecond, Max: 100 * time.Millisecond, Multiplier: 3, Jitter: 0.5}
+
+	for i := 0; i < 1000; i++ {
+		d := b.Delay(1)
+		assert.True(t, d > 15*time.Millisecond && d <= 30*time.Millisecond, d)
+	}
+}
+
+func TestSleep(t *testing.T) {
+	assert.Nil(t, Sleep(context.Background(), time.Millisecond))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.ErrorIs(t, Sleep(ctx, time.Hour), context.Canceled)
+}
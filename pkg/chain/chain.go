@@ -0,0 +1,198 @@
+package chain
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"url_shortener/pkg/config"
+	"url_shortener/pkg/policy"
+)
+
+const (
+	// ActionReject rejects links to third-party shorteners
+	ActionReject = "reject"
+	// ActionUnwrap replaces links to third-party shorteners by their destination
+	ActionUnwrap = "unwrap"
+
+	defaultMaxHops       = 5
+	defaultUnwrapTimeout = 5 * time.Second
+)
+
+var (
+	// ErrShortener link to third-party shortener is rejected
+	ErrShortener = errors.New("links to URL shorteners aren't allowed")
+	// ErrLoop link redirects to itself
+	ErrLoop = errors.New("redirect loop")
+	// ErrTooManyHops destination isn't resolved in max hops
+	ErrTooManyHops = errors.New("too many redirects")
+	// ErrUnwrap third-party shortener link isn't resolved
+	ErrUnwrap = errors.New("cannot resolve shortener link")
+)
+
+// Lookup returns original URL of own short URL
+type Lookup func(ctx context.Context, shortURL string) (string, error)
+
+// Resolver resolves links to own short links and third-party shorteners to their destination
+type Resolver struct {
+	// host and path prefix of public URL
+	publicHost string
+	publicPath string
+
+	own        policy.DomainSet
+	shorteners policy.DomainSet
+	unwrap     bool
+	maxHops    int
+
+	client *http.Client
+	lookup Lookup
+}
+
+// New creates resolver, host of publicURL is own domain if publicURL is set
+func New(cfg config.ChainsConfig, publicURL string, lookup Lookup) (*Resolver, error) {
+	r := &Resolver{maxHops: cfg.MaxHops, lookup: lookup}
+	if r.maxHops <= 0 {
+		r.maxHops = defaultMaxHops
+	}
+
+	switch cfg.ShortenerAction {
+	case "", ActionReject:
+	case ActionUnwrap:
+		r.unwrap = true
+	default:
+		return nil, fmt.Errorf("chain: unknown shortener action `%s`", cfg.ShortenerAction)
+	}
+
+	var err error
+	if r.own, err = policy.NewDomainSet(cfg.OwnDomains); err != nil {
+		return nil, fmt.Errorf("chain: invalid own domains: %w", err)
+	}
+	if publicURL != "" {
+		u, err := policy.Normalize(publicURL)
+		if err != nil || u.Hostname() == "" {
+			return nil, fmt.Errorf("chain: invalid public URL `%s`", publicURL)
+		}
+		r.publicHost, r.publicPath = u.Hostname(), strings.TrimSuffix(u.Path, "/")
+	}
+	if r.shorteners, err = policy.NewDomainSet(cfg.Shorteners); err != nil {
+		return nil, fmt.Errorf("chain: invalid shorteners: %w", err)
+	}
+
+	timeout := time.Duration(cfg.UnwrapTimeout) * time.Second
+	if timeout <= 0 {
+		timeout = defaultUnwrapTimeout
+	}
+	r.client = &http.Client{
+		Timeout: timeout,
+		// redirects are followed by Resolve, so every hop is checked
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	return r, nil
+}
+
+// Resolve returns destination of URL: own short links are replaced by their original URLs,
+// third-party shortener links are rejected or replaced by their redirect targets,
+// other URLs are returned as is
+func (r *Resolver) Resolve(ctx context.Context, rawURL string) (string, error) {
+	visited := map[string]bool{}
+	for hop := 0; ; hop++ {
+		u, err := policy.Normalize(rawURL)
+		if err != nil || u.Host == "" {
+			// not resolvable, policy rejects invalid URLs
+			return rawURL, nil
+		}
+		if visited[u.String()] {
+			return "", fmt.Errorf("%w: %s", ErrLoop, rawURL)
+		}
+		visited[u.String()] = true
+
+		next, ok, err := r.next(ctx, u, rawURL)
+		if err != nil {
+			return "", err
+		}
+		if !ok {
+			return rawURL, nil
+		}
+		if hop == r.maxHops {
+			return "", fmt.Errorf("%w: %s", ErrTooManyHops, rawURL)
+		}
+		rawURL = next
+	}
+}
+
+// next returns URL link redirects to, false if URL isn't link
+func (r *Resolver) next(ctx context.Context, u *url.URL, rawURL string) (string, bool, error) {
+	if shortURL, ok := r.ownShortURL(u); ok {
+		originalURL, err := r.lookup(ctx, shortURL)
+		if err != nil {
+			return "", false, err
+		}
+		return originalURL, true, nil
+	}
+
+	if !r.shorteners.Match(u.Hostname()) {
+		return "", false, nil
+	}
+	if !r.unwrap {
+		return "", false, fmt.Errorf("%w: %s", ErrShortener, u.Hostname())
+	}
+	next, err := r.fetch(ctx, rawURL)
+	if err != nil {
+		return "", false, fmt.Errorf("%w %s: %v", ErrUnwrap, rawURL, err)
+	}
+	return next, true, nil
+}
+
+// ownShortURL returns short URL of own short link, preview links `/{short_url}+` are own links too
+func (r *Resolver) ownShortURL(u *url.URL) (string, bool) {
+	path := u.Path
+	switch {
+	case r.publicHost != "" && u.Hostname() == r.publicHost:
+		if !strings.HasPrefix(path, r.publicPath+"/") {
+			return "", false
+		}
+		path = strings.TrimPrefix(path, r.publicPath)
+	case r.own.Match(u.Hostname()):
+	default:
+		return "", false
+	}
+
+	shortURL := strings.TrimSuffix(strings.TrimPrefix(path, "/"), "+")
+	if shortURL == "" || strings.Contains(shortURL, "/") {
+		// other pages of own site
+		return "", false
+	}
+	return shortURL, true
+}
+
+// fetch returns redirect target of shortener link
+func (r *Resolver) fetch(ctx context.Context, rawURL string) (string, error) {
+	if !strings.Contains(rawURL, "://") {
+		rawURL = "http://" + rawURL
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+		_ = resp.Body.Close()
+	}()
+
+	location, err := resp.Location()
+	if err != nil {
+		return "", fmt.Errorf("no redirect, status %s", resp.Status)
+	}
+	return location.String(), nil
+}
@@ -0,0 +1,107 @@
+package chain
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"url_shortener/pkg/config"
+)
+
+var errNotFound = errors.New("not found")
+
+func lookup(links map[string]string) Lookup {
+	return func(_ context.Context, shortURL string) (string, error) {
+		originalURL, ok := links[shortURL]
+		if !ok {
+			return "", errNotFound
+		}
+		return originalURL, nil
+	}
+}
+
+func TestResolver_Own(t *testing.T) {
+	links := map[string]string{
+		"a":    "https://example.com/a",
+		"b":    "https://sho.rt/a",
+		"loop": "go.sho.rt/loop",
+	}
+	r, err := New(config.ChainsConfig{OwnDomains: []string{"sho.rt"}}, "https://s.example.com/s/", lookup(links))
+	assert.Nil(t, err)
+
+	for rawURL, expected := range map[string]string{
+		"https://SHO.RT/a":          "https://example.com/a",
+		"sho.rt/b+":                 "https://example.com/a",
+		"https://s.example.com/s/a": "https://example.com/a",
+		"https://s.example.com/a":   "https://s.example.com/a",
+		"https://sho.rt/v1/links/a": "https://sho.rt/v1/links/a",
+		"https://example.com/a":     "https://example.com/a",
+	} {
+		resolved, err := r.Resolve(context.Background(), rawURL)
+		assert.Nil(t, err, rawURL)
+		assert.Equal(t, expected, resolved, rawURL)
+	}
+
+	// single segment path on own domain is short link
+	_, err = r.Resolve(context.Background(), "https://sho.rt/openapi.json")
+	assert.True(t, errors.Is(err, errNotFound))
+
+	_, err = r.Resolve(context.Background(), "https://sho.rt/loop")
+	assert.True(t, errors.Is(err, ErrLoop))
+}
+
+func TestResolver_Shorteners(t *testing.T) {
+	var shortener *httptest.Server
+	shortener = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+		case "/x":
+			http.Redirect(w, req, "https://example.com/x", http.StatusMovedPermanently)
+		case "/nested":
+			http.Redirect(w, req, "/x", http.StatusFound)
+		case "/loop":
+			http.Redirect(w, req, shortener.URL+"/loop", http.StatusFound)
+		default:
+			http.NotFound(w, req)
+		}
+	}))
+	defer shortener.Close()
+
+	r, err := New(config.ChainsConfig{Shorteners: []string{"127.0.0.1"}}, "", lookup(nil))
+	assert.Nil(t, err)
+	_, err = r.Resolve(context.Background(), shortener.URL+"/x")
+	assert.True(t, errors.Is(err, ErrShortener))
+
+	r, err = New(config.ChainsConfig{Shorteners: []string{"127.0.0.1"}, ShortenerAction: ActionUnwrap, MaxHops: 2}, "", lookup(nil))
+	assert.Nil(t, err)
+
+	resolved, err := r.Resolve(context.Background(), shortener.URL+"/nested")
+	assert.Nil(t, err)
+	assert.Equal(t, "https://example.com/x", resolved)
+
+	_, err = r.Resolve(context.Background(), shortener.URL+"/loop")
+	assert.True(t, errors.Is(err, ErrLoop))
+
+	_, err = r.Resolve(context.Background(), shortener.URL+"/missing")
+	assert.True(t, errors.Is(err, ErrUnwrap))
+
+	_, err = New(config.ChainsConfig{ShortenerAction: "follow"}, "", lookup(nil))
+	assert.NotNil(t, err)
+}
+
+func TestResolver_TooManyHops(t *testing.T) {
+	links := map[string]string{"a": "sho.rt/b", "b": "sho.rt/c", "c": "example.com"}
+
+	r, err := New(config.ChainsConfig{OwnDomains: []string{"sho.rt"}, MaxHops: 2}, "", lookup(links))
+	assert.Nil(t, err)
+
+	_, err = r.Resolve(context.Background(), "sho.rt/a")
+	assert.True(t, errors.Is(err, ErrTooManyHops))
+
+	resolved, err := r.Resolve(context.Background(), "sho.rt/b")
+	assert.Nil(t, err)
+	assert.Equal(t, "example.com", resolved)
+}
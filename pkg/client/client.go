@@ -0,0 +1,374 @@
+package client
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/hashicorp/golang-lru"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+
+	"url_shortener/pkg/backoff"
+
+	pb "url_shortener/pkg/grpc"
+)
+
+const (
+	DefaultTimeout = 5 * time.Second
+	DefaultRetries = 3
+)
+
+// Client URL shortener client over pool of gRPC connections
+type Client struct {
+	conns   []*grpc.ClientConn
+	clients []pb.URLShortenerClient
+	next    uint32
+
+	timeout time.Duration
+	retries int
+	backoff backoff.Backoff
+
+	// short -> original URL read-through cache, nil if disabled
+	cache    *lru.Cache
+	cacheTTL time.Duration
+}
+
+type cacheEntry struct {
+	originalURL string
+	// zero time if entry doesn't expire
+	expires time.Time
+}
+
+type options struct {
+	poolSize    int
+	timeout     time.Duration
+	retries     int
+	backoff     backoff.Backoff
+	tlsConfig   *tls.Config
+	token       string
+	cacheSize   int
+	cacheTTL    time.Duration
+	block       bool
+	dialOptions []grpc.DialOption
+}
+
+// Option configures Client
+type Option func(o *options)
+
+// WithPoolSize sets count of connections used in round-robin order
+func WithPoolSize(n int) Option {
+	return func(o *options) { o.poolSize = n }
+}
+
+// WithTimeout sets timeout of single call try
+func WithTimeout(d time.Duration) Option {
+	return func(o *options) { o.timeout = d }
+}
+
+// WithRetries sets tries count of calls failed with Unavailable status and backoff between them
+func WithRetries(n int, b backoff.Backoff) Option {
+	return func(o *options) { o.retries, o.backoff = n, b }
+}
+
+// WithTLS enables TLS transport
+func WithTLS(cfg *tls.Config) Option {
+	return func(o *options) { o.tlsConfig = cfg }
+}
+
+// WithToken sends token as `authorization: Bearer <token>` metadata
+func WithToken(token string) Option {
+	return func(o *options) { o.token = token }
+}
+
+// WithCache enables Get read-through cache of size entries living ttl, entries don't expire if ttl is 0
+func WithCache(size int, ttl time.Duration) Option {
+	return func(o *options) { o.cacheSize, o.cacheTTL = size, ttl }
+}
+
+// WithBlock makes New wait until connections are established
+func WithBlock() Option {
+	return func(o *options) { o.block = true }
+}
+
+// WithDialOptions adds gRPC dial options
+func WithDialOptions(opts ...grpc.DialOption) Option {
+	return func(o *options) { o.dialOptions = append(o.dialOptions, opts...) }
+}
+
+func New(ctx context.Context, address string, opts ...Option) (*Client, error) {
+	o := options{
+		poolSize: 1,
+		timeout:  DefaultTimeout,
+		retries:  DefaultRetries,
+		backoff:  backoff.Backoff{Initial: 100 * time.Millisecond, Max: 2 * time.Second, Jitter: 0.5},
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if o.poolSize <= 0 {
+		o.poolSize = 1
+	}
+	if o.retries <= 0 {
+		o.retries = 1
+	}
+
+	dialOptions := append([]grpc.DialOption{}, o.dialOptions...)
+	if o.tlsConfig != nil {
+		dialOptions = append(dialOptions, grpc.WithTransportCredentials(credentials.NewTLS(o.tlsConfig)))
+	} else {
+		dialOptions = append(dialOptions, grpc.WithInsecure())
+	}
+	if o.token != "" {
+		dialOptions = append(dialOptions, grpc.WithPerRPCCredentials(&tokenCredentials{token: o.token, secure: o.tlsConfig != nil}))
+	}
+	if o.block {
+		dialOptions = append(dialOptions, grpc.WithBlock(), grpc.FailOnNonTempDialError(true))
+	}
+
+	c := &Client{
+		timeout:  o.timeout,
+		retries:  o.retries,
+		backoff:  o.backoff,
+		cacheTTL: o.cacheTTL,
+	}
+	if o.cacheSize > 0 {
+		var err error
+		if c.cache, err = lru.New(o.cacheSize); err != nil {
+			return nil, fmt.Errorf("client: cannot create cache: %w", err)
+		}
+	}
+
+	for i := 0; i < o.poolSize; i++ {
+		conn, err := grpc.DialContext(ctx, address, dialOptions...)
+		if err != nil {
+			_ = c.Close()
+			return nil, fmt.Errorf("client: cannot connect to `%s`: %w", address, err)
+		}
+		c.conns = append(c.conns, conn)
+		c.clients = append(c.clients, pb.NewURLShortenerClient(conn))
+	}
+
+	return c, nil
+}
+
+// Create shorts original URL and returns short URL
+func (c *Client) Create(ctx context.Context, originalURL string) (string, error) {
+	return c.CreateLink(ctx, &pb.CreateRequest{OriginalUrl: originalURL})
+}
+
+// CreateLink shorts original URL with link options and returns short URL
+func (c *Client) CreateLink(ctx context.Context, req *pb.CreateRequest) (string, error) {
+	var resp *pb.CreateResponse
+	err := c.call(ctx, func(ctx context.Context, client pb.URLShortenerClient) (err error) {
+		resp, err = client.Create(ctx, req)
+		return err
+	})
+	if err != nil {
+		return "", err
+	}
+	// protected, click limited and scheduled links are resolved by server only, original URL
+	// of request can be resolved by server, so stored one is cached only
+	if resp.GetOriginalUrl() != "" && req.GetPassword() == "" && req.GetMaxClicks() == 0 &&
+		req.GetNotBefore() == nil && req.GetNotAfter() == nil {
+		c.cacheAdd(resp.GetShortUrl(), resp.GetOriginalUrl(), time.Time{})
+	}
+	return resp.GetShortUrl(), nil
+}
+
+// Get returns original URL by short URL
+func (c *Client) Get(ctx context.Context, shortURL string) (string, error) {
+	if originalURL, ok := c.cacheGet(shortURL); ok {
+		return originalURL, nil
+	}
+
+	var resp *pb.GetResponse
+	err := c.call(ctx, func(ctx context.Context, client pb.URLShortenerClient) (err error) {
+		resp, err = client.Get(ctx, &pb.GetRequest{ShortUrl: shortURL})
+		return err
+	})
+	if err != nil {
+		return "", err
+	}
+	if !resp.GetNoCache() {
+		var validUntil time.Time
+		if resp.GetValidUntil() != nil {
+			validUntil = resp.GetValidUntil().AsTime()
+		}
+		c.cacheAdd(shortURL, resp.GetOriginalUrl(), validUntil)
+	}
+	return resp.GetOriginalUrl(), nil
+}
+
+// GetProtected returns original URL of password protected short URL bypassing cache,
+// results of protected links aren't shared with Get callers
+func (c *Client) GetProtected(ctx context.Context, shortURL, password string) (string, error) {
+	var resp *pb.GetResponse
+	err := c.call(ctx, func(ctx context.Context, client pb.URLShortenerClient) (err error) {
+		resp, err = client.Get(ctx, &pb.GetRequest{ShortUrl: shortURL, Password: password})
+		return err
+	})
+	if err != nil {
+		return "", err
+	}
+	return resp.GetOriginalUrl(), nil
+}
+
+// Resolve returns destination of short URL for request attributes bypassing cache
+func (c *Client) Resolve(ctx context.Context, req *pb.ResolveRequest) (*pb.ResolveResponse, error) {
+	var resp *pb.ResolveResponse
+	err := c.call(ctx, func(ctx context.Context, client pb.URLShortenerClient) (err error) {
+		resp, err = client.Resolve(ctx, req)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// Preview returns public link fields without counting click
+func (c *Client) Preview(ctx context.Context, shortURL string) (*pb.Link, error) {
+	var resp *pb.PreviewResponse
+	err := c.call(ctx, func(ctx context.Context, client pb.URLShortenerClient) (err error) {
+		resp, err = client.Preview(ctx, &pb.PreviewRequest{ShortUrl: shortURL})
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return resp.GetLink(), nil
+}
+
+// Info returns full link record
+func (c *Client) Info(ctx context.Context, shortURL string) (*pb.Link, error) {
+	var resp *pb.GetLinkInfoResponse
+	err := c.call(ctx, func(ctx context.Context, client pb.URLShortenerClient) (err error) {
+		resp, err = client.GetLinkInfo(ctx, &pb.GetLinkInfoRequest{ShortUrl: shortURL})
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return resp.GetLink(), nil
+}
+
+// QRCode renders QR code of full short URL
+func (c *Client) QRCode(ctx context.Context, req *pb.GetQRCodeRequest) (*pb.GetQRCodeResponse, error) {
+	var resp *pb.GetQRCodeResponse
+	err := c.call(ctx, func(ctx context.Context, client pb.URLShortenerClient) (err error) {
+		resp, err = client.GetQRCode(ctx, req)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// UpdateMetadata updates link metadata fields of request update mask and returns updated metadata
+func (c *Client) UpdateMetadata(ctx context.Context, req *pb.UpdateMetadataRequest) (*pb.Metadata, error) {
+	var resp *pb.UpdateMetadataResponse
+	err := c.call(ctx, func(ctx context.Context, client pb.URLShortenerClient) (err error) {
+		resp, err = client.UpdateMetadata(ctx, req)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return resp.GetMetadata(), nil
+}
+
+// List returns page of links matching request filters, next page is requested
+// with NextPageToken of response
+func (c *Client) List(ctx context.Context, req *pb.ListLinksRequest) (*pb.ListLinksResponse, error) {
+	var resp *pb.ListLinksResponse
+	err := c.call(ctx, func(ctx context.Context, client pb.URLShortenerClient) (err error) {
+		resp, err = client.ListLinks(ctx, req)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// Raw returns generated gRPC client of next pool connection
+func (c *Client) Raw() pb.URLShortenerClient {
+	return c.clients[int(atomic.AddUint32(&c.next, 1)-1)%len(c.clients)]
+}
+
+func (c *Client) Close() error {
+	var err error
+	for _, conn := range c.conns {
+		if closeErr := conn.Close(); closeErr != nil && err == nil {
+			err = closeErr
+		}
+	}
+	return err
+}
+
+// call calls fn with per-try timeout and retries of Unavailable errors,
+// returns errors converted to Error
+func (c *Client) call(ctx context.Context, fn func(ctx context.Context, client pb.URLShortenerClient) error) error {
+	var err error
+	for i := 0; i < c.retries; i++ {
+		callCtx, cancel := context.WithTimeout(ctx, c.timeout)
+		err = fromStatus(fn(callCtx, c.Raw()))
+		cancel()
+
+		if err == nil || !errors.Is(err, ErrUnavailable) || i+1 == c.retries {
+			break
+		}
+		if sleepErr := backoff.Sleep(ctx, c.backoff.Delay(i)); sleepErr != nil {
+			break
+		}
+	}
+	return err
+}
+
+func (c *Client) cacheGet(shortURL string) (string, bool) {
+	if c.cache == nil {
+		return "", false
+	}
+	v, ok := c.cache.Get(shortURL)
+	if !ok {
+		return "", false
+	}
+	entry := v.(cacheEntry)
+	if !entry.expires.IsZero() && time.Now().After(entry.expires) {
+		c.cache.Remove(shortURL)
+		return "", false
+	}
+	return entry.originalURL, true
+}
+
+// cacheAdd caches original URL until TTL or time it changes, whichever is first,
+// zero validUntil doesn't limit entry
+func (c *Client) cacheAdd(shortURL, originalURL string, validUntil time.Time) {
+	if c.cache == nil {
+		return
+	}
+	expires := validUntil
+	if ttlExpires := time.Now().Add(c.cacheTTL); c.cacheTTL > 0 && (expires.IsZero() || ttlExpires.Before(expires)) {
+		expires = ttlExpires
+	}
+	c.cache.Add(shortURL, cacheEntry{originalURL: originalURL, expires: expires})
+}
+
+// tokenCredentials sends bearer token with every call
+type tokenCredentials struct {
+	token  string
+	secure bool
+}
+
+func (t *tokenCredentials) GetRequestMetadata(context.Context, ...string) (map[string]string, error) {
+	return map[string]string{"authorization": "Bearer " + t.token}, nil
+}
+
+func (t *tokenCredentials) RequireTransportSecurity() bool {
+	return t.secure
+}
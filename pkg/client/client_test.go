@@ -0,0 +1,313 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"url_shortener/pkg/backoff"
+
+	pb "url_shortener/pkg/grpc"
+)
+
+type shortenerMock struct {
+	pb.UnimplementedURLShortenerServer
+
+	mu sync.Mutex
+	// Get calls count
+	gets int
+	// calls failed with Unavailable before success
+	unavailable int
+	// authorization metadata of last call
+	authorization []string
+	// activation time of scheduled link
+	launch time.Time
+	// original URL stored by Create, not returned if empty
+	stored string
+}
+
+func (s *shortenerMock) Create(ctx context.Context, req *pb.CreateRequest) (*pb.CreateResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	md, _ := metadata.FromIncomingContext(ctx)
+	s.authorization = md.Get("authorization")
+
+	if req.GetOriginalUrl() == "" {
+		return nil, status.Error(codes.InvalidArgument, "cannot short empty URL")
+	}
+	return &pb.CreateResponse{ShortUrl: "short", OriginalUrl: s.stored}, nil
+}
+
+func (s *shortenerMock) Get(_ context.Context, req *pb.GetRequest) (*pb.GetResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.gets++
+	if s.unavailable > 0 {
+		s.unavailable--
+		return nil, status.Error(codes.Unavailable, "database is unavailable")
+	}
+	switch req.GetShortUrl() {
+	case "short":
+		return &pb.GetResponse{OriginalUrl: "original"}, nil
+	case "limited":
+		return &pb.GetResponse{OriginalUrl: "original", NoCache: true}, nil
+	case "scheduled":
+		return &pb.GetResponse{OriginalUrl: "fallback", Inactive: true, ValidUntil: timestamppb.New(s.launch)}, nil
+	case "exhausted":
+		return nil, status.Error(codes.ResourceExhausted, "link click limit is reached")
+	case "expired":
+		st, _ := status.New(codes.FailedPrecondition, "link expired").
+			WithDetails(&errdetails.ErrorInfo{Reason: inactiveReason})
+		return nil, st.Err()
+	case "chained":
+		return nil, status.Error(codes.FailedPrecondition, "cannot unwrap short link")
+	case "protected":
+		st, _ := status.New(codes.PermissionDenied, "password is required").
+			WithDetails(&errdetails.ErrorInfo{Reason: passwordRequiredReason})
+		return nil, st.Err()
+	case "disabled":
+		return nil, status.Error(codes.PermissionDenied, "link is disabled")
+	}
+	return nil, status.Error(codes.NotFound, "no pair to provided short URL")
+}
+
+func (s *shortenerMock) GetQRCode(_ context.Context, req *pb.GetQRCodeRequest) (*pb.GetQRCodeResponse, error) {
+	if req.GetShortUrl() != "short" {
+		return nil, status.Error(codes.NotFound, "no pair to provided short URL")
+	}
+	return &pb.GetQRCodeResponse{Url: "https://sho.rt/short", Image: []byte("image"), ContentType: "image/png"}, nil
+}
+
+func (s *shortenerMock) Preview(_ context.Context, req *pb.PreviewRequest) (*pb.PreviewResponse, error) {
+	if req.GetShortUrl() != "short" {
+		return nil, status.Error(codes.NotFound, "no pair to provided short URL")
+	}
+	return &pb.PreviewResponse{Link: &pb.Link{ShortUrl: "short", OriginalUrl: "original", Clicks: 42}}, nil
+}
+
+func (s *shortenerMock) ListLinks(_ context.Context, req *pb.ListLinksRequest) (*pb.ListLinksResponse, error) {
+	if req.GetPageToken() == "" {
+		return &pb.ListLinksResponse{Links: []*pb.Link{{ShortUrl: "a"}}, NextPageToken: "next"}, nil
+	}
+	return &pb.ListLinksResponse{Links: []*pb.Link{{ShortUrl: "b"}}}, nil
+}
+
+func (s *shortenerMock) UpdateMetadata(_ context.Context, req *pb.UpdateMetadataRequest) (*pb.UpdateMetadataResponse, error) {
+	if req.GetShortUrl() != "short" {
+		return nil, status.Error(codes.NotFound, "no pair to provided short URL")
+	}
+	return &pb.UpdateMetadataResponse{Metadata: req.GetMetadata()}, nil
+}
+
+func newClient(t *testing.T, mock *shortenerMock, opts ...Option) *Client {
+	lis := bufconn.Listen(1 << 20)
+	grpcServer := grpc.NewServer()
+	pb.RegisterURLShortenerServer(grpcServer, mock)
+	go func() { _ = grpcServer.Serve(lis) }()
+	t.Cleanup(grpcServer.Stop)
+
+	dialer := func(context.Context, string) (net.Conn, error) {
+		return lis.Dial()
+	}
+	opts = append(opts, WithDialOptions(grpc.WithContextDialer(dialer)))
+
+	c, err := New(context.Background(), "bufnet", opts...)
+	assert.Nil(t, err)
+	t.Cleanup(func() { _ = c.Close() })
+	return c
+}
+
+func TestClient_CreateGet(t *testing.T) {
+	c := newClient(t, &shortenerMock{}, WithPoolSize(3))
+
+	shortURL, err := c.Create(context.Background(), "original")
+	assert.Nil(t, err)
+	assert.Equal(t, "short", shortURL)
+
+	originalURL, err := c.Get(context.Background(), "short")
+	assert.Nil(t, err)
+	assert.Equal(t, "original", originalURL)
+}
+
+func TestClient_QRCode(t *testing.T) {
+	c := newClient(t, &shortenerMock{})
+
+	resp, err := c.QRCode(context.Background(), &pb.GetQRCodeRequest{ShortUrl: "short"})
+	assert.Nil(t, err)
+	assert.Equal(t, "https://sho.rt/short", resp.GetUrl())
+	assert.Equal(t, []byte("image"), resp.GetImage())
+
+	_, err = c.QRCode(context.Background(), &pb.GetQRCodeRequest{ShortUrl: "not exist"})
+	assert.True(t, errors.Is(err, ErrNotFound))
+}
+
+func TestClient_Preview(t *testing.T) {
+	c := newClient(t, &shortenerMock{})
+
+	link, err := c.Preview(context.Background(), "short")
+	assert.Nil(t, err)
+	assert.Equal(t, "original", link.GetOriginalUrl())
+	assert.Equal(t, int64(42), link.GetClicks())
+
+	_, err = c.Preview(context.Background(), "not exist")
+	assert.True(t, errors.Is(err, ErrNotFound))
+}
+
+func TestClient_UpdateMetadata(t *testing.T) {
+	c := newClient(t, &shortenerMock{})
+
+	m, err := c.UpdateMetadata(context.Background(), &pb.UpdateMetadataRequest{ShortUrl: "short", Metadata: &pb.Metadata{Title: "title"}})
+	assert.Nil(t, err)
+	assert.Equal(t, "title", m.GetTitle())
+
+	_, err = c.UpdateMetadata(context.Background(), &pb.UpdateMetadataRequest{ShortUrl: "not exist"})
+	assert.True(t, errors.Is(err, ErrNotFound))
+}
+
+func TestClient_List(t *testing.T) {
+	c := newClient(t, &shortenerMock{})
+
+	resp, err := c.List(context.Background(), &pb.ListLinksRequest{})
+	assert.Nil(t, err)
+	assert.Equal(t, "a", resp.GetLinks()[0].GetShortUrl())
+
+	resp, err = c.List(context.Background(), &pb.ListLinksRequest{PageToken: resp.GetNextPageToken()})
+	assert.Nil(t, err)
+	assert.Equal(t, "b", resp.GetLinks()[0].GetShortUrl())
+	assert.Empty(t, resp.GetNextPageToken())
+}
+
+func TestClient_Errors(t *testing.T) {
+	c := newClient(t, &shortenerMock{})
+
+	_, err := c.Get(context.Background(), "not exist")
+	assert.True(t, errors.Is(err, ErrNotFound))
+
+	_, err = c.Create(context.Background(), "")
+	assert.True(t, errors.Is(err, ErrInvalidArgument))
+
+	clientErr := &Error{}
+	assert.True(t, errors.As(err, &clientErr))
+	assert.Equal(t, codes.InvalidArgument, clientErr.Code)
+	assert.Equal(t, "cannot short empty URL", clientErr.Message)
+
+	_, err = c.Get(context.Background(), "exhausted")
+	assert.True(t, errors.Is(err, ErrExhausted))
+
+	_, err = c.Get(context.Background(), "expired")
+	assert.True(t, errors.Is(err, ErrInactive))
+
+	// other failed preconditions aren't inactive links
+	_, err = c.Get(context.Background(), "chained")
+	assert.False(t, errors.Is(err, ErrInactive))
+
+	_, err = c.Get(context.Background(), "protected")
+	assert.True(t, errors.Is(err, ErrPasswordRequired))
+	assert.True(t, errors.Is(err, ErrPermissionDenied))
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+	assert.Len(t, status.Convert(err).Details(), 1)
+
+	_, err = c.Get(context.Background(), "disabled")
+	assert.False(t, errors.Is(err, ErrPasswordRequired))
+	assert.True(t, errors.Is(err, ErrPermissionDenied))
+}
+
+func TestClient_Retries(t *testing.T) {
+	b := backoff.Backoff{Initial: time.Millisecond, Max: time.Millisecond}
+
+	mock := &shortenerMock{unavailable: 2}
+	c := newClient(t, mock, WithRetries(3, b))
+
+	originalURL, err := c.Get(context.Background(), "short")
+	assert.Nil(t, err)
+	assert.Equal(t, "original", originalURL)
+	assert.Equal(t, 3, mock.gets)
+
+	mock = &shortenerMock{unavailable: 2}
+	c = newClient(t, mock, WithRetries(2, b))
+
+	_, err = c.Get(context.Background(), "short")
+	assert.True(t, errors.Is(err, ErrUnavailable))
+	assert.Equal(t, 2, mock.gets)
+}
+
+func TestClient_Cache(t *testing.T) {
+	mock := &shortenerMock{}
+	c := newClient(t, mock, WithCache(10, time.Minute))
+
+	for i := 0; i < 3; i++ {
+		originalURL, err := c.Get(context.Background(), "short")
+		assert.Nil(t, err)
+		assert.Equal(t, "original", originalURL)
+	}
+	assert.Equal(t, 1, mock.gets)
+
+	// expired
+	c.cache.Add("short", cacheEntry{originalURL: "original", expires: time.Now().Add(-time.Second)})
+	_, err := c.Get(context.Background(), "short")
+	assert.Nil(t, err)
+	assert.Equal(t, 2, mock.gets)
+
+	// click limited links aren't cached
+	for i := 0; i < 2; i++ {
+		_, err = c.Get(context.Background(), "limited")
+		assert.Nil(t, err)
+	}
+	assert.Equal(t, 4, mock.gets)
+
+	// fallback is cached until activation
+	launch := time.Now().Add(time.Second).Truncate(time.Microsecond)
+	mock.mu.Lock()
+	mock.launch = launch
+	mock.mu.Unlock()
+	_, err = c.Get(context.Background(), "scheduled")
+	assert.Nil(t, err)
+	entry, ok := c.cache.Get("scheduled")
+	assert.True(t, ok)
+	assert.True(t, launch.Equal(entry.(cacheEntry).expires))
+}
+
+func TestClient_CacheCreate(t *testing.T) {
+	mock := &shortenerMock{}
+	c := newClient(t, mock, WithCache(10, time.Minute))
+
+	// original URL isn't cached without stored one
+	_, err := c.Create(context.Background(), "https://bit.ly/abc")
+	assert.Nil(t, err)
+	_, ok := c.cache.Get("short")
+	assert.False(t, ok)
+
+	// stored original URL is cached instead of requested one
+	mock.mu.Lock()
+	mock.stored = "original"
+	mock.mu.Unlock()
+	_, err = c.Create(context.Background(), "https://bit.ly/abc")
+	assert.Nil(t, err)
+	originalURL, err := c.Get(context.Background(), "short")
+	assert.Nil(t, err)
+	assert.Equal(t, "original", originalURL)
+	assert.Equal(t, 0, mock.gets)
+}
+
+func TestClient_Token(t *testing.T) {
+	mock := &shortenerMock{}
+	c := newClient(t, mock, WithToken("secret"))
+
+	_, err := c.Create(context.Background(), "original")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"Bearer secret"}, mock.authorization)
+}
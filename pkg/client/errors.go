@@ -0,0 +1,104 @@
+package client
+
+import (
+	"errors"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// reasons of ErrorInfo details server sets to tell apart errors of the same code
+const (
+	// missing or wrong link password
+	passwordRequiredReason = "PASSWORD_REQUIRED"
+	// link outside of activation window
+	inactiveReason = "LINK_INACTIVE"
+)
+
+var (
+	ErrNotFound         = errors.New("not found")
+	ErrInvalidArgument  = errors.New("invalid argument")
+	ErrUnavailable      = errors.New("service unavailable")
+	ErrPermissionDenied = errors.New("permission denied")
+	ErrUnauthenticated  = errors.New("unauthenticated")
+	ErrTimeout          = errors.New("timeout")
+	ErrExhausted        = errors.New("link is exhausted")
+	// ErrInactive link outside of activation window, other FailedPrecondition errors don't match it
+	ErrInactive = errors.New("link is inactive")
+	// ErrPasswordRequired missing or wrong link password, error matches ErrPermissionDenied too
+	ErrPasswordRequired = errors.New("password required")
+)
+
+// Error server error, matches sentinel error of its code by errors.Is,
+// status with details is returned by GRPCStatus
+type Error struct {
+	Code    codes.Code
+	Message string
+
+	status *status.Status
+}
+
+func (e *Error) Error() string {
+	return e.Code.String() + ": " + e.Message
+}
+
+func (e *Error) Is(target error) bool {
+	switch target {
+	case ErrPasswordRequired:
+		return e.Code == codes.PermissionDenied && e.hasReason(passwordRequiredReason)
+	case ErrInactive:
+		return e.Code == codes.FailedPrecondition && e.hasReason(inactiveReason)
+	}
+	return codeErrors[e.Code] == target
+}
+
+// GRPCStatus returns status of server error, so status.FromError and status.Convert keep its details
+func (e *Error) GRPCStatus() *status.Status {
+	if e.status == nil {
+		return status.New(e.Code, e.Message)
+	}
+	return e.status
+}
+
+// Details returns details of server status
+func (e *Error) Details() []interface{} {
+	return e.GRPCStatus().Details()
+}
+
+// hasReason checks status has ErrorInfo detail of reason
+func (e *Error) hasReason(reason string) bool {
+	for _, detail := range e.Details() {
+		if info, ok := detail.(*errdetails.ErrorInfo); ok && info.GetReason() == reason {
+			return true
+		}
+	}
+	return false
+}
+
+var codeErrors = map[codes.Code]error{
+	codes.NotFound:          ErrNotFound,
+	codes.InvalidArgument:   ErrInvalidArgument,
+	codes.Unavailable:       ErrUnavailable,
+	codes.PermissionDenied:  ErrPermissionDenied,
+	codes.Unauthenticated:   ErrUnauthenticated,
+	codes.DeadlineExceeded:  ErrTimeout,
+	codes.ResourceExhausted: ErrExhausted,
+}
+
+// fromStatus converts gRPC status error to Error
+func fromStatus(err error) error {
+	if err == nil {
+		return nil
+	}
+	st, ok := status.FromError(err)
+	if !ok {
+		return err
+	}
+	return FromStatus(st)
+}
+
+// FromStatus returns Error of gRPC status keeping its details
+func FromStatus(st *status.Status) *Error {
+	return &Error{Code: st.Code(), Message: st.Message(), status: st}
+}
@@ -0,0 +1,130 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// client config file path relative to user config directory
+const clientConfigFile = "url_shortener/client.yml"
+
+// ClientConfig client config file with named profiles
+type ClientConfig struct {
+	// profile used if no profile is selected
+	CurrentProfile string                   `yaml:"current_profile,omitempty"`
+	Profiles       map[string]ProfileConfig `yaml:"profiles,omitempty"`
+}
+
+// ProfileConfig server connection settings of client
+type ProfileConfig struct {
+	Address string        `yaml:"address,omitempty"`
+	Timeout time.Duration `yaml:"timeout,omitempty"`
+	TLS     bool          `yaml:"tls,omitempty"`
+	// PEM file with trusted CA certificates, system pool if not set
+	CAFile string `yaml:"ca_file,omitempty"`
+	// TLS server name, host of address if not set
+	ServerName string `yaml:"server_name,omitempty"`
+	// bearer token
+	Token string `yaml:"token,omitempty"`
+}
+
+// ClientConfigPath returns client config path in user config directory
+// ($XDG_CONFIG_HOME/url_shortener/client.yml on Linux)
+func ClientConfigPath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("config: cannot find user config directory: %w", err)
+	}
+	return filepath.Join(dir, clientConfigFile), nil
+}
+
+// LoadClient loads client config, not existing file is empty config
+func LoadClient(path string) (*ClientConfig, error) {
+	c := ClientConfig{}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return &c, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err = yaml.Unmarshal(data, &c); err != nil {
+		return nil, fmt.Errorf("config: cannot parse `%s`: %w", path, err)
+	}
+	return &c, nil
+}
+
+// Save writes client config readable by owner only, it may contain tokens
+func (c *ClientConfig) Save(path string) error {
+	data, err := yaml.Marshal(c)
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0600)
+}
+
+// Profile returns profile by name or current profile if name is empty,
+// empty profile is returned if neither is set
+func (c *ClientConfig) Profile(name string) (ProfileConfig, error) {
+	if name == "" {
+		name = c.CurrentProfile
+	}
+	if name == "" {
+		return ProfileConfig{}, nil
+	}
+	p, ok := c.Profiles[name]
+	if !ok {
+		return ProfileConfig{}, fmt.Errorf("config: unknown profile `%s`", name)
+	}
+	return p, nil
+}
+
+// ProfileNames returns sorted profile names
+func (c *ClientConfig) ProfileNames() []string {
+	names := make([]string, 0, len(c.Profiles))
+	for name := range c.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Set sets profile setting by its yaml key, profile isn't changed on error
+func (p *ProfileConfig) Set(key, value string) error {
+	switch key {
+	case "address":
+		p.Address = value
+	case "timeout":
+		timeout, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("config: invalid `%s` value: %w", key, err)
+		}
+		p.Timeout = timeout
+	case "tls":
+		tls, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("config: invalid `%s` value: %w", key, err)
+		}
+		p.TLS = tls
+	case "ca_file":
+		p.CAFile = value
+	case "server_name":
+		p.ServerName = value
+	case "token":
+		p.Token = value
+	default:
+		return fmt.Errorf("config: unknown profile setting `%s`", key)
+	}
+	return nil
+}
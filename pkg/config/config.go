@@ -5,6 +5,7 @@ import (
 	"gopkg.in/yaml.v3"
 	"os"
 	"strconv"
+	"strings"
 )
 
 type Config struct {
@@ -31,26 +32,203 @@ type ServerConfig struct {
 	Host    string `yaml:"host"`
 	Port    int    `yaml:"port"`
 	LRUSize int    `yaml:"lru_size"`
+
+	// REST/JSON API port, disabled if not set
+	HTTPPort int `yaml:"http_port"`
+	// serve gRPC-Web on HTTP port for browser clients
+	GRPCWeb bool `yaml:"grpc_web"`
+	// CORS of HTTP port, disabled if no allowed origins
+	CORS CORSConfig `yaml:"cors"`
+
+	// base URL short URLs are served on, e.g. `https://sho.rt`, HTTP address if not set
+	PublicURL string `yaml:"public_url"`
+	// show interstitial page before redirect of every link
+	Interstitial bool `yaml:"interstitial"`
+	// period of clicks flush to database in seconds, 5 if not set
+	ClickFlushTime int `yaml:"click_flush_time"`
+
+	// register gRPC reflection service, admins only if auth is enabled
+	Reflection bool `yaml:"reflection"`
+
+	Auth AuthConfig `yaml:"auth"`
+
+	Policy PolicyConfig `yaml:"policy"`
+
+	Chains ChainsConfig `yaml:"chains"`
+
+	GeoIP GeoIPConfig `yaml:"geoip"`
+	// client IP of frontend requests is the last X-Forwarded-For address set by reverse proxy
+	TrustForwardedFor bool `yaml:"trust_forwarded_for"`
 }
 
 func (c *ServerConfig) HostAddress() string {
 	return fmt.Sprintf("%s:%d", c.Host, c.Port)
 }
 
+func (c *ServerConfig) HTTPAddress() string {
+	return fmt.Sprintf("%s:%d", c.Host, c.HTTPPort)
+}
+
+// DialAddress address to dial gRPC server from the same host
+func (c *ServerConfig) DialAddress() string {
+	host := c.Host
+	if host == "" {
+		host = "localhost"
+	}
+	return fmt.Sprintf("%s:%d", host, c.Port)
+}
+
+// PublicBaseURL base URL short URLs are served on without trailing slash
+func (c *ServerConfig) PublicBaseURL() string {
+	if c.PublicURL != "" {
+		return strings.TrimSuffix(c.PublicURL, "/")
+	}
+	host := c.Host
+	if host == "" {
+		host = "localhost"
+	}
+	return fmt.Sprintf("http://%s:%d", host, c.HTTPPort)
+}
+
+// AuthConfig static bearer tokens authentication
+type AuthConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// reject calls without token, otherwise anonymous calls are allowed except admin ones
+	Required bool          `yaml:"required"`
+	Tokens   []TokenConfig `yaml:"tokens,omitempty"`
+}
+
+type TokenConfig struct {
+	// caller name
+	Name  string `yaml:"name"`
+	Token string `yaml:"token"`
+	Admin bool   `yaml:"admin"`
+}
+
+// PolicyConfig destination URLs policy, rule is domain matching its subdomains too
+// or `regex:<expression>` matching normalized URL, text after ` #` is rejection reason
+type PolicyConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// schemes of original URLs, http and https if not set
+	AllowedSchemes []string `yaml:"allowed_schemes,omitempty"`
+	Blocklist      []string `yaml:"blocklist,omitempty"`
+	// allowed URLs aren't checked by blocklist
+	Allowlist []string `yaml:"allowlist,omitempty"`
+	// files with rule per line, reloaded on change
+	BlocklistFiles []string `yaml:"blocklist_files,omitempty"`
+	AllowlistFiles []string `yaml:"allowlist_files,omitempty"`
+	// check links on redirect, so links matching new rules aren't served
+	CheckRedirects bool `yaml:"check_redirects"`
+}
+
+// ChainsConfig links to short links: links to own short links are resolved to their destination,
+// links to third-party shorteners are rejected or unwrapped
+type ChainsConfig struct {
+	// hosts serving short links in addition to public_url host
+	OwnDomains []string `yaml:"own_domains,omitempty"`
+	// third-party URL shortener domains, subdomains match too
+	Shorteners []string `yaml:"shorteners,omitempty"`
+	// `reject` (default) or `unwrap` links to third-party shorteners
+	ShortenerAction string `yaml:"shortener_action"`
+	// max redirects followed to resolve destination, 5 if not set
+	MaxHops int `yaml:"max_hops"`
+	// timeout of third-party shortener request in seconds, 5 if not set
+	UnwrapTimeout int `yaml:"unwrap_timeout"`
+}
+
+// GeoIPConfig country lookup of clients for country URLs of links
+type GeoIPConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// MaxMind format country or city database, e.g. GeoLite2-Country.mmdb, reloaded on change
+	Database string `yaml:"database"`
+}
+
+type CORSConfig struct {
+	// allowed origins, `*` allows any origin
+	AllowedOrigins []string `yaml:"allowed_origins,omitempty"`
+	// request headers allowed in addition to gRPC-Web and REST ones
+	AllowedHeaders   []string `yaml:"allowed_headers,omitempty"`
+	AllowCredentials bool     `yaml:"allow_credentials"`
+	// preflight response cache time in seconds
+	MaxAge int `yaml:"max_age"`
+}
+
 type DBConfig struct {
+	// database driver: sql (default) or pgx
+	Driver string `yaml:"driver"`
+
 	Name     string `yaml:"name"`
 	Host     string `yaml:"host"`
 	Port     int    `yaml:"port"`
 	User     string `yaml:"user"`
 	Password string `yaml:"password"`
 
-	ConnTryTime  int `yaml:"conn_try_time"`
+	// first delay between connection tries in seconds
+	ConnTryTime int `yaml:"conn_try_time"`
+	// connection tries count, tries until success if not positive
 	ConnTriesCnt int `yaml:"conn_tries_cnt"`
+	// max delay between connection tries in seconds, delay is fixed if not set
+	ConnMaxTryTime int `yaml:"conn_max_try_time"`
+	// delay growth per connection try, 2 if not set
+	ConnBackoffMultiplier float64 `yaml:"conn_backoff_multiplier"`
+	// random part of delay in [0, 1]
+	ConnBackoffJitter float64 `yaml:"conn_backoff_jitter"`
+	// start daemon not ready and connect to database in background
+	BackgroundConnect bool `yaml:"background_connect"`
 
 	MaxIdleConns int `yaml:"max_idle_conns"`
 	MaxOpenConns int `yaml:"max_open_conns"`
+
+	// read-only replicas, share name and credentials with primary
+	Replicas []ReplicaConfig `yaml:"replicas,omitempty"`
+	// replicas health check period in seconds
+	ReplicaCheckTime int `yaml:"replica_check_time"`
+	// period in seconds after write when reads of written row go to primary
+	ReadYourWritesTime int `yaml:"read_your_writes_time"`
+
+	Resilience ResilienceConfig `yaml:"resilience"`
+}
+
+func (c *DBConfig) HostAddress() string {
+	return fmt.Sprintf("%s:%d", c.Host, c.Port)
 }
 
 func (c *DBConfig) ConnectURL() string {
-	return "postgres://" + c.User + ":" + c.Password + "@" + c.Host + ":" + strconv.Itoa(c.Port) + "/" + c.Name
+	return c.connectURL(c.Host, c.Port)
+}
+
+func (c *DBConfig) ReplicaConnectURL(r ReplicaConfig) string {
+	return c.connectURL(r.Host, r.Port)
+}
+
+func (c *DBConfig) connectURL(host string, port int) string {
+	return "postgres://" + c.User + ":" + c.Password + "@" + host + ":" + strconv.Itoa(port) + "/" + c.Name
+}
+
+type ReplicaConfig struct {
+	Host string `yaml:"host"`
+	Port int    `yaml:"port"`
+}
+
+func (c *ReplicaConfig) HostAddress() string {
+	return fmt.Sprintf("%s:%d", c.Host, c.Port)
+}
+
+// ResilienceConfig retries and circuit breaker around database calls
+type ResilienceConfig struct {
+	Enabled bool `yaml:"enabled"`
+
+	// tries of call failed with retryable error
+	RetryTries int `yaml:"retry_tries"`
+	// backoff between tries in milliseconds
+	RetryInitialMs int `yaml:"retry_initial_ms"`
+	RetryMaxMs     int `yaml:"retry_max_ms"`
+
+	// consecutive failures opening circuit breaker
+	BreakerFailures int `yaml:"breaker_failures"`
+	// seconds before opened circuit breaker lets probe call through
+	BreakerOpenTime int `yaml:"breaker_open_time"`
+
+	// serve cached URLs while database is unavailable
+	DegradedMode bool `yaml:"degraded_mode"`
 }
@@ -2,15 +2,28 @@ package daemon
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"net"
+	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/reflection"
 
+	"url_shortener/pkg/auth"
+	"url_shortener/pkg/backoff"
 	"url_shortener/pkg/config"
 	"url_shortener/pkg/db"
+	"url_shortener/pkg/frontend"
+	"url_shortener/pkg/gateway"
+	"url_shortener/pkg/geoip"
+	"url_shortener/pkg/policy"
 	"url_shortener/pkg/server"
 	"url_shortener/pkg/short"
 
@@ -19,6 +32,16 @@ import (
 	log "github.com/sirupsen/logrus"
 )
 
+const (
+	httpShutdownTime = 5 * time.Second
+	// time to flush counted clicks on shutdown
+	clickFlushTime = 5 * time.Second
+
+	reflectionMethodPrefix = "/grpc.reflection.v1alpha.ServerReflection/"
+	applyPolicyMethod      = "/grpc.URLShortener/ApplyPolicy"
+	listLinksMethod        = "/grpc.URLShortener/ListLinks"
+)
+
 type Daemon struct {
 	cfg config.Config
 
@@ -28,37 +51,189 @@ type Daemon struct {
 	db         db.ShortenerDB
 	grpcServer *grpc.Server
 	urlServer  *server.Server
+	health     *health.Server
+	authn      *auth.Authenticator
+	// destination URLs policy, nil if disabled
+	policy *policy.Policy
+	// country lookup of clients, nil if disabled
+	geoip *geoip.DB
+
+	// REST/JSON API server, nil if disabled
+	httpServer *http.Server
 }
 
-func New(ctx context.Context, cfg config.Config) (*Daemon, error) {
+func New(ctx context.Context, cfg config.Config) (_ *Daemon, err error) {
 	d := &Daemon{cfg: cfg}
-	var err error
 
 	if ctx != nil {
 		d.ctx, d.cancel = context.WithCancel(ctx)
 	} else {
 		d.ctx, d.cancel = context.WithCancel(context.Background())
 	}
+	// resources opened before failure are released
+	defer func() {
+		if err != nil {
+			d.release()
+		}
+	}()
 
-	d.db, err = db.New(ctx, cfg.DB)
-	if err != nil {
-		log.Fatalf("failed to connect to database: %v", err)
+	d.health = health.NewServer()
+
+	if cfg.DB.BackgroundConnect {
+		// not serving until database is connected
+		d.health.SetServingStatus("", healthpb.HealthCheckResponse_NOT_SERVING)
+
+		pending := db.NewPending()
+		go d.connectBackground(pending)
+		d.db = pending
+	} else {
+		d.db, err = d.connect(d.ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to connect to database: %w", err)
+		}
 	}
 
-	d.grpcServer = grpc.NewServer()
+	d.authn = auth.New(cfg.Server.Auth)
+	d.authn.RequireAdmin(applyPolicyMethod)
+	d.authn.RequireAdmin(listLinksMethod)
+	d.grpcServer = grpc.NewServer(
+		grpc.ChainUnaryInterceptor(d.authn.UnaryInterceptor()),
+		grpc.ChainStreamInterceptor(d.authn.StreamInterceptor()),
+	)
+
+	opts := []server.Option{
+		server.WithDegradedMode(cfg.DB.Resilience.DegradedMode),
+		server.WithPublicURL(cfg.Server.PublicBaseURL()),
+		server.WithInterstitial(cfg.Server.Interstitial),
+		server.WithChains(cfg.Server.Chains, cfg.Server.PublicURL),
+	}
+	if cfg.Server.Policy.Enabled {
+		d.policy, err = policy.New(cfg.Server.Policy)
+		if err != nil {
+			return nil, fmt.Errorf("cannot load policy: %w", err)
+		}
+		opts = append(opts, server.WithPolicy(d.policy))
+	}
 
-	d.urlServer, err = server.New(cfg.Server.LRUSize, d.db, short.New())
+	if cfg.Server.GeoIP.Enabled {
+		d.geoip, err = geoip.Open(cfg.Server.GeoIP.Database)
+		if err != nil {
+			return nil, fmt.Errorf("cannot load GeoIP database: %w", err)
+		}
+		opts = append(opts, server.WithGeoIP(d.geoip))
+	}
+
+	d.urlServer, err = server.New(cfg.Server.LRUSize, d.db, short.New(), opts...)
 	if err != nil {
-		log.Fatalf("cannot create URL server: %v", err)
+		return nil, fmt.Errorf("cannot create URL server: %w", err)
+	}
+
+	pb.RegisterURLShortenerServer(d.grpcServer, d.urlServer)
+	healthpb.RegisterHealthServer(d.grpcServer, d.health)
+
+	// reflection describes services registered on server at call time
+	if cfg.Server.Reflection {
+		d.authn.RequireAdmin(reflectionMethodPrefix)
+		reflection.Register(d.grpcServer)
+	}
+
+	if cfg.Server.HTTPPort != 0 {
+		handler, err := d.httpHandler()
+		if err != nil {
+			return nil, err
+		}
+		d.httpServer = &http.Server{Addr: cfg.Server.HTTPAddress(), Handler: handler}
 	}
 
 	return d, nil
 }
 
+// release cancels context and closes databases opened by failed New
+func (d *Daemon) release() {
+	d.cancel()
+	if d.db != nil {
+		_ = d.db.Close()
+	}
+	if d.geoip != nil {
+		_ = d.geoip.Close()
+	}
+}
+
+// httpHandler creates public frontend and REST gateway handler with optional gRPC-Web and CORS
+func (d *Daemon) httpHandler() (http.Handler, error) {
+	gw, err := gateway.New(d.ctx, d.cfg.Server.DialAddress(), grpc.WithInsecure())
+	if err != nil {
+		return nil, fmt.Errorf("cannot create REST gateway: %w", err)
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/", frontend.New(d.urlServer, frontend.WithTrustForwardedFor(d.cfg.Server.TrustForwardedFor)))
+	mux.Handle("/v1/", gw)
+	mux.Handle(gateway.OpenAPIPath, gw)
+	if d.cfg.Server.Reflection {
+		mux.Handle(gateway.DescriptorSetPath, gateway.DescriptorSet(d.grpcServer, d.authn))
+	}
+
+	var handler http.Handler = mux
+	if d.cfg.Server.GRPCWeb {
+		handler = gateway.WithGRPCWeb(d.cfg.Server.CORS, d.grpcServer, handler)
+	}
+	if len(d.cfg.Server.CORS.AllowedOrigins) != 0 {
+		handler = gateway.WithCORS(d.cfg.Server.CORS, handler)
+	}
+	return handler, nil
+}
+
+// connect connects to database and wraps it with configured resilience
+func (d *Daemon) connect(ctx context.Context) (db.ShortenerDB, error) {
+	sdb, err := db.New(ctx, d.cfg.DB)
+	if err != nil {
+		return nil, err
+	}
+	if d.cfg.DB.Resilience.Enabled {
+		sdb = db.NewResilient(sdb, d.cfg.DB.Resilience)
+	}
+	return sdb, nil
+}
+
+// connectBackground reconnects to database until success or daemon context is done
+func (d *Daemon) connectBackground(pending *db.PendingDB) {
+	for {
+		sdb, err := d.connect(d.ctx)
+		if err == nil {
+			pending.Set(sdb)
+			d.health.SetServingStatus("", healthpb.HealthCheckResponse_SERVING)
+			log.Print("daemon is ready")
+			return
+		}
+		log.Errorf("background database connection failed: %v", err)
+
+		if backoff.Sleep(d.ctx, time.Duration(d.cfg.DB.ConnTryTime)*time.Second) != nil {
+			return
+		}
+	}
+}
+
 func (d *Daemon) Run() error {
 	log.Print("daemon started")
 
-	serverErrC := make(chan error, 1)
+	serverErrC := make(chan error, 2)
+
+	go d.urlServer.RunClickFlush(d.ctx, time.Duration(d.cfg.Server.ClickFlushTime)*time.Second)
+	if d.policy != nil {
+		go func() {
+			if err := d.policy.Watch(d.ctx); err != nil {
+				log.Errorf("policy rules won't be reloaded: %v", err)
+			}
+		}()
+	}
+	if d.geoip != nil {
+		go func() {
+			if err := d.geoip.Watch(d.ctx); err != nil {
+				log.Errorf("GeoIP database won't be reloaded: %v", err)
+			}
+		}()
+	}
 
 	go func() {
 		lis, err := net.Listen("tcp", d.cfg.Server.HostAddress())
@@ -69,11 +244,19 @@ func (d *Daemon) Run() error {
 
 		log.Printf("listening %s", d.cfg.Server.HostAddress())
 
-		pb.RegisterURLShortenerServer(d.grpcServer, d.urlServer)
-
 		serverErrC <- d.grpcServer.Serve(lis)
 	}()
 
+	if d.httpServer != nil {
+		go func() {
+			log.Printf("listening HTTP %s", d.httpServer.Addr)
+
+			if err := d.httpServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				serverErrC <- err
+			}
+		}()
+	}
+
 	go func() {
 		stop := make(chan os.Signal, 1)
 		signal.Notify(stop, syscall.SIGINT, syscall.SIGTERM)
@@ -101,11 +284,32 @@ func (d *Daemon) Run() error {
 func (d *Daemon) ShutDown() {
 	defer d.cancel()
 
+	d.health.Shutdown()
+
+	// gateway proxies requests to gRPC server, so it's stopped first
+	if d.httpServer != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), httpShutdownTime)
+		if err := d.httpServer.Shutdown(ctx); err != nil {
+			log.Printf("HTTP server shutdown error: %v", err)
+		}
+		cancel()
+	}
+
 	d.grpcServer.GracefulStop()
 
+	// no clicks are counted after servers are stopped
+	ctx, cancel := context.WithTimeout(context.Background(), clickFlushTime)
+	d.urlServer.FlushClicks(ctx)
+	cancel()
+
 	if err := d.db.Close(); err != nil {
 		log.Printf("db closing error: %v", err)
 	}
+	if d.geoip != nil {
+		if err := d.geoip.Close(); err != nil {
+			log.Printf("GeoIP database closing error: %v", err)
+		}
+	}
 
 	log.Print("daemon is shut down")
 }
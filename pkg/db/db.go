@@ -6,9 +6,7 @@ import (
 	"fmt"
 	"time"
 
-	"database/sql"
-	_ "github.com/jackc/pgx/v4/stdlib"
-
+	"url_shortener/pkg/backoff"
 	"url_shortener/pkg/config"
 
 	log "github.com/sirupsen/logrus"
@@ -16,18 +14,101 @@ import (
 
 // ShortenerDB database interface for URL shortener service
 type ShortenerDB interface {
-	Add(ctx context.Context, row Row) error
+	// Add inserts row if its original URL doesn't exist and returns stored row,
+	// existing row of original URL is returned with its settings
+	Add(ctx context.Context, row Row) (Row, error)
 	GetOriginalURL(ctx context.Context, shortURL string) (string, error)
+	GetShortURL(ctx context.Context, originalURL string) (string, error)
+	// GetRow returns row by short URL
+	GetRow(ctx context.Context, shortURL string) (Row, error)
+	// AddClicks adds n clicks to short URL clicks count
+	AddClicks(ctx context.Context, shortURL string, n int64) error
+	// AddVariantClicks adds n clicks to clicks count of short URL variant at position starting from 0
+	AddVariantClicks(ctx context.Context, shortURL string, variant int, n int64) error
+	// ListRows returns up to limit rows ordered by short URL after given short URL
+	ListRows(ctx context.Context, after string, limit int) ([]Row, error)
+	// DisableRow disables short URL with given reason
+	DisableRow(ctx context.Context, shortURL, reason string) error
+	// FindRows returns page of rows matching filter
+	FindRows(ctx context.Context, f Filter) ([]Row, error)
+	// UpdateMetadata sets given fields of metadata and returns updated metadata
+	UpdateMetadata(ctx context.Context, shortURL string, m Metadata, fields []string) (Metadata, error)
+	// UseClick takes click of click limited short URL and returns clicks left,
+	// fails with ExhaustedError if no clicks are left or short URL isn't limited
+	UseClick(ctx context.Context, shortURL string) (int64, error)
 	Close() error
 }
 
 type Row struct {
 	OriginalURL string
 	ShortURL    string
+	// show confirmation page before redirect
+	Interstitial bool
+	// name of identity created link, empty for anonymous
+	Owner    string
+	Metadata Metadata
+	// one of Source constants, empty for links created before sources were stored
+	Source string
+	// bcrypt hash of password required to resolve link, empty if not protected
+	PasswordHash string
+	// resolutions count after which link stops working, 0 if not limited
+	MaxClicks int64
+	// link is active in [NotBefore, NotAfter), zero times don't limit
+	NotBefore time.Time
+	NotAfter  time.Time
+	// destination of inactive link, inactive links fail if empty
+	FallbackURL string
+	// conditional destinations of active link, original URL is used if none matches
+	Rules Rules
+	// destinations by client country of active link used if no rule matches
+	CountryURLs CountryURLs
+	// weighted split of visits otherwise redirected to original URL
+	Variants Variants
+
+	// set by database
+	CreatedAt time.Time
+	// time of last metadata or state change
+	UpdatedAt time.Time
+	Clicks    int64
+	// resolutions left of click limited link
+	ClicksLeft int64
+	// disabled links aren't served
+	Disabled       bool
+	DisabledReason string
+}
+
+// sources of links
+const (
+	SourceAPI    = "api"
+	SourceCLI    = "cli"
+	SourceImport = "import"
+)
+
+// ConnectError database connection failure after all tries
+type ConnectError struct {
+	Addr     string
+	Attempts int
+	Elapsed  time.Duration
+	Err      error
+}
+
+func (e *ConnectError) Error() string {
+	return fmt.Sprintf("cannot connect to database %s (%d tries in %v): %v", e.Addr, e.Attempts, e.Elapsed.Round(time.Millisecond), e.Err)
+}
+
+func (e *ConnectError) Unwrap() error {
+	return e.Err
 }
 
 type NoRowError struct{}
 
+// ExhaustedError click limited short URL has no clicks left
+type ExhaustedError struct{}
+
+func (e *ExhaustedError) Error() string {
+	return "no clicks left"
+}
+
 func (e *NoRowError) Error() string {
 	return "row doesn't exist"
 }
@@ -35,92 +116,322 @@ func (e *NoRowError) Error() string {
 type DB struct {
 	cfg config.DBConfig
 
-	db *sql.DB
+	// primary database, handles all writes
+	db executor
+
+	// read replicas, nil if not configured
+	replicas *replicaSet
+	// recently written short URLs, nil if read-your-writes disabled
+	recent *recentWrites
+
+	cancel context.CancelFunc
 }
 
 func New(ctx context.Context, cfg config.DBConfig) (ShortenerDB, error) {
 	sdb := &DB{cfg: cfg}
 	var err error
 
-	sdb.db, err = sql.Open("pgx", cfg.ConnectURL())
+	sdb.db, err = openExecutor(cfg.Driver, cfg.ConnectURL(), cfg.MaxOpenConns, cfg.MaxIdleConns)
 	if err != nil {
 		return nil, fmt.Errorf("db: cannot open database: %w", err)
 	}
 
-	var connErr error
-	for i := 1; i <= cfg.ConnTriesCnt; i++ {
-		log.Printf("trying to connect to database #%d", i)
-		if connErr = sdb.db.PingContext(ctx); connErr != nil {
-			<-time.After(time.Duration(cfg.ConnTryTime) * time.Second)
-		} else {
-			log.Print("database connection established")
-			break
+	if err = connect(ctx, sdb.db, cfg); err != nil {
+		_ = sdb.db.close()
+		return nil, fmt.Errorf("db: %w", err)
+	}
+
+	if len(cfg.Replicas) != 0 {
+		if err = sdb.openReplicas(ctx); err != nil {
+			_ = sdb.db.close()
+			return nil, err
 		}
 	}
-	if connErr != nil {
-		return nil, fmt.Errorf("db: cannot connect to database (%d tries by %d seconds): %w", cfg.ConnTriesCnt, cfg.ConnTryTime, err)
+
+	return sdb, nil
+}
+
+// connect pings database until success with configured backoff between tries,
+// fails after configured tries count or when context is done
+func connect(ctx context.Context, e executor, cfg config.DBConfig) error {
+	b := backoff.Backoff{
+		Initial:    time.Duration(cfg.ConnTryTime) * time.Second,
+		Max:        time.Duration(cfg.ConnMaxTryTime) * time.Second,
+		Multiplier: cfg.ConnBackoffMultiplier,
+		Jitter:     cfg.ConnBackoffJitter,
+	}
+	// fixed delay if backoff isn't configured
+	if b.Max < b.Initial {
+		b.Max = b.Initial
 	}
 
-	sdb.db.SetMaxOpenConns(cfg.MaxOpenConns)
-	sdb.db.SetMaxIdleConns(cfg.MaxIdleConns)
+	start := time.Now()
+	connectErr := func(attempts int, err error) *ConnectError {
+		return &ConnectError{Addr: cfg.HostAddress(), Attempts: attempts, Elapsed: time.Since(start), Err: err}
+	}
 
-	return sdb, nil
+	for i := 1; cfg.ConnTriesCnt <= 0 || i <= cfg.ConnTriesCnt; i++ {
+		log.Printf("trying to connect to database #%d", i)
+
+		err := e.ping(ctx)
+		if err == nil {
+			log.Print("database connection established")
+			return nil
+		}
+		if ctx.Err() != nil {
+			return connectErr(i, fmt.Errorf("%w, last error: %v", ctx.Err(), err))
+		}
+		if i == cfg.ConnTriesCnt {
+			return connectErr(i, err)
+		}
+
+		delay := b.Delay(i - 1)
+		log.Printf("database connection failed, next try in %v: %v", delay, err)
+		if sleepErr := backoff.Sleep(ctx, delay); sleepErr != nil {
+			return connectErr(i, fmt.Errorf("%w, last error: %v", sleepErr, err))
+		}
+	}
+	return nil
 }
 
-func (d *DB) Add(ctx context.Context, row Row) error {
-	if err := d.add(ctx, row); err != nil {
-		return fmt.Errorf("db: cannot add row: original_url=%s, short_url=%s: %w", row.OriginalURL, row.ShortURL, err)
+// openReplicas opens read replicas and starts their health checks,
+// unavailable replica doesn't fail opening and will be used after recovery
+func (d *DB) openReplicas(ctx context.Context) error {
+	d.replicas = &replicaSet{}
+	for _, rc := range d.cfg.Replicas {
+		rdb, err := openExecutor(d.cfg.Driver, d.cfg.ReplicaConnectURL(rc), d.cfg.MaxOpenConns, d.cfg.MaxIdleConns)
+		if err != nil {
+			_ = d.replicas.Close()
+			return fmt.Errorf("db: cannot open replica %s: %w", rc.HostAddress(), err)
+		}
+
+		d.replicas.replicas = append(d.replicas.replicas, &replica{addr: rc.HostAddress(), db: rdb})
 	}
+
+	checkTime := time.Duration(d.cfg.ReplicaCheckTime) * time.Second
+	if checkTime <= 0 {
+		checkTime = defaultReplicaCheckTime
+	}
+	d.replicas.check(ctx, checkTime)
+
+	if d.cfg.ReadYourWritesTime > 0 {
+		d.recent = newRecentWrites(time.Duration(d.cfg.ReadYourWritesTime) * time.Second)
+	}
+
+	var checkCtx context.Context
+	checkCtx, d.cancel = context.WithCancel(context.Background())
+	go d.replicas.run(checkCtx, checkTime)
+
+	log.Printf("database replicas opened: %d", len(d.cfg.Replicas))
+
 	return nil
 }
 
-func (d *DB) add(ctx context.Context, row Row) error {
-	tx, err := d.db.BeginTx(ctx, nil)
+func (d *DB) Add(ctx context.Context, row Row) (Row, error) {
+	stored, err := d.add(ctx, row)
 	if err != nil {
-		return fmt.Errorf("cannot create transaction: %w", err)
+		return Row{}, fmt.Errorf("db: cannot add row: original_url=%s, short_url=%s: %w", row.OriginalURL, row.ShortURL, err)
 	}
-	defer func() { _ = tx.Rollback() }()
+	return stored, nil
+}
 
-	_, err = tx.ExecContext(
-		ctx,
-		"INSERT INTO url_db(original_url, short_url) VALUES ($1, $2) ON CONFLICT (original_url) DO NOTHING;",
-		row.OriginalURL,
-		row.ShortURL,
-	)
+func (d *DB) add(ctx context.Context, row Row) (Row, error) {
+	// statement returns row stored for original URL, concurrent insert of
+	// the same original URL isn't visible to statement snapshot, so it's repeated once
+	var stored Row
+	var err error
+	for i := 0; i < 2; i++ {
+		err = d.db.queryRow(ctx, queryAdd, row.OriginalURL, row.ShortURL, row.Interstitial, row.Owner, originalHost(row.OriginalURL), row.Metadata, row.Source, row.PasswordHash, row.MaxClicks,
+			nullableTime(row.NotBefore), nullableTime(row.NotAfter), row.FallbackURL, row.Rules, row.CountryURLs, row.Variants).Scan(stored.columns()...)
+		if !errors.Is(err, &NoRowError{}) {
+			break
+		}
+	}
 	if err != nil {
-		return fmt.Errorf("cannot exec query: %w", err)
+		return Row{}, fmt.Errorf("cannot exec query: %w", err)
 	}
 
-	if err = tx.Commit(); err != nil {
-		return fmt.Errorf("cannot commit transaction: %w", err)
+	if d.recent != nil {
+		d.recent.add(stored.ShortURL)
+		d.recent.add(stored.OriginalURL)
 	}
 
-	return nil
+	return stored, nil
 }
 
 func (d *DB) GetOriginalURL(ctx context.Context, shortURL string) (string, error) {
-	originalURL, err := d.getOriginalURL(ctx, shortURL)
+	var originalURL string
+	err := d.read(ctx, shortURL, func(e executor) error {
+		return scanRow(e.queryRow(ctx, queryGetOriginalURL, shortURL), &originalURL)
+	})
 	if err != nil {
 		return "", fmt.Errorf("db: cannot get original_url by short_url=%s: %w", shortURL, err)
 	}
 	return originalURL, nil
 }
 
-func (d *DB) getOriginalURL(ctx context.Context, shortURL string) (original string, err error) {
-	row := d.db.QueryRowContext(
-		ctx,
-		"SELECT original_url FROM url_db WHERE short_url = $1",
-		shortURL,
-	)
-	if err = row.Scan(&original); err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			return "", &NoRowError{}
+func (d *DB) GetShortURL(ctx context.Context, originalURL string) (string, error) {
+	var shortURL string
+	err := d.read(ctx, originalURL, func(e executor) error {
+		return scanRow(e.queryRow(ctx, queryGetShortURL, originalURL), &shortURL)
+	})
+	if err != nil {
+		return "", fmt.Errorf("db: cannot get short_url by original_url=%s: %w", originalURL, err)
+	}
+	return shortURL, nil
+}
+
+func (d *DB) GetRow(ctx context.Context, shortURL string) (Row, error) {
+	var row Row
+	err := d.read(ctx, shortURL, func(e executor) error {
+		return scanRow(e.queryRow(ctx, queryGetRow, shortURL), row.columns()...)
+	})
+	if err != nil {
+		return Row{}, fmt.Errorf("db: cannot get row by short_url=%s: %w", shortURL, err)
+	}
+	return row, nil
+}
+
+// columns returns destinations of rowColumns
+func (r *Row) columns() []interface{} {
+	return []interface{}{
+		&r.OriginalURL, &r.ShortURL, &r.Interstitial, &r.Owner, &r.Metadata, &r.CreatedAt, &r.UpdatedAt, &r.Source,
+		&r.Clicks, &r.Disabled, &r.DisabledReason, &r.PasswordHash, &r.MaxClicks, &r.ClicksLeft,
+		nullTime{&r.NotBefore}, nullTime{&r.NotAfter}, &r.FallbackURL, &r.Rules, &r.CountryURLs, &r.Variants,
+	}
+}
+
+// nullTime scans nullable timestamp, NULL is zero time
+type nullTime struct {
+	t *time.Time
+}
+
+func (n nullTime) Scan(src interface{}) error {
+	switch src := src.(type) {
+	case nil:
+		*n.t = time.Time{}
+	case time.Time:
+		*n.t = src
+	default:
+		return fmt.Errorf("cannot scan %T into time", src)
+	}
+	return nil
+}
+
+// nullableTime returns time parameter, zero time is NULL
+func nullableTime(t time.Time) interface{} {
+	if t.IsZero() {
+		return nil
+	}
+	return t
+}
+
+func (d *DB) AddClicks(ctx context.Context, shortURL string, n int64) error {
+	if err := d.db.exec(ctx, queryAddClicks, shortURL, n); err != nil {
+		return fmt.Errorf("db: cannot add clicks to short_url=%s: %w", shortURL, err)
+	}
+	return nil
+}
+
+func (d *DB) AddVariantClicks(ctx context.Context, shortURL string, variant int, n int64) error {
+	if err := d.db.exec(ctx, queryAddVariantClicks, shortURL, variant, n); err != nil {
+		return fmt.Errorf("db: cannot add clicks to variant %d of short_url=%s: %w", variant, shortURL, err)
+	}
+	return nil
+}
+
+func (d *DB) UseClick(ctx context.Context, shortURL string) (int64, error) {
+	var left int64
+	err := scanRow(d.db.queryRow(ctx, queryUseClick, shortURL), &left)
+	if errors.Is(err, &NoRowError{}) {
+		err = &ExhaustedError{}
+	}
+	if err != nil {
+		return 0, fmt.Errorf("db: cannot use click of short_url=%s: %w", shortURL, err)
+	}
+	if d.recent != nil {
+		d.recent.add(shortURL)
+	}
+	return left, nil
+}
+
+func (d *DB) ListRows(ctx context.Context, after string, limit int) ([]Row, error) {
+	list, err := d.queryRows(ctx, queryListRows, after, limit)
+	if err != nil {
+		return nil, fmt.Errorf("db: cannot list rows: %w", err)
+	}
+	return list, nil
+}
+
+// queryRows runs query selecting rowColumns and scans all rows
+func (d *DB) queryRows(ctx context.Context, q query, args ...interface{}) ([]Row, error) {
+	r, err := d.db.query(ctx, q, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	var list []Row
+	for r.Next() {
+		row := Row{}
+		if err := r.Scan(row.columns()...); err != nil {
+			return nil, fmt.Errorf("cannot scan row: %w", err)
 		}
-		return "", fmt.Errorf("cannot scan row: %w", err)
+		list = append(list, row)
+	}
+	if err := r.Err(); err != nil {
+		return nil, err
 	}
-	return
+	return list, nil
+}
+
+func (d *DB) DisableRow(ctx context.Context, shortURL, reason string) error {
+	if err := d.db.exec(ctx, queryDisableRow, shortURL, reason); err != nil {
+		return fmt.Errorf("db: cannot disable short_url=%s: %w", shortURL, err)
+	}
+	return nil
+}
+
+// read runs fn on healthy replicas falling back to primary on their failure,
+// recently written keys and reads of WithPrimary context are read from primary,
+// missing rows are checked on primary as replica can lag behind writes of other instances
+func (d *DB) read(ctx context.Context, key string, fn func(e executor) error) error {
+	if d.replicas != nil && !fromPrimary(ctx) && (d.recent == nil || !d.recent.contains(key)) {
+		for _, r := range d.replicas.healthy() {
+			err := fn(r.db)
+			if errors.Is(err, &NoRowError{}) {
+				log.Debugf("db: no row on replica %s, reading primary", r.addr)
+				break
+			}
+			if err == nil || ctx.Err() != nil {
+				return err
+			}
+			log.Warnf("db: replica %s read failed, trying next: %v", r.addr, err)
+			r.setHealthy(false)
+		}
+	}
+	return fn(d.db)
+}
+
+// scanRow scans row keeping NoRowError unwrapped
+func scanRow(row scanner, dest ...interface{}) error {
+	if err := row.Scan(dest...); err != nil {
+		if errors.Is(err, &NoRowError{}) {
+			return err
+		}
+		return fmt.Errorf("cannot scan row: %w", err)
+	}
+	return nil
 }
 
 func (d *DB) Close() error {
-	return d.db.Close()
+	if d.cancel != nil {
+		d.cancel()
+	}
+	if d.replicas != nil {
+		if err := d.replicas.Close(); err != nil {
+			log.Printf("db: replicas closing error: %v", err)
+		}
+	}
+	return d.db.close()
 }
@@ -2,9 +2,19 @@ package db
 
 import (
 	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
 	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jackc/pgconn"
 	"github.com/stretchr/testify/assert"
+	"os"
+	"regexp"
+	"strconv"
 	"testing"
+	"time"
+	"url_shortener/pkg/config"
 	"url_shortener/pkg/short"
 )
 
@@ -18,12 +28,10 @@ func TestDB_Insert(t *testing.T) {
 	originalURL := "original"
 	shortURL := _sh.Short(originalURL)
 
-	mock.ExpectBegin()
 	mock.
-		ExpectExec("INSERT INTO url_db").
-		WithArgs(originalURL, shortURL).
-		WillReturnResult(sqlmock.NewResult(0, 1))
-	mock.ExpectCommit()
+		ExpectQuery("INSERT INTO url_db").
+		WithArgs(originalURL, shortURL, false, "", "original", "{}", "", "", 0, nil, nil, "", "[]", "{}", "[]").
+		WillReturnRows(storedRows(originalURL, shortURL))
 
 	rows := sqlmock.NewRows([]string{"original_url"}).AddRow(originalURL)
 	mock.
@@ -31,10 +39,11 @@ func TestDB_Insert(t *testing.T) {
 		WithArgs(shortURL).
 		WillReturnRows(rows)
 
-	db := DB{db: _db}
+	db := DB{db: &sqlExecutor{db: _db}}
 
-	err = db.Add(context.Background(), Row{OriginalURL: originalURL, ShortURL: shortURL})
+	stored, err := db.Add(context.Background(), Row{OriginalURL: originalURL, ShortURL: shortURL})
 	assert.Nil(t, err)
+	assert.Equal(t, Row{OriginalURL: originalURL, ShortURL: shortURL, CreatedAt: storedAt, UpdatedAt: storedAt}, stored)
 
 	_, err = db.GetOriginalURL(context.Background(), shortURL)
 	assert.Nil(t, err)
@@ -43,6 +52,226 @@ func TestDB_Insert(t *testing.T) {
 	assert.Nil(t, err)
 }
 
+// storedAt creation time of rows returned by storedRows
+var storedAt = time.Date(2021, 8, 30, 10, 0, 0, 0, time.UTC)
+
+// storedRows returns result of row with default settings
+func storedRows(originalURL, shortURL string) *sqlmock.Rows {
+	return sqlmock.NewRows(rowColumnNames).
+		AddRow(originalURL, shortURL, false, "", []byte(`{}`), storedAt, storedAt, "", 0, false, "", "", 0, 0, nil, nil, "", []byte(`[]`), []byte(`{}`), []byte(`[]`))
+}
+
+var rowColumnNames = []string{"original_url", "short_url", "interstitial", "owner", "metadata", "created_at", "updated_at", "source", "clicks", "disabled", "disabled_reason", "password_hash", "max_clicks", "clicks_left", "not_before", "not_after", "fallback_url", "rules", "country_urls", "variants"}
+
+func TestDB_GetRowAddClicks(t *testing.T) {
+	_db, mock, err := sqlmock.New()
+	assert.Nil(t, err)
+	defer func() { _ = _db.Close() }()
+
+	createdAt := time.Date(2021, 8, 30, 10, 0, 0, 0, time.UTC)
+	updatedAt := createdAt.Add(time.Hour)
+	mock.
+		ExpectQuery("SELECT " + rowColumns + " FROM url_db WHERE").
+		WithArgs("short").
+		WillReturnRows(sqlmock.NewRows(rowColumnNames).
+			AddRow("original", "short", true, "", []byte(`{}`), createdAt, updatedAt, SourceCLI, 5, false, "", "", 0, 0, nil, updatedAt, "fallback", []byte(`[{"device":"ios","destination_url":"app"}]`), []byte(`{"DE":"de"}`), []byte(`[{"destination_url":"a","weight":70,"clicks":2},{"destination_url":"b","weight":30}]`)))
+	mock.
+		ExpectQuery("SELECT " + rowColumns + " FROM url_db WHERE").
+		WithArgs("not exist").
+		WillReturnRows(sqlmock.NewRows(rowColumnNames))
+	mock.
+		ExpectExec("UPDATE url_db SET clicks").
+		WithArgs("short", 3).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.
+		ExpectExec("UPDATE url_db SET variants").
+		WithArgs("short", 1, 4).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	db := DB{db: &sqlExecutor{db: _db}}
+
+	row, err := db.GetRow(context.Background(), "short")
+	assert.Nil(t, err)
+	assert.Equal(t, Row{OriginalURL: "original", ShortURL: "short", Interstitial: true, Source: SourceCLI, CreatedAt: createdAt, UpdatedAt: updatedAt, Clicks: 5,
+		NotAfter: updatedAt, FallbackURL: "fallback", Rules: Rules{{Device: DeviceIOS, DestinationURL: "app"}},
+		CountryURLs: CountryURLs{"DE": "de"}, Variants: Variants{{DestinationURL: "a", Weight: 70, Clicks: 2}, {DestinationURL: "b", Weight: 30}}}, row)
+
+	_, err = db.GetRow(context.Background(), "not exist")
+	assert.True(t, errors.Is(err, &NoRowError{}))
+
+	assert.Nil(t, db.AddClicks(context.Background(), "short", 3))
+	assert.Nil(t, db.AddVariantClicks(context.Background(), "short", 1, 4))
+
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestDB_UseClick(t *testing.T) {
+	_db, mock, err := sqlmock.New()
+	assert.Nil(t, err)
+	defer func() { _ = _db.Close() }()
+
+	mock.
+		ExpectQuery("UPDATE url_db SET clicks_left = clicks_left - 1").
+		WithArgs("invite").
+		WillReturnRows(sqlmock.NewRows([]string{"clicks_left"}).AddRow(0))
+	mock.
+		ExpectQuery("UPDATE url_db SET clicks_left = clicks_left - 1").
+		WithArgs("invite").
+		WillReturnRows(sqlmock.NewRows([]string{"clicks_left"}))
+
+	db := DB{db: &sqlExecutor{db: _db}}
+
+	left, err := db.UseClick(context.Background(), "invite")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), left)
+
+	_, err = db.UseClick(context.Background(), "invite")
+	assert.True(t, errors.Is(err, &ExhaustedError{}))
+
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestDB_ListDisableRows(t *testing.T) {
+	_db, mock, err := sqlmock.New()
+	assert.Nil(t, err)
+	defer func() { _ = _db.Close() }()
+
+	createdAt := time.Date(2021, 8, 30, 10, 0, 0, 0, time.UTC)
+	mock.
+		ExpectQuery("SELECT .* FROM url_db WHERE short_url > \\$1 ORDER BY short_url LIMIT \\$2").
+		WithArgs("a", 2).
+		WillReturnRows(sqlmock.NewRows(rowColumnNames).
+			AddRow("original b", "b", false, "", []byte(`{}`), createdAt, createdAt, "", 0, false, "", "", 0, 0, nil, nil, "", []byte(`[]`), []byte(`{}`), []byte(`[]`)).
+			AddRow("original c", "c", false, "", []byte(`{}`), createdAt, createdAt, "", 1, true, "malware", "", 0, 0, nil, nil, "", []byte(`[]`), []byte(`{}`), []byte(`[]`)))
+	mock.
+		ExpectExec("UPDATE url_db SET disabled = true").
+		WithArgs("b", "phishing").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	db := DB{db: &sqlExecutor{db: _db}}
+
+	rows, err := db.ListRows(context.Background(), "a", 2)
+	assert.Nil(t, err)
+	assert.Equal(t, []Row{
+		{OriginalURL: "original b", ShortURL: "b", CreatedAt: createdAt, UpdatedAt: createdAt},
+		{OriginalURL: "original c", ShortURL: "c", CreatedAt: createdAt, UpdatedAt: createdAt, Clicks: 1, Disabled: true, DisabledReason: "malware"},
+	}, rows)
+
+	assert.Nil(t, db.DisableRow(context.Background(), "b", "phishing"))
+
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestDB_FindRows(t *testing.T) {
+	_db, mock, err := sqlmock.New()
+	assert.Nil(t, err)
+	defer func() { _ = _db.Close() }()
+
+	createdAt := time.Date(2021, 8, 30, 10, 0, 0, 0, time.UTC)
+	after := time.Date(2021, 8, 1, 0, 0, 0, 0, time.UTC)
+	mock.
+		ExpectQuery(regexp.QuoteMeta("SELECT " + rowColumns + " FROM url_db ORDER BY created_at DESC, short_url DESC LIMIT $1")).
+		WithArgs(10).
+		WillReturnRows(sqlmock.NewRows(rowColumnNames).
+			AddRow("https://example.com", "a", false, "oncall", []byte(`{}`), createdAt, createdAt, "", 0, false, "", "", 0, 0, nil, nil, "", []byte(`[]`), []byte(`{}`), []byte(`[]`)))
+	mock.
+		ExpectQuery(regexp.QuoteMeta("SELECT "+rowColumns+" FROM url_db WHERE owner = $1 AND "+
+			"(original_host = $2 OR reverse(original_host) LIKE reverse($2) || '.%') AND created_at > $3 AND "+
+			"metadata -> 'tags' @> jsonb_build_array($4::text) AND (clicks, short_url) < ($5, $6) "+
+			"ORDER BY clicks DESC, short_url DESC LIMIT $7")).
+		WithArgs("oncall", "example.com", after, "promo", int64(3), "b", 2).
+		WillReturnRows(sqlmock.NewRows(rowColumnNames))
+
+	db := DB{db: &sqlExecutor{db: _db}}
+
+	rows, err := db.FindRows(context.Background(), Filter{Limit: 10})
+	assert.Nil(t, err)
+	assert.Equal(t, []Row{{OriginalURL: "https://example.com", ShortURL: "a", Owner: "oncall", CreatedAt: createdAt, UpdatedAt: createdAt}}, rows)
+
+	rows, err = db.FindRows(context.Background(), Filter{
+		Owner:        "oncall",
+		Domain:       "example.com",
+		CreatedAfter: after,
+		Tag:          "promo",
+		Order:        OrderClicksDesc,
+		After:        &Row{ShortURL: "b", Clicks: 3},
+		Limit:        2,
+	})
+	assert.Nil(t, err)
+	assert.Empty(t, rows)
+
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestDB_Metadata(t *testing.T) {
+	_db, mock, err := sqlmock.New()
+	assert.Nil(t, err)
+	defer func() { _ = _db.Close() }()
+
+	createdAt := time.Date(2021, 8, 30, 10, 0, 0, 0, time.UTC)
+	mock.
+		ExpectQuery("SELECT " + rowColumns + " FROM url_db WHERE").
+		WithArgs("short").
+		WillReturnRows(sqlmock.NewRows(rowColumnNames).
+			AddRow("original", "short", false, "", []byte(`{"title":"Launch","tags":["promo","q3"]}`), createdAt, createdAt, "", 0, false, "", "", 0, 0, nil, nil, "", []byte(`[]`), []byte(`{}`), []byte(`[]`)))
+	mock.
+		ExpectQuery(regexp.QuoteMeta("UPDATE url_db SET metadata = metadata || $2::jsonb")).
+		WithArgs("short", `{"notes":"","tags":["promo"]}`).
+		WillReturnRows(sqlmock.NewRows([]string{"metadata"}).AddRow([]byte(`{"title":"Launch","tags":["promo"]}`)))
+	mock.
+		ExpectQuery(regexp.QuoteMeta("UPDATE url_db SET metadata = metadata || $2::jsonb")).
+		WithArgs("not exist", `{"title":""}`).
+		WillReturnRows(sqlmock.NewRows([]string{"metadata"}))
+
+	db := DB{db: &sqlExecutor{db: _db}}
+
+	row, err := db.GetRow(context.Background(), "short")
+	assert.Nil(t, err)
+	assert.Equal(t, Metadata{Title: "Launch", Tags: []string{"promo", "q3"}}, row.Metadata)
+
+	m, err := db.UpdateMetadata(context.Background(), "short", Metadata{Title: "ignored", Tags: []string{"promo"}}, []string{MetadataNotes, MetadataTags})
+	assert.Nil(t, err)
+	assert.Equal(t, Metadata{Title: "Launch", Tags: []string{"promo"}}, m)
+
+	_, err = db.UpdateMetadata(context.Background(), "not exist", Metadata{}, []string{MetadataTitle})
+	assert.True(t, errors.Is(err, &NoRowError{}))
+
+	_, err = db.UpdateMetadata(context.Background(), "short", Metadata{}, []string{"owner"})
+	assert.NotNil(t, err)
+
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestDB_InsertExisting(t *testing.T) {
+	_db, mock, err := sqlmock.New()
+	assert.Nil(t, err)
+	defer func() { _ = _db.Close() }()
+
+	mock.
+		ExpectQuery("INSERT INTO url_db").
+		WithArgs("original", "short", false, "", "original", "{}", "", "", 0, nil, nil, "", "[]", "{}", "[]").
+		WillReturnRows(sqlmock.NewRows(rowColumnNames).
+			AddRow("original", "existing", false, "", []byte(`{}`), storedAt, storedAt, "", 7, false, "", "hash", 1, 0, nil, nil, "", []byte(`[]`), []byte(`{}`), []byte(`[]`)))
+	mock.
+		ExpectQuery("SELECT short_url FROM url_db WHERE").
+		WithArgs("original").
+		WillReturnRows(sqlmock.NewRows([]string{"short_url"}).AddRow("existing"))
+
+	db := DB{db: &sqlExecutor{db: _db}}
+
+	stored, err := db.Add(context.Background(), Row{OriginalURL: "original", ShortURL: "short"})
+	assert.Nil(t, err)
+	// settings of existing row are returned
+	assert.Equal(t, Row{OriginalURL: "original", ShortURL: "existing", CreatedAt: storedAt, UpdatedAt: storedAt, Clicks: 7, PasswordHash: "hash", MaxClicks: 1}, stored)
+
+	shortURL, err := db.GetShortURL(context.Background(), "original")
+	assert.Nil(t, err)
+	assert.Equal(t, "existing", shortURL)
+
+	err = mock.ExpectationsWereMet()
+	assert.Nil(t, err)
+}
+
 func TestDB_GetOriginalURLNoShortURL(t *testing.T) {
 	_db, mock, err := sqlmock.New()
 	assert.Nil(t, err)
@@ -55,7 +284,7 @@ func TestDB_GetOriginalURLNoShortURL(t *testing.T) {
 		WithArgs(shortURL).
 		WillReturnRows(sqlmock.NewRows([]string{"original_url"}))
 
-	db := DB{db: _db}
+	db := DB{db: &sqlExecutor{db: _db}}
 
 	_, err = db.GetOriginalURL(context.Background(), shortURL)
 	assert.NotNil(t, err)
@@ -63,3 +292,455 @@ func TestDB_GetOriginalURLNoShortURL(t *testing.T) {
 	err = mock.ExpectationsWereMet()
 	assert.Nil(t, err)
 }
+
+func newReplica(t *testing.T, addr string) (*replica, sqlmock.Sqlmock) {
+	_db, mock, err := sqlmock.New()
+	assert.Nil(t, err)
+	return &replica{addr: addr, db: &sqlExecutor{db: _db}, healthy: 1}, mock
+}
+
+func TestDB_GetOriginalURLReplicas(t *testing.T) {
+	_db, primary, err := sqlmock.New()
+	assert.Nil(t, err)
+
+	r1, mock1 := newReplica(t, "r1")
+	r2, mock2 := newReplica(t, "r2")
+
+	db := DB{db: &sqlExecutor{db: _db}, replicas: &replicaSet{replicas: []*replica{r1, r2}}}
+	defer func() { _ = db.Close() }()
+
+	// round-robin
+	mock1.
+		ExpectQuery("SELECT original_url FROM url_db WHERE").
+		WithArgs("short1").
+		WillReturnRows(sqlmock.NewRows([]string{"original_url"}).AddRow("original1"))
+	mock2.
+		ExpectQuery("SELECT original_url FROM url_db WHERE").
+		WithArgs("short2").
+		WillReturnRows(sqlmock.NewRows([]string{"original_url"}).AddRow("original2"))
+
+	originalURL, err := db.GetOriginalURL(context.Background(), "short1")
+	assert.Nil(t, err)
+	assert.Equal(t, "original1", originalURL)
+
+	originalURL, err = db.GetOriginalURL(context.Background(), "short2")
+	assert.Nil(t, err)
+	assert.Equal(t, "original2", originalURL)
+
+	// failed replica is skipped and marked unhealthy
+	mock1.
+		ExpectQuery("SELECT original_url FROM url_db WHERE").
+		WithArgs("short3").
+		WillReturnError(errors.New("connection refused"))
+	mock2.
+		ExpectQuery("SELECT original_url FROM url_db WHERE").
+		WithArgs("short3").
+		WillReturnRows(sqlmock.NewRows([]string{"original_url"}).AddRow("original3"))
+
+	originalURL, err = db.GetOriginalURL(context.Background(), "short3")
+	assert.Nil(t, err)
+	assert.Equal(t, "original3", originalURL)
+	assert.False(t, r1.isHealthy())
+
+	// row missing on lagging replica is read from primary, replica stays healthy
+	mock2.
+		ExpectQuery("SELECT original_url FROM url_db WHERE").
+		WithArgs("short5").
+		WillReturnRows(sqlmock.NewRows([]string{"original_url"}))
+	primary.
+		ExpectQuery("SELECT original_url FROM url_db WHERE").
+		WithArgs("short5").
+		WillReturnRows(sqlmock.NewRows([]string{"original_url"}).AddRow("original5"))
+
+	originalURL, err = db.GetOriginalURL(context.Background(), "short5")
+	assert.Nil(t, err)
+	assert.Equal(t, "original5", originalURL)
+	assert.True(t, r2.isHealthy())
+
+	// no row on primary too
+	mock2.
+		ExpectQuery("SELECT original_url FROM url_db WHERE").
+		WithArgs("short6").
+		WillReturnRows(sqlmock.NewRows([]string{"original_url"}))
+	primary.
+		ExpectQuery("SELECT original_url FROM url_db WHERE").
+		WithArgs("short6").
+		WillReturnRows(sqlmock.NewRows([]string{"original_url"}))
+
+	_, err = db.GetOriginalURL(context.Background(), "short6")
+	assert.True(t, errors.Is(err, &NoRowError{}))
+
+	// negative lookup of write path skips replicas
+	primary.
+		ExpectQuery("SELECT original_url FROM url_db WHERE").
+		WithArgs("short7").
+		WillReturnRows(sqlmock.NewRows([]string{"original_url"}))
+
+	_, err = db.GetOriginalURL(WithPrimary(context.Background()), "short7")
+	assert.True(t, errors.Is(err, &NoRowError{}))
+	assert.True(t, r2.isHealthy())
+
+	// no healthy replicas, fallback to primary
+	r2.setHealthy(false)
+	primary.
+		ExpectQuery("SELECT original_url FROM url_db WHERE").
+		WithArgs("short4").
+		WillReturnRows(sqlmock.NewRows([]string{"original_url"}).AddRow("original4"))
+
+	originalURL, err = db.GetOriginalURL(context.Background(), "short4")
+	assert.Nil(t, err)
+	assert.Equal(t, "original4", originalURL)
+
+	assert.Nil(t, primary.ExpectationsWereMet())
+	assert.Nil(t, mock1.ExpectationsWereMet())
+	assert.Nil(t, mock2.ExpectationsWereMet())
+}
+
+func TestDB_ReadYourWrites(t *testing.T) {
+	_db, primary, err := sqlmock.New()
+	assert.Nil(t, err)
+
+	r, mock := newReplica(t, "r")
+
+	db := DB{
+		db:       &sqlExecutor{db: _db},
+		replicas: &replicaSet{replicas: []*replica{r}},
+		recent:   newRecentWrites(time.Minute),
+	}
+	defer func() { _ = db.Close() }()
+
+	primary.
+		ExpectQuery("INSERT INTO url_db").
+		WithArgs("original", "short", false, "", "original", "{}", "", "", 0, nil, nil, "", "[]", "{}", "[]").
+		WillReturnRows(storedRows("original", "short"))
+	primary.
+		ExpectQuery("SELECT original_url FROM url_db WHERE").
+		WithArgs("short").
+		WillReturnRows(sqlmock.NewRows([]string{"original_url"}).AddRow("original"))
+
+	_, err = db.Add(context.Background(), Row{OriginalURL: "original", ShortURL: "short"})
+	assert.Nil(t, err)
+
+	originalURL, err := db.GetOriginalURL(context.Background(), "short")
+	assert.Nil(t, err)
+	assert.Equal(t, "original", originalURL)
+
+	assert.Nil(t, primary.ExpectationsWereMet())
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestConnect(t *testing.T) {
+	_db, mock, err := sqlmock.New(sqlmock.MonitorPingsOption(true))
+	assert.Nil(t, err)
+	defer func() { _ = _db.Close() }()
+
+	pingErr := errors.New("connection refused")
+	mock.ExpectPing().WillReturnError(pingErr)
+	mock.ExpectPing().WillReturnError(pingErr)
+
+	cfg := config.DBConfig{Host: "host", Port: 5432, ConnTriesCnt: 2}
+
+	err = connect(context.Background(), &sqlExecutor{db: _db}, cfg)
+	connectErr := &ConnectError{}
+	assert.True(t, errors.As(err, &connectErr))
+	assert.Equal(t, 2, connectErr.Attempts)
+	assert.Equal(t, "host:5432", connectErr.Addr)
+	assert.ErrorIs(t, err, pingErr)
+
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestConnectCanceled(t *testing.T) {
+	_db, mock, err := sqlmock.New(sqlmock.MonitorPingsOption(true))
+	assert.Nil(t, err)
+	defer func() { _ = _db.Close() }()
+
+	mock.ExpectPing().WillReturnError(errors.New("connection refused"))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	// unlimited tries with long delay are interrupted by context
+	cfg := config.DBConfig{ConnTryTime: 60}
+
+	err = connect(ctx, &sqlExecutor{db: _db}, cfg)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestPendingDB(t *testing.T) {
+	pending := NewPending()
+	assert.False(t, pending.Available())
+
+	_, err := pending.GetOriginalURL(context.Background(), "short")
+	unavailableErr := &UnavailableError{}
+	assert.True(t, errors.As(err, &unavailableErr))
+
+	pending.Set(&failingDB{err: &NoRowError{}})
+	assert.True(t, pending.Available())
+
+	_, err = pending.GetOriginalURL(context.Background(), "short")
+	assert.True(t, errors.Is(err, &NoRowError{}))
+
+	assert.Nil(t, pending.Close())
+}
+
+// failingDB fails every call with err
+type failingDB struct {
+	err   error
+	calls int
+}
+
+func (d *failingDB) Add(context.Context, Row) (Row, error) {
+	d.calls++
+	return Row{}, d.err
+}
+
+func (d *failingDB) GetOriginalURL(context.Context, string) (string, error) {
+	d.calls++
+	return "", d.err
+}
+
+func (d *failingDB) GetShortURL(context.Context, string) (string, error) {
+	d.calls++
+	return "", d.err
+}
+
+func (d *failingDB) GetRow(context.Context, string) (Row, error) {
+	d.calls++
+	return Row{}, d.err
+}
+
+func (d *failingDB) AddClicks(context.Context, string, int64) error {
+	d.calls++
+	return d.err
+}
+
+func (d *failingDB) AddVariantClicks(context.Context, string, int, int64) error {
+	d.calls++
+	return d.err
+}
+
+func (d *failingDB) ListRows(context.Context, string, int) ([]Row, error) {
+	d.calls++
+	return nil, d.err
+}
+
+func (d *failingDB) DisableRow(context.Context, string, string) error {
+	d.calls++
+	return d.err
+}
+
+func (d *failingDB) FindRows(context.Context, Filter) ([]Row, error) {
+	d.calls++
+	return nil, d.err
+}
+
+func (d *failingDB) UpdateMetadata(context.Context, string, Metadata, []string) (Metadata, error) {
+	d.calls++
+	return Metadata{}, d.err
+}
+
+func (d *failingDB) UseClick(context.Context, string) (int64, error) {
+	d.calls++
+	return 0, d.err
+}
+
+func (d *failingDB) Close() error { return nil }
+
+func TestResilientDB_Retry(t *testing.T) {
+	fdb := &failingDB{err: &pgconn.PgError{Code: "57P01"}}
+	rdb := NewResilient(fdb, config.ResilienceConfig{RetryTries: 3, RetryInitialMs: 1, RetryMaxMs: 1, BreakerFailures: 10})
+
+	_, err := rdb.GetOriginalURL(context.Background(), "short")
+	unavailableErr := &UnavailableError{}
+	assert.True(t, errors.As(err, &unavailableErr))
+	assert.Equal(t, 3, fdb.calls)
+	assert.True(t, rdb.Available())
+
+	// not retryable
+	fdb.err, fdb.calls = &NoRowError{}, 0
+	_, err = rdb.GetOriginalURL(context.Background(), "short")
+	assert.True(t, errors.Is(err, &NoRowError{}))
+	assert.Equal(t, 1, fdb.calls)
+
+	// not idempotent
+	fdb.err, fdb.calls = &pgconn.PgError{Code: "57P01"}, 0
+	err = rdb.AddClicks(context.Background(), "short", 1)
+	assert.True(t, errors.As(err, &unavailableErr))
+	assert.Equal(t, 1, fdb.calls)
+}
+
+func TestResilientDB_Breaker(t *testing.T) {
+	fdb := &failingDB{err: driver.ErrBadConn}
+	rdb := NewResilient(fdb, config.ResilienceConfig{RetryTries: 1, BreakerFailures: 2, BreakerOpenTime: 1})
+
+	for i := 0; i < 2; i++ {
+		_, err := rdb.Add(context.Background(), Row{})
+		assert.NotNil(t, err)
+	}
+	assert.False(t, rdb.Available())
+
+	// fails fast
+	_, err := rdb.Add(context.Background(), Row{})
+	unavailableErr := &UnavailableError{}
+	assert.True(t, errors.As(err, &unavailableErr))
+	assert.Equal(t, 2, fdb.calls)
+
+	// probe after open time closes breaker
+	rdb.breaker.openedAt = time.Now().Add(-time.Second)
+	fdb.err = nil
+	_, err = rdb.Add(context.Background(), Row{})
+	assert.Nil(t, err)
+	assert.True(t, rdb.Available())
+}
+
+// benchDB opens database from URL_SHORTENER_BENCH_DB connect URL with given driver,
+// database must have schema from db/create-table.sql
+func benchDB(b *testing.B, driver string) *DB {
+	connectURL, ok := os.LookupEnv("URL_SHORTENER_BENCH_DB")
+	if !ok {
+		b.Skip("URL_SHORTENER_BENCH_DB is not set")
+	}
+
+	e, err := openExecutor(driver, connectURL, 16, 16)
+	if err != nil {
+		b.Fatal(err)
+	}
+	if err = e.ping(context.Background()); err != nil {
+		b.Fatal(err)
+	}
+	return &DB{db: e}
+}
+
+func benchAdd(b *testing.B, driver string) {
+	db := benchDB(b, driver)
+	defer func() { _ = db.Close() }()
+
+	_sh := short.New()
+	prefix := fmt.Sprintf("bench-%s-%d-", driver, time.Now().UnixNano())
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		originalURL := prefix + strconv.Itoa(i)
+		if _, err := db.Add(context.Background(), Row{OriginalURL: originalURL, ShortURL: _sh.Short(originalURL)}); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func benchGetOriginalURL(b *testing.B, driver string) {
+	db := benchDB(b, driver)
+	defer func() { _ = db.Close() }()
+
+	_sh := short.New()
+	originalURL := fmt.Sprintf("bench-%s-%d", driver, time.Now().UnixNano())
+	shortURL := _sh.Short(originalURL)
+	if _, err := db.Add(context.Background(), Row{OriginalURL: originalURL, ShortURL: shortURL}); err != nil {
+		b.Fatal(err)
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			if _, err := db.GetOriginalURL(context.Background(), shortURL); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func BenchmarkDB_AddSQL(b *testing.B) {
+	benchAdd(b, DriverSQL)
+}
+
+func BenchmarkDB_AddPgx(b *testing.B) {
+	benchAdd(b, DriverPgx)
+}
+
+func BenchmarkDB_GetOriginalURLSQL(b *testing.B) {
+	benchGetOriginalURL(b, DriverSQL)
+}
+
+func BenchmarkDB_GetOriginalURLPgx(b *testing.B) {
+	benchGetOriginalURL(b, DriverPgx)
+}
+
+// benchSQLDB opens database/sql pool used before executors for comparison with them
+func benchSQLDB(b *testing.B) *sql.DB {
+	connectURL, ok := os.LookupEnv("URL_SHORTENER_BENCH_DB")
+	if !ok {
+		b.Skip("URL_SHORTENER_BENCH_DB is not set")
+	}
+
+	db, err := sql.Open("pgx", connectURL)
+	if err != nil {
+		b.Fatal(err)
+	}
+	db.SetMaxOpenConns(16)
+	db.SetMaxIdleConns(16)
+	if err = db.PingContext(context.Background()); err != nil {
+		b.Fatal(err)
+	}
+	return db
+}
+
+// BenchmarkDB_AddSQLLegacy benchmarks transactional insert used before executors
+func BenchmarkDB_AddSQLLegacy(b *testing.B) {
+	db := benchSQLDB(b)
+	defer func() { _ = db.Close() }()
+
+	_sh := short.New()
+	prefix := fmt.Sprintf("bench-legacy-%d-", time.Now().UnixNano())
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		originalURL := prefix + strconv.Itoa(i)
+		tx, err := db.BeginTx(context.Background(), nil)
+		if err != nil {
+			b.Fatal(err)
+		}
+		_, err = tx.ExecContext(
+			context.Background(),
+			"INSERT INTO url_db(original_url, short_url) VALUES ($1, $2) ON CONFLICT (original_url) DO NOTHING;",
+			originalURL,
+			_sh.Short(originalURL),
+		)
+		if err != nil {
+			_ = tx.Rollback()
+			b.Fatal(err)
+		}
+		if err = tx.Commit(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkDB_GetOriginalURLSQLLegacy benchmarks select of sql.DB used before executors
+func BenchmarkDB_GetOriginalURLSQLLegacy(b *testing.B) {
+	db := benchSQLDB(b)
+	defer func() { _ = db.Close() }()
+
+	_sh := short.New()
+	originalURL := fmt.Sprintf("bench-legacy-%d", time.Now().UnixNano())
+	shortURL := _sh.Short(originalURL)
+	_, err := db.ExecContext(context.Background(), "INSERT INTO url_db(original_url, short_url) VALUES ($1, $2)", originalURL, shortURL)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			var original string
+			if err := db.QueryRowContext(context.Background(), "SELECT original_url FROM url_db WHERE short_url = $1", shortURL).Scan(&original); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
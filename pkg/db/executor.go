@@ -0,0 +1,198 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+	_ "github.com/jackc/pgx/v4/stdlib"
+)
+
+const (
+	// DriverSQL golang database/sql with pgx stdlib driver
+	DriverSQL = "sql"
+	// DriverPgx native pgx connection pool with prepared statements
+	DriverPgx = "pgx"
+)
+
+// executor runs queries on concrete database driver
+type executor interface {
+	queryRow(ctx context.Context, q query, args ...interface{}) scanner
+	query(ctx context.Context, q query, args ...interface{}) (rows, error)
+	exec(ctx context.Context, q query, args ...interface{}) error
+	ping(ctx context.Context) error
+	close() error
+}
+
+// scanner scans single row, returns NoRowError if there is no row
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// rows iterates query result rows, must be closed
+type rows interface {
+	Next() bool
+	Scan(dest ...interface{}) error
+	Err() error
+	Close()
+}
+
+// query named SQL query, pgx driver prepares it on every connection,
+// query without name is built on call and isn't prepared
+type query struct {
+	name string
+	sql  string
+}
+
+// statement returns name of prepared query or SQL of not prepared one
+func (q query) statement() string {
+	if q.name == "" {
+		return q.sql
+	}
+	return q.name
+}
+
+// openExecutor opens database with configured driver, doesn't connect to it
+func openExecutor(driver, connectURL string, maxOpenConns, maxIdleConns int) (executor, error) {
+	switch driver {
+	case "", DriverSQL:
+		return openSQLExecutor(connectURL, maxOpenConns, maxIdleConns)
+	case DriverPgx:
+		return openPoolExecutor(connectURL, maxOpenConns)
+	default:
+		return nil, fmt.Errorf("unknown driver %q", driver)
+	}
+}
+
+// sqlExecutor golang database/sql executor
+type sqlExecutor struct {
+	db *sql.DB
+}
+
+func openSQLExecutor(connectURL string, maxOpenConns, maxIdleConns int) (*sqlExecutor, error) {
+	db, err := sql.Open("pgx", connectURL)
+	if err != nil {
+		return nil, err
+	}
+	db.SetMaxOpenConns(maxOpenConns)
+	db.SetMaxIdleConns(maxIdleConns)
+	return &sqlExecutor{db: db}, nil
+}
+
+func (e *sqlExecutor) queryRow(ctx context.Context, q query, args ...interface{}) scanner {
+	return &sqlRow{row: e.db.QueryRowContext(ctx, q.sql, args...)}
+}
+
+func (e *sqlExecutor) query(ctx context.Context, q query, args ...interface{}) (rows, error) {
+	r, err := e.db.QueryContext(ctx, q.sql, args...)
+	if err != nil {
+		return nil, err
+	}
+	return &sqlRows{Rows: r}, nil
+}
+
+func (e *sqlExecutor) exec(ctx context.Context, q query, args ...interface{}) error {
+	_, err := e.db.ExecContext(ctx, q.sql, args...)
+	return err
+}
+
+func (e *sqlExecutor) ping(ctx context.Context) error {
+	return e.db.PingContext(ctx)
+}
+
+func (e *sqlExecutor) close() error {
+	return e.db.Close()
+}
+
+type sqlRow struct {
+	row *sql.Row
+}
+
+func (r *sqlRow) Scan(dest ...interface{}) error {
+	if err := r.row.Scan(dest...); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return &NoRowError{}
+		}
+		return err
+	}
+	return nil
+}
+
+type sqlRows struct {
+	*sql.Rows
+}
+
+func (r *sqlRows) Close() {
+	_ = r.Rows.Close()
+}
+
+// poolExecutor native pgx pool executor with prepared statements
+type poolExecutor struct {
+	pool *pgxpool.Pool
+}
+
+func openPoolExecutor(connectURL string, maxConns int) (*poolExecutor, error) {
+	cfg, err := pgxpool.ParseConfig(connectURL)
+	if err != nil {
+		return nil, err
+	}
+	if maxConns > 0 {
+		cfg.MaxConns = int32(maxConns)
+	}
+	// connection is checked by caller with retries
+	cfg.LazyConnect = true
+	cfg.AfterConnect = func(ctx context.Context, conn *pgx.Conn) error {
+		for _, q := range queries {
+			if _, err := conn.Prepare(ctx, q.name, q.sql); err != nil {
+				return fmt.Errorf("cannot prepare %s: %w", q.name, err)
+			}
+		}
+		return nil
+	}
+
+	pool, err := pgxpool.ConnectConfig(context.Background(), cfg)
+	if err != nil {
+		return nil, err
+	}
+	return &poolExecutor{pool: pool}, nil
+}
+
+func (e *poolExecutor) queryRow(ctx context.Context, q query, args ...interface{}) scanner {
+	// prepared statement is executed by its name
+	return &pgxRow{row: e.pool.QueryRow(ctx, q.statement(), args...)}
+}
+
+func (e *poolExecutor) query(ctx context.Context, q query, args ...interface{}) (rows, error) {
+	return e.pool.Query(ctx, q.statement(), args...)
+}
+
+func (e *poolExecutor) exec(ctx context.Context, q query, args ...interface{}) error {
+	_, err := e.pool.Exec(ctx, q.statement(), args...)
+	return err
+}
+
+func (e *poolExecutor) ping(ctx context.Context) error {
+	return e.pool.Ping(ctx)
+}
+
+func (e *poolExecutor) close() error {
+	e.pool.Close()
+	return nil
+}
+
+type pgxRow struct {
+	row pgx.Row
+}
+
+func (r *pgxRow) Scan(dest ...interface{}) error {
+	if err := r.row.Scan(dest...); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return &NoRowError{}
+		}
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,115 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"url_shortener/pkg/policy"
+)
+
+// Order order of FindRows rows, ties are ordered by short URL
+type Order int
+
+const (
+	OrderCreatedDesc Order = iota
+	OrderCreatedAsc
+	OrderClicksDesc
+	OrderShortURL
+)
+
+// Filter filters and page of FindRows, zero values don't filter
+type Filter struct {
+	Owner string
+	// normalized destination host, subdomains match too
+	Domain        string
+	CreatedAfter  time.Time
+	CreatedBefore time.Time
+	// tag of link metadata
+	Tag string
+
+	Order Order
+	// last row of previous page, nil for first page
+	After *Row
+	Limit int
+}
+
+func (d *DB) FindRows(ctx context.Context, f Filter) ([]Row, error) {
+	q, args := findRowsQuery(f)
+	list, err := d.queryRows(ctx, q, args...)
+	if err != nil {
+		return nil, fmt.Errorf("db: cannot find rows: %w", err)
+	}
+	return list, nil
+}
+
+// findRowsQuery builds keyset pagination query of filter, every condition and order
+// has index in db/create-table.sql
+func findRowsQuery(f Filter) (query, []interface{}) {
+	var conds []string
+	var args []interface{}
+	arg := func(v interface{}) string {
+		args = append(args, v)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	if f.Owner != "" {
+		conds = append(conds, "owner = "+arg(f.Owner))
+	}
+	if f.Domain != "" {
+		// reversed host prefix matches domain and its subdomains
+		domain := arg(f.Domain)
+		conds = append(conds, fmt.Sprintf("(original_host = %s OR reverse(original_host) LIKE reverse(%s) || '.%%')", domain, domain))
+	}
+	if !f.CreatedAfter.IsZero() {
+		conds = append(conds, "created_at > "+arg(f.CreatedAfter))
+	}
+	if !f.CreatedBefore.IsZero() {
+		conds = append(conds, "created_at < "+arg(f.CreatedBefore))
+	}
+	if f.Tag != "" {
+		conds = append(conds, "metadata -> 'tags' @> jsonb_build_array("+arg(f.Tag)+"::text)")
+	}
+
+	var order string
+	switch f.Order {
+	case OrderCreatedAsc:
+		order = "created_at, short_url"
+		if f.After != nil {
+			conds = append(conds, fmt.Sprintf("(created_at, short_url) > (%s, %s)", arg(f.After.CreatedAt), arg(f.After.ShortURL)))
+		}
+	case OrderClicksDesc:
+		order = "clicks DESC, short_url DESC"
+		if f.After != nil {
+			conds = append(conds, fmt.Sprintf("(clicks, short_url) < (%s, %s)", arg(f.After.Clicks), arg(f.After.ShortURL)))
+		}
+	case OrderShortURL:
+		order = "short_url"
+		if f.After != nil {
+			conds = append(conds, "short_url > "+arg(f.After.ShortURL))
+		}
+	default:
+		order = "created_at DESC, short_url DESC"
+		if f.After != nil {
+			conds = append(conds, fmt.Sprintf("(created_at, short_url) < (%s, %s)", arg(f.After.CreatedAt), arg(f.After.ShortURL)))
+		}
+	}
+
+	sql := "SELECT " + rowColumns + " FROM url_db"
+	if len(conds) != 0 {
+		sql += " WHERE " + strings.Join(conds, " AND ")
+	}
+	sql += " ORDER BY " + order + " LIMIT " + arg(f.Limit)
+
+	return query{sql: sql}, args
+}
+
+// originalHost returns normalized host of original URL stored for domain filter
+func originalHost(originalURL string) string {
+	u, err := policy.Normalize(originalURL)
+	if err != nil {
+		return ""
+	}
+	return u.Hostname()
+}
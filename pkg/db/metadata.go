@@ -0,0 +1,80 @@
+package db
+
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+)
+
+// Metadata link annotations stored in metadata jsonb column
+type Metadata struct {
+	Title string   `json:"title,omitempty"`
+	Notes string   `json:"notes,omitempty"`
+	Tags  []string `json:"tags,omitempty"`
+}
+
+// metadata fields by their jsonb keys
+const (
+	MetadataTitle = "title"
+	MetadataNotes = "notes"
+	MetadataTags  = "tags"
+)
+
+// Value encodes metadata as JSON text accepted by jsonb parameter of both drivers
+func (m Metadata) Value() (driver.Value, error) {
+	data, err := json.Marshal(m)
+	if err != nil {
+		return nil, err
+	}
+	return string(data), nil
+}
+
+// Scan decodes jsonb column
+func (m *Metadata) Scan(src interface{}) error {
+	*m = Metadata{}
+	switch src := src.(type) {
+	case nil:
+		return nil
+	case []byte:
+		return json.Unmarshal(src, m)
+	case string:
+		return json.Unmarshal([]byte(src), m)
+	default:
+		return fmt.Errorf("cannot scan %T into metadata", src)
+	}
+}
+
+func (d *DB) UpdateMetadata(ctx context.Context, shortURL string, m Metadata, fields []string) (Metadata, error) {
+	// only given keys are replaced, empty values clear them
+	update := map[string]interface{}{}
+	for _, field := range fields {
+		switch field {
+		case MetadataTitle:
+			update[field] = m.Title
+		case MetadataNotes:
+			update[field] = m.Notes
+		case MetadataTags:
+			tags := m.Tags
+			if tags == nil {
+				tags = []string{}
+			}
+			update[field] = tags
+		default:
+			return Metadata{}, fmt.Errorf("db: unknown metadata field `%s`", field)
+		}
+	}
+	data, err := json.Marshal(update)
+	if err != nil {
+		return Metadata{}, err
+	}
+
+	updated := Metadata{}
+	if err := scanRow(d.db.queryRow(ctx, queryUpdateMetadata, shortURL, string(data)), &updated); err != nil {
+		return Metadata{}, fmt.Errorf("db: cannot update metadata of short_url=%s: %w", shortURL, err)
+	}
+	if d.recent != nil {
+		d.recent.add(shortURL)
+	}
+	return updated, nil
+}
@@ -0,0 +1,154 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+var errNotConnected = errors.New("database isn't connected yet")
+
+// PendingDB database being connected in background,
+// calls fail with UnavailableError until connected database is set
+type PendingDB struct {
+	mu     sync.RWMutex
+	db     ShortenerDB
+	closed bool
+}
+
+func NewPending() *PendingDB {
+	return &PendingDB{}
+}
+
+// Set sets connected database, database is closed if PendingDB is already closed
+func (p *PendingDB) Set(db ShortenerDB) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.closed {
+		_ = db.Close()
+		return
+	}
+	p.db = db
+}
+
+func (p *PendingDB) get() (ShortenerDB, error) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	if p.db == nil {
+		return nil, &UnavailableError{Err: errNotConnected}
+	}
+	return p.db, nil
+}
+
+func (p *PendingDB) Add(ctx context.Context, row Row) (Row, error) {
+	db, err := p.get()
+	if err != nil {
+		return Row{}, err
+	}
+	return db.Add(ctx, row)
+}
+
+func (p *PendingDB) GetOriginalURL(ctx context.Context, shortURL string) (string, error) {
+	db, err := p.get()
+	if err != nil {
+		return "", err
+	}
+	return db.GetOriginalURL(ctx, shortURL)
+}
+
+func (p *PendingDB) GetShortURL(ctx context.Context, originalURL string) (string, error) {
+	db, err := p.get()
+	if err != nil {
+		return "", err
+	}
+	return db.GetShortURL(ctx, originalURL)
+}
+
+func (p *PendingDB) GetRow(ctx context.Context, shortURL string) (Row, error) {
+	db, err := p.get()
+	if err != nil {
+		return Row{}, err
+	}
+	return db.GetRow(ctx, shortURL)
+}
+
+func (p *PendingDB) AddClicks(ctx context.Context, shortURL string, n int64) error {
+	db, err := p.get()
+	if err != nil {
+		return err
+	}
+	return db.AddClicks(ctx, shortURL, n)
+}
+
+func (p *PendingDB) AddVariantClicks(ctx context.Context, shortURL string, variant int, n int64) error {
+	db, err := p.get()
+	if err != nil {
+		return err
+	}
+	return db.AddVariantClicks(ctx, shortURL, variant, n)
+}
+
+func (p *PendingDB) ListRows(ctx context.Context, after string, limit int) ([]Row, error) {
+	db, err := p.get()
+	if err != nil {
+		return nil, err
+	}
+	return db.ListRows(ctx, after, limit)
+}
+
+func (p *PendingDB) DisableRow(ctx context.Context, shortURL, reason string) error {
+	db, err := p.get()
+	if err != nil {
+		return err
+	}
+	return db.DisableRow(ctx, shortURL, reason)
+}
+
+func (p *PendingDB) FindRows(ctx context.Context, f Filter) ([]Row, error) {
+	db, err := p.get()
+	if err != nil {
+		return nil, err
+	}
+	return db.FindRows(ctx, f)
+}
+
+func (p *PendingDB) UpdateMetadata(ctx context.Context, shortURL string, m Metadata, fields []string) (Metadata, error) {
+	db, err := p.get()
+	if err != nil {
+		return Metadata{}, err
+	}
+	return db.UpdateMetadata(ctx, shortURL, m, fields)
+}
+
+func (p *PendingDB) UseClick(ctx context.Context, shortURL string) (int64, error) {
+	db, err := p.get()
+	if err != nil {
+		return 0, err
+	}
+	return db.UseClick(ctx, shortURL)
+}
+
+func (p *PendingDB) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.closed = true
+	if p.db == nil {
+		return nil
+	}
+	return p.db.Close()
+}
+
+// Available returns false until database is connected and while connected database is unavailable
+func (p *PendingDB) Available() bool {
+	db, err := p.get()
+	if err != nil {
+		return false
+	}
+	if a, ok := db.(interface{ Available() bool }); ok {
+		return a.Available()
+	}
+	return true
+}
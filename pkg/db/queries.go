@@ -0,0 +1,88 @@
+package db
+
+// rowColumns columns of Row scanned into Row.columns
+const rowColumns = "original_url, short_url, interstitial, owner, metadata, created_at, updated_at, source, clicks, disabled, disabled_reason, password_hash, max_clicks, clicks_left, not_before, not_after, fallback_url, rules, country_urls, variants"
+
+var (
+	// queryAdd inserts new row or selects existing row of original URL,
+	// rows inserted by statement aren't visible to its select part,
+	// so exactly one part returns row
+	queryAdd = query{
+		name: "add",
+		sql: `WITH inserted AS (
+    INSERT INTO url_db(original_url, short_url, interstitial, owner, original_host, metadata, source, password_hash, max_clicks, clicks_left, not_before, not_after, fallback_url, rules, country_urls, variants)
+    VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $9, $10, $11, $12, $13, $14, $15)
+    ON CONFLICT (original_url) DO NOTHING
+    RETURNING ` + rowColumns + `
+)
+SELECT ` + rowColumns + ` FROM inserted
+UNION ALL
+SELECT ` + rowColumns + ` FROM url_db WHERE original_url = $1
+LIMIT 1`,
+	}
+
+	queryGetOriginalURL = query{
+		name: "get_original_url",
+		sql:  "SELECT original_url FROM url_db WHERE short_url = $1",
+	}
+
+	queryGetShortURL = query{
+		name: "get_short_url",
+		sql:  "SELECT short_url FROM url_db WHERE original_url = $1",
+	}
+
+	queryGetRow = query{
+		name: "get_row",
+		sql:  "SELECT " + rowColumns + " FROM url_db WHERE short_url = $1",
+	}
+
+	// queryListRows selects page of rows ordered by short URL after given one
+	queryListRows = query{
+		name: "list_rows",
+		sql:  "SELECT " + rowColumns + " FROM url_db WHERE short_url > $1 ORDER BY short_url LIMIT $2",
+	}
+
+	queryDisableRow = query{
+		name: "disable_row",
+		sql:  "UPDATE url_db SET disabled = true, disabled_reason = $2, updated_at = now() WHERE short_url = $1",
+	}
+
+	// queryUpdateMetadata replaces top-level metadata keys present in $2
+	queryUpdateMetadata = query{
+		name: "update_metadata",
+		sql:  "UPDATE url_db SET metadata = metadata || $2::jsonb, updated_at = now() WHERE short_url = $1 RETURNING metadata",
+	}
+
+	// queryUseClick takes click of click limited row, selects no row if no clicks are left
+	queryUseClick = query{
+		name: "use_click",
+		sql:  "UPDATE url_db SET clicks_left = clicks_left - 1 WHERE short_url = $1 AND max_clicks > 0 AND clicks_left > 0 RETURNING clicks_left",
+	}
+
+	queryAddClicks = query{
+		name: "add_clicks",
+		sql:  "UPDATE url_db SET clicks = clicks + $2 WHERE short_url = $1",
+	}
+
+	// queryAddVariantClicks adds $3 clicks to clicks of variant at position $2 starting from 0
+	queryAddVariantClicks = query{
+		name: "add_variant_clicks",
+		sql: `UPDATE url_db SET variants = jsonb_set(variants, ARRAY[$2::int::text, 'clicks'],
+    to_jsonb(COALESCE((variants->$2::int->>'clicks')::bigint, 0) + $3::bigint))
+WHERE short_url = $1 AND jsonb_array_length(variants) > $2::int`,
+	}
+)
+
+// queries to prepare on every pgx connection
+var queries = []query{
+	queryAdd,
+	queryGetOriginalURL,
+	queryGetShortURL,
+	queryGetRow,
+	queryAddClicks,
+	queryListRows,
+	queryDisableRow,
+	queryUpdateMetadata,
+	queryUseClick,
+	queryAddVariantClicks,
+}
@@ -0,0 +1,162 @@
+package db
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const defaultReplicaCheckTime = 5 * time.Second
+
+type primaryKey struct{}
+
+// WithPrimary returns context of reads served by primary, used by checks of write path
+// which mostly miss: replica miss is checked on primary anyway
+func WithPrimary(ctx context.Context) context.Context {
+	return context.WithValue(ctx, primaryKey{}, true)
+}
+
+// fromPrimary checks context requires reads from primary
+func fromPrimary(ctx context.Context) bool {
+	primary, _ := ctx.Value(primaryKey{}).(bool)
+	return primary
+}
+
+// replica read-only database with health state
+type replica struct {
+	addr    string
+	db      executor
+	healthy int32
+}
+
+func (r *replica) isHealthy() bool {
+	return atomic.LoadInt32(&r.healthy) == 1
+}
+
+func (r *replica) setHealthy(healthy bool) {
+	var v int32
+	if healthy {
+		v = 1
+	}
+	if old := atomic.SwapInt32(&r.healthy, v); old != v {
+		if healthy {
+			log.Printf("db: replica %s is healthy", r.addr)
+		} else {
+			log.Warnf("db: replica %s is unhealthy", r.addr)
+		}
+	}
+}
+
+// replicaSet routes reads to healthy replicas in round-robin order
+type replicaSet struct {
+	replicas []*replica
+	next     uint32
+}
+
+// healthy returns healthy replicas starting from next in round-robin order
+func (s *replicaSet) healthy() []*replica {
+	n := len(s.replicas)
+	if n == 0 {
+		return nil
+	}
+	start := int(atomic.AddUint32(&s.next, 1)-1) % n
+
+	healthy := make([]*replica, 0, n)
+	for i := 0; i < n; i++ {
+		r := s.replicas[(start+i)%n]
+		if r.isHealthy() {
+			healthy = append(healthy, r)
+		}
+	}
+	return healthy
+}
+
+// check pings every replica and updates its health state
+func (s *replicaSet) check(ctx context.Context, timeout time.Duration) {
+	for _, r := range s.replicas {
+		pingCtx, cancel := context.WithTimeout(ctx, timeout)
+		err := r.db.ping(pingCtx)
+		cancel()
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			log.Debugf("db: replica %s ping failed: %v", r.addr, err)
+		}
+		r.setHealthy(err == nil)
+	}
+}
+
+// run checks replicas health every period until context is done
+func (s *replicaSet) run(ctx context.Context, period time.Duration) {
+	ticker := time.NewTicker(period)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.check(ctx, period)
+		}
+	}
+}
+
+func (s *replicaSet) Close() error {
+	var err error
+	for _, r := range s.replicas {
+		if closeErr := r.db.close(); closeErr != nil && err == nil {
+			err = closeErr
+		}
+	}
+	return err
+}
+
+// recentWrites remembers recently written keys to route their reads to primary
+type recentWrites struct {
+	mu sync.Mutex
+
+	ttl       time.Duration
+	keys      map[string]time.Time
+	lastSweep time.Time
+}
+
+func newRecentWrites(ttl time.Duration) *recentWrites {
+	return &recentWrites{ttl: ttl, keys: map[string]time.Time{}, lastSweep: time.Now()}
+}
+
+func (w *recentWrites) add(key string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	now := time.Now()
+	w.keys[key] = now.Add(w.ttl)
+
+	// drop expired keys not often than once per ttl
+	if now.Sub(w.lastSweep) > w.ttl {
+		for k, expires := range w.keys {
+			if now.After(expires) {
+				delete(w.keys, k)
+			}
+		}
+		w.lastSweep = now
+	}
+}
+
+func (w *recentWrites) contains(key string) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	expires, ok := w.keys[key]
+	if !ok {
+		return false
+	}
+	if time.Now().After(expires) {
+		delete(w.keys, key)
+		return false
+	}
+	return true
+}
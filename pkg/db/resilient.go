@@ -0,0 +1,326 @@
+package db
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgconn"
+
+	"url_shortener/pkg/backoff"
+	"url_shortener/pkg/config"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	defaultRetryTries      = 3
+	defaultRetryInitial    = 50 * time.Millisecond
+	defaultRetryMax        = time.Second
+	defaultBreakerFailures = 5
+	defaultBreakerOpenTime = 10 * time.Second
+)
+
+// UnavailableError database is unavailable: circuit breaker is open or retries are exhausted
+type UnavailableError struct {
+	Err error
+}
+
+func (e *UnavailableError) Error() string {
+	if e.Err == nil {
+		return "database is unavailable"
+	}
+	return fmt.Sprintf("database is unavailable: %v", e.Err)
+}
+
+func (e *UnavailableError) Unwrap() error {
+	return e.Err
+}
+
+// ResilientDB retries database calls failed with retryable errors
+// and fails fast by circuit breaker while database is down,
+// all ShortenerDB calls except AddClicks, AddVariantClicks and UseClick are idempotent, so they are safe to retry
+type ResilientDB struct {
+	db ShortenerDB
+
+	tries   int
+	backoff backoff.Backoff
+	breaker *breaker
+}
+
+func NewResilient(db ShortenerDB, cfg config.ResilienceConfig) *ResilientDB {
+	r := &ResilientDB{
+		db:    db,
+		tries: cfg.RetryTries,
+		backoff: backoff.Backoff{
+			Initial: time.Duration(cfg.RetryInitialMs) * time.Millisecond,
+			Max:     time.Duration(cfg.RetryMaxMs) * time.Millisecond,
+			Jitter:  0.5,
+		},
+		breaker: &breaker{
+			threshold: cfg.BreakerFailures,
+			openTime:  time.Duration(cfg.BreakerOpenTime) * time.Second,
+		},
+	}
+	if r.tries <= 0 {
+		r.tries = defaultRetryTries
+	}
+	if r.backoff.Initial <= 0 {
+		r.backoff.Initial = defaultRetryInitial
+	}
+	if r.backoff.Max <= 0 {
+		r.backoff.Max = defaultRetryMax
+	}
+	if r.breaker.threshold <= 0 {
+		r.breaker.threshold = defaultBreakerFailures
+	}
+	if r.breaker.openTime <= 0 {
+		r.breaker.openTime = defaultBreakerOpenTime
+	}
+	return r
+}
+
+func (r *ResilientDB) Add(ctx context.Context, row Row) (stored Row, err error) {
+	err = r.do(ctx, func() error {
+		stored, err = r.db.Add(ctx, row)
+		return err
+	})
+	return
+}
+
+func (r *ResilientDB) GetOriginalURL(ctx context.Context, shortURL string) (originalURL string, err error) {
+	err = r.do(ctx, func() error {
+		originalURL, err = r.db.GetOriginalURL(ctx, shortURL)
+		return err
+	})
+	return
+}
+
+func (r *ResilientDB) GetShortURL(ctx context.Context, originalURL string) (shortURL string, err error) {
+	err = r.do(ctx, func() error {
+		shortURL, err = r.db.GetShortURL(ctx, originalURL)
+		return err
+	})
+	return
+}
+
+func (r *ResilientDB) GetRow(ctx context.Context, shortURL string) (row Row, err error) {
+	err = r.do(ctx, func() error {
+		row, err = r.db.GetRow(ctx, shortURL)
+		return err
+	})
+	return
+}
+
+// AddClicks isn't retried: failed call can be committed, so retry could count clicks twice
+func (r *ResilientDB) AddClicks(ctx context.Context, shortURL string, n int64) error {
+	return r.try(ctx, 1, func() error {
+		return r.db.AddClicks(ctx, shortURL, n)
+	})
+}
+
+// AddVariantClicks isn't retried like AddClicks
+func (r *ResilientDB) AddVariantClicks(ctx context.Context, shortURL string, variant int, n int64) error {
+	return r.try(ctx, 1, func() error {
+		return r.db.AddVariantClicks(ctx, shortURL, variant, n)
+	})
+}
+
+// UseClick isn't retried: failed call can be committed, so retry could take clicks twice
+func (r *ResilientDB) UseClick(ctx context.Context, shortURL string) (left int64, err error) {
+	err = r.try(ctx, 1, func() error {
+		left, err = r.db.UseClick(ctx, shortURL)
+		return err
+	})
+	return
+}
+
+func (r *ResilientDB) ListRows(ctx context.Context, after string, limit int) (rows []Row, err error) {
+	err = r.do(ctx, func() error {
+		rows, err = r.db.ListRows(ctx, after, limit)
+		return err
+	})
+	return
+}
+
+func (r *ResilientDB) DisableRow(ctx context.Context, shortURL, reason string) error {
+	return r.do(ctx, func() error {
+		return r.db.DisableRow(ctx, shortURL, reason)
+	})
+}
+
+func (r *ResilientDB) FindRows(ctx context.Context, f Filter) (rows []Row, err error) {
+	err = r.do(ctx, func() error {
+		rows, err = r.db.FindRows(ctx, f)
+		return err
+	})
+	return
+}
+
+func (r *ResilientDB) UpdateMetadata(ctx context.Context, shortURL string, m Metadata, fields []string) (updated Metadata, err error) {
+	err = r.do(ctx, func() error {
+		updated, err = r.db.UpdateMetadata(ctx, shortURL, m, fields)
+		return err
+	})
+	return
+}
+
+func (r *ResilientDB) Close() error {
+	return r.db.Close()
+}
+
+// Available returns false while circuit breaker is open
+func (r *ResilientDB) Available() bool {
+	return r.breaker.available()
+}
+
+// do calls fn with retries of retryable errors
+func (r *ResilientDB) do(ctx context.Context, fn func() error) error {
+	return r.try(ctx, r.tries, fn)
+}
+
+// try calls fn up to tries times while it fails with retryable errors
+func (r *ResilientDB) try(ctx context.Context, tries int, fn func() error) error {
+	var err error
+	for i := 0; i < tries; i++ {
+		if !r.breaker.allow() {
+			return &UnavailableError{Err: err}
+		}
+
+		err = fn()
+		if err != nil && ctx.Err() != nil {
+			// caller's cancellation says nothing about database availability
+			r.breaker.release()
+			return err
+		}
+		if err == nil || !isRetryable(ctx, err) {
+			// not retryable errors aren't caused by database availability
+			r.breaker.success()
+			return err
+		}
+		r.breaker.failure()
+
+		if i+1 < tries {
+			delay := r.backoff.Delay(i)
+			log.Debugf("db: retryable error, retry in %v: %v", delay, err)
+			if sleepErr := backoff.Sleep(ctx, delay); sleepErr != nil {
+				return err
+			}
+		}
+	}
+	return &UnavailableError{Err: err}
+}
+
+// isRetryable checks error is caused by connection failure or transient database state
+func isRetryable(ctx context.Context, err error) bool {
+	if ctx.Err() != nil || errors.Is(err, &NoRowError{}) {
+		return false
+	}
+
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		switch {
+		case pgErr.Code == "40001", pgErr.Code == "40P01": // serialization failure, deadlock
+			return true
+		case len(pgErr.Code) == 5 && pgErr.Code[:2] == "08": // connection exception
+			return true
+		case pgErr.Code == "53300": // too many connections
+			return true
+		case pgErr.Code == "57P01", pgErr.Code == "57P02", pgErr.Code == "57P03": // shutdown, cannot connect now
+			return true
+		}
+		return false
+	}
+
+	// connection errors wrap net errors
+	var netErr net.Error
+	return errors.As(err, &netErr) ||
+		errors.Is(err, driver.ErrBadConn) ||
+		pgconn.SafeToRetry(err) ||
+		pgconn.Timeout(err)
+}
+
+type breakerState int
+
+const (
+	breakerClosed breakerState = iota
+	breakerOpen
+	breakerHalfOpen
+)
+
+// breaker opens after threshold consecutive failures, after openTime
+// lets single probe call through and closes on its success
+type breaker struct {
+	mu sync.Mutex
+
+	threshold int
+	openTime  time.Duration
+
+	state    breakerState
+	failures int
+	openedAt time.Time
+}
+
+func (b *breaker) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case breakerOpen:
+		if time.Since(b.openedAt) < b.openTime {
+			return false
+		}
+		log.Print("db: circuit breaker is half-open")
+		b.state = breakerHalfOpen
+		return true
+	case breakerHalfOpen:
+		// probe is in flight
+		return false
+	default:
+		return true
+	}
+}
+
+func (b *breaker) success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state != breakerClosed {
+		log.Print("db: circuit breaker is closed")
+	}
+	b.state = breakerClosed
+	b.failures = 0
+}
+
+func (b *breaker) failure() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failures++
+	if b.state == breakerHalfOpen || (b.state == breakerClosed && b.failures >= b.threshold) {
+		log.Warnf("db: circuit breaker is open after %d failures", b.failures)
+		b.state = breakerOpen
+		b.openedAt = time.Now()
+	}
+}
+
+// release returns not finished probe back to open state
+func (b *breaker) release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == breakerHalfOpen {
+		b.state = breakerOpen
+	}
+}
+
+func (b *breaker) available() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.state == breakerClosed
+}
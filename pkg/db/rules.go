@@ -0,0 +1,156 @@
+package db
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+)
+
+// Rule conditional destination of link stored in rules jsonb column, set conditions
+// must all match request for its destination to be used
+type Rule struct {
+	// one of Device constants
+	Device string `json:"device,omitempty"`
+	// language tag prefix of Accept-Language range, e.g. `de` matches `de-AT`
+	Language string `json:"language,omitempty"`
+	// UTC time of day range [TimeStart, TimeEnd) as `15:04`, end before start spans midnight
+	TimeStart string `json:"time_start,omitempty"`
+	TimeEnd   string `json:"time_end,omitempty"`
+	// query parameter of visited short URL, empty value matches any value
+	QueryParam     string `json:"query_param,omitempty"`
+	QueryValue     string `json:"query_value,omitempty"`
+	DestinationURL string `json:"destination_url"`
+}
+
+// devices of rules by User-Agent class
+const (
+	DeviceIOS     = "ios"
+	DeviceAndroid = "android"
+	// any mobile device including iOS and Android ones
+	DeviceMobile  = "mobile"
+	DeviceDesktop = "desktop"
+	DeviceBot     = "bot"
+)
+
+// Rules ordered rules of link, first matching rule is used
+type Rules []Rule
+
+// Value encodes rules as JSON array text accepted by jsonb parameter of both drivers
+func (r Rules) Value() (driver.Value, error) {
+	if r == nil {
+		return "[]", nil
+	}
+	data, err := json.Marshal(r)
+	if err != nil {
+		return nil, err
+	}
+	return string(data), nil
+}
+
+// Scan decodes jsonb column, empty array is nil rules
+func (r *Rules) Scan(src interface{}) error {
+	*r = nil
+	var data []byte
+	switch src := src.(type) {
+	case nil:
+		return nil
+	case []byte:
+		data = src
+	case string:
+		data = []byte(src)
+	default:
+		return fmt.Errorf("cannot scan %T into rules", src)
+	}
+	if err := json.Unmarshal(data, r); err != nil {
+		return err
+	}
+	if len(*r) == 0 {
+		*r = nil
+	}
+	return nil
+}
+
+// CountryURLs destinations by ISO 3166-1 alpha-2 country code stored in country_urls jsonb column
+type CountryURLs map[string]string
+
+// Value encodes country URLs as JSON object text accepted by jsonb parameter of both drivers
+func (c CountryURLs) Value() (driver.Value, error) {
+	if c == nil {
+		return "{}", nil
+	}
+	data, err := json.Marshal(c)
+	if err != nil {
+		return nil, err
+	}
+	return string(data), nil
+}
+
+// Scan decodes jsonb column, empty object is nil country URLs
+func (c *CountryURLs) Scan(src interface{}) error {
+	*c = nil
+	var data []byte
+	switch src := src.(type) {
+	case nil:
+		return nil
+	case []byte:
+		data = src
+	case string:
+		data = []byte(src)
+	default:
+		return fmt.Errorf("cannot scan %T into country URLs", src)
+	}
+	if err := json.Unmarshal(data, c); err != nil {
+		return err
+	}
+	if len(*c) == 0 {
+		*c = nil
+	}
+	return nil
+}
+
+// Variant weighted destination of A/B split link stored in variants jsonb column
+type Variant struct {
+	DestinationURL string `json:"destination_url"`
+	// share of visitors is weight divided by sum of weights of link
+	Weight int32 `json:"weight"`
+	// visits redirected to variant, updated by AddVariantClicks
+	Clicks int64 `json:"clicks"`
+}
+
+// Variants ordered variants of link, positions address clicks of variants
+type Variants []Variant
+
+// Value encodes variants as JSON array text accepted by jsonb parameter of both drivers
+func (v Variants) Value() (driver.Value, error) {
+	if v == nil {
+		return "[]", nil
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return string(data), nil
+}
+
+// Scan decodes jsonb column, empty array is nil variants
+func (v *Variants) Scan(src interface{}) error {
+	*v = nil
+	var data []byte
+	switch src := src.(type) {
+	case nil:
+		return nil
+	case []byte:
+		data = src
+	case string:
+		data = []byte(src)
+	default:
+		return fmt.Errorf("cannot scan %T into variants", src)
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return err
+	}
+	if len(*v) == 0 {
+		*v = nil
+	}
+	return nil
+}
@@ -0,0 +1,70 @@
+package filewatch
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// reloadDelay groups file events of single save
+const reloadDelay = 100 * time.Millisecond
+
+// Watch calls reload on changes of files until context is done, directories of files
+// are watched as editors and database updaters replace files instead of writing them
+func Watch(ctx context.Context, paths []string, reload func()) error {
+	files := map[string]bool{}
+	for _, path := range paths {
+		files[filepath.Clean(path)] = true
+	}
+	if len(files) == 0 {
+		return nil
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("cannot create watcher: %w", err)
+	}
+	defer func() { _ = watcher.Close() }()
+
+	dirs := map[string]bool{}
+	for path := range files {
+		dir := filepath.Dir(path)
+		if dirs[dir] {
+			continue
+		}
+		if err := watcher.Add(dir); err != nil {
+			return fmt.Errorf("cannot watch %s: %w", dir, err)
+		}
+		dirs[dir] = true
+	}
+
+	timer := time.NewTimer(0)
+	<-timer.C
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return nil
+			}
+			if files[filepath.Clean(event.Name)] {
+				timer.Reset(reloadDelay)
+			}
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return nil
+			}
+			log.Warnf("filewatch: watch error: %v", err)
+		case <-timer.C:
+			reload()
+		}
+	}
+}
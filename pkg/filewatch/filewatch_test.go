@@ -0,0 +1,41 @@
+package filewatch
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWatch(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "watched.txt")
+	assert.Nil(t, os.WriteFile(path, []byte("a"), 0600))
+
+	var reloads int32
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() { _ = Watch(ctx, []string{path, path}, func() { atomic.AddInt32(&reloads, 1) }) }()
+	time.Sleep(50 * time.Millisecond)
+
+	// other files of directory are ignored
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, "other.txt"), []byte("b"), 0600))
+	time.Sleep(300 * time.Millisecond)
+	assert.Equal(t, int32(0), atomic.LoadInt32(&reloads))
+
+	// events of replace are grouped
+	tmp := filepath.Join(dir, "watched.txt.tmp")
+	assert.Nil(t, os.WriteFile(tmp, []byte("c"), 0600))
+	assert.Nil(t, os.Rename(tmp, path))
+	assert.Eventually(t, func() bool { return atomic.LoadInt32(&reloads) == 1 }, 2*time.Second, 10*time.Millisecond)
+	time.Sleep(300 * time.Millisecond)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&reloads))
+}
+
+func TestWatch_NoFiles(t *testing.T) {
+	assert.Nil(t, Watch(context.Background(), nil, func() {}))
+}
@@ -0,0 +1,353 @@
+package frontend
+
+import (
+	"context"
+	"crypto/rand"
+	"embed"
+	"encoding/hex"
+	"html/template"
+	"net"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"url_shortener/pkg/server"
+
+	pb "url_shortener/pkg/grpc"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// previewSuffix suffix of short URL path showing link preview instead of redirect
+const previewSuffix = "+"
+
+//go:embed templates
+var templates embed.FS
+
+var (
+	previewTemplate  = template.Must(template.ParseFS(templates, "templates/preview.html"))
+	passwordTemplate = template.Must(template.ParseFS(templates, "templates/password.html"))
+)
+
+// max size of password form body
+const maxFormSize = 4 << 10
+
+// visitorCookie cookie of visitor ID variants of A/B split links are chosen by
+const visitorCookie = "urls_visitor"
+
+// visitorCookieAge keeps visitors in their variants for duration of experiments
+const visitorCookieAge = 365 * 24 * 60 * 60
+
+// max length of accepted visitor ID cookie
+const maxVisitorIDLen = 64
+
+// short links are immutable, so their QR codes are cached long
+const qrCacheControl = "public, max-age=86400"
+
+var qrFormats = map[string]pb.QRFormat{
+	".png": pb.QRFormat_QR_FORMAT_PNG,
+	".svg": pb.QRFormat_QR_FORMAT_SVG,
+}
+
+var qrLevels = map[string]pb.QRLevel{
+	"":        pb.QRLevel_QR_LEVEL_UNSPECIFIED,
+	"low":     pb.QRLevel_QR_LEVEL_LOW,
+	"medium":  pb.QRLevel_QR_LEVEL_MEDIUM,
+	"high":    pb.QRLevel_QR_LEVEL_HIGH,
+	"highest": pb.QRLevel_QR_LEVEL_HIGHEST,
+}
+
+// Shortener URL shortener server serving frontend
+type Shortener interface {
+	pb.URLShortenerServer
+	// Visit returns link of short URL to redirect to for request attributes and counts its click
+	Visit(ctx context.Context, req *pb.ResolveRequest) (*pb.Link, error)
+}
+
+type frontend struct {
+	srv Shortener
+	// client IP is the last X-Forwarded-For address added by trusted proxy
+	trustForwardedFor bool
+}
+
+// Option frontend option
+type Option func(f *frontend)
+
+// WithTrustForwardedFor takes client IP from X-Forwarded-For header set by reverse proxy,
+// the header can be forged by clients connecting directly
+func WithTrustForwardedFor(trust bool) Option {
+	return func(f *frontend) {
+		f.trustForwardedFor = trust
+	}
+}
+
+// New creates public HTTP frontend of short links calling URL shortener server in process
+//
+// Routes:
+//
+//	GET /{short_url}                           -> redirect or interstitial page
+//	GET /{short_url}+                          -> preview page
+//	POST /{short_url}, POST /{short_url}+      -> the same for password form of protected link
+//	GET /{short_url}.png?size=256&level=medium -> QR code PNG
+//	GET /{short_url}.svg?size=256&level=medium -> QR code SVG
+func New(srv Shortener, opts ...Option) http.Handler {
+	f := &frontend{srv: srv}
+	for _, opt := range opts {
+		opt(f)
+	}
+	return http.HandlerFunc(f.serveHTTP)
+}
+
+func (f *frontend) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(r.URL.Path, "/")
+	_, isQRCode := qrFormats[path.Ext(name)]
+	if r.Method != http.MethodGet && r.Method != http.MethodHead && (r.Method != http.MethodPost || isQRCode) {
+		if isQRCode {
+			w.Header().Set("Allow", "GET, HEAD")
+		} else {
+			w.Header().Set("Allow", "GET, HEAD, POST")
+		}
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	if name == "" || strings.Contains(name, "/") {
+		http.NotFound(w, r)
+		return
+	}
+
+	if isQRCode {
+		f.serveQRCode(w, r, strings.TrimSuffix(name, path.Ext(name)), qrFormats[path.Ext(name)])
+		return
+	}
+	if strings.HasSuffix(name, previewSuffix) {
+		f.servePreview(w, r, strings.TrimSuffix(name, previewSuffix))
+		return
+	}
+	f.serveRedirect(w, r, name)
+}
+
+// serveRedirect redirects to destination of link for request or shows interstitial page
+func (f *frontend) serveRedirect(w http.ResponseWriter, r *http.Request, shortURL string) {
+	ctx, ok := passwordContext(w, r)
+	if !ok {
+		return
+	}
+	req := f.resolveRequest(r, shortURL)
+	visitor, isNew := visitorID(r)
+	req.VisitorId = visitor
+	link, err := f.srv.Visit(ctx, req)
+	if err != nil {
+		writeError(w, r, shortURL, err)
+		return
+	}
+	// cookie is set by A/B split links only
+	if isNew && len(link.GetVariants()) != 0 {
+		http.SetCookie(w, &http.Cookie{
+			Name:     visitorCookie,
+			Value:    visitor,
+			Path:     "/",
+			MaxAge:   visitorCookieAge,
+			Secure:   r.TLS != nil,
+			HttpOnly: true,
+			SameSite: http.SameSiteLaxMode,
+		})
+	}
+
+	// redirects aren't cached to count clicks
+	w.Header().Set("Cache-Control", "no-store")
+	if link.GetInterstitial() {
+		writePage(w, link, true)
+		return
+	}
+	// form submit is followed by GET of original URL
+	code := http.StatusFound
+	if r.Method == http.MethodPost {
+		code = http.StatusSeeOther
+	}
+	http.Redirect(w, r, link.GetOriginalUrl(), code)
+}
+
+func (f *frontend) servePreview(w http.ResponseWriter, r *http.Request, shortURL string) {
+	ctx, ok := passwordContext(w, r)
+	if !ok {
+		return
+	}
+	resp, err := f.srv.Preview(ctx, &pb.PreviewRequest{ShortUrl: shortURL})
+	if err != nil {
+		writeError(w, r, shortURL, err)
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	writePage(w, resp.GetLink(), false)
+}
+
+// pageData preview and interstitial page data
+type pageData struct {
+	ShortURL     string
+	OriginalURL  string
+	Title        string
+	CreatedAt    string
+	Clicks       int64
+	Interstitial bool
+}
+
+// writePage writes preview page or interstitial one asking to confirm redirect
+func writePage(w http.ResponseWriter, link *pb.Link, interstitial bool) {
+	data := pageData{
+		ShortURL:     link.GetShortUrl(),
+		OriginalURL:  link.GetOriginalUrl(),
+		Title:        link.GetMetadata().GetTitle(),
+		Clicks:       link.GetClicks(),
+		Interstitial: interstitial,
+	}
+	if link.GetCreatedAt() != nil {
+		data.CreatedAt = link.GetCreatedAt().AsTime().Format(time.RFC1123)
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := previewTemplate.Execute(w, data); err != nil {
+		log.Errorf("frontend: cannot render page of short=%s: %v", link.GetShortUrl(), err)
+	}
+}
+
+func (f *frontend) serveQRCode(w http.ResponseWriter, r *http.Request, shortURL string, format pb.QRFormat) {
+	req := &pb.GetQRCodeRequest{ShortUrl: shortURL, Format: format}
+
+	query := r.URL.Query()
+	if size := query.Get("size"); size != "" {
+		n, err := strconv.ParseInt(size, 10, 32)
+		if err != nil {
+			http.Error(w, "invalid size", http.StatusBadRequest)
+			return
+		}
+		req.Size = int32(n)
+	}
+	level, ok := qrLevels[query.Get("level")]
+	if !ok {
+		http.Error(w, "invalid level, expected low, medium, high or highest", http.StatusBadRequest)
+		return
+	}
+	req.Level = level
+
+	resp, err := f.srv.GetQRCode(r.Context(), req)
+	if err != nil {
+		writeError(w, r, shortURL, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", resp.GetContentType())
+	w.Header().Set("Cache-Control", qrCacheControl)
+	_, _ = w.Write(resp.GetImage())
+}
+
+// resolveRequest returns attributes of request link rules and country URLs are matched with
+func (f *frontend) resolveRequest(r *http.Request, shortURL string) *pb.ResolveRequest {
+	req := &pb.ResolveRequest{
+		ShortUrl:       shortURL,
+		UserAgent:      r.UserAgent(),
+		AcceptLanguage: r.Header.Get("Accept-Language"),
+		ClientIp:       f.clientIP(r),
+	}
+	for name, values := range r.URL.Query() {
+		if req.Query == nil {
+			req.Query = map[string]string{}
+		}
+		req.Query[name] = values[0]
+	}
+	return req
+}
+
+// visitorID returns visitor ID of cookie or new random one, isNew is true if cookie isn't set
+func visitorID(r *http.Request) (id string, isNew bool) {
+	if c, err := r.Cookie(visitorCookie); err == nil && c.Value != "" && len(c.Value) <= maxVisitorIDLen {
+		return c.Value, false
+	}
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		// variant is chosen by client IP and User-Agent
+		log.Warnf("frontend: cannot generate visitor ID: %v", err)
+		return "", false
+	}
+	return hex.EncodeToString(b), true
+}
+
+// clientIP returns IP of client, empty if unknown
+func (f *frontend) clientIP(r *http.Request) string {
+	if f.trustForwardedFor {
+		// proxy appends address of its client, former ones are set by client
+		if header := r.Header.Values("X-Forwarded-For"); len(header) != 0 {
+			addrs := strings.Split(header[len(header)-1], ",")
+			if ip := net.ParseIP(strings.TrimSpace(addrs[len(addrs)-1])); ip != nil {
+				return ip.String()
+			}
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return ""
+	}
+	return host
+}
+
+// passwordContext returns request context with password of submitted form in
+// incoming metadata, writes error and returns false if form can't be parsed
+func passwordContext(w http.ResponseWriter, r *http.Request) (context.Context, bool) {
+	if r.Method != http.MethodPost {
+		return r.Context(), true
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, maxFormSize)
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "invalid form", http.StatusBadRequest)
+		return nil, false
+	}
+	md := metadata.Pairs(server.PasswordMetadataKey, r.PostForm.Get("password"))
+	return metadata.NewIncomingContext(r.Context(), md), true
+}
+
+// writeError writes gRPC status error as HTTP error, password errors show password form
+func writeError(w http.ResponseWriter, r *http.Request, shortURL string, err error) {
+	if server.IsPasswordError(err) {
+		writePasswordPage(w, r, shortURL)
+		return
+	}
+	st := status.Convert(err)
+	code := runtime.HTTPStatusFromCode(st.Code())
+	switch st.Code() {
+	case codes.ResourceExhausted:
+		// click limited link is gone for good rather than rate limited
+		code = http.StatusGone
+	case codes.FailedPrecondition:
+		// link outside of activation window
+		code = http.StatusNotFound
+	}
+	http.Error(w, st.Message(), code)
+}
+
+// writePasswordPage writes form posting password to requested path
+func writePasswordPage(w http.ResponseWriter, r *http.Request, shortURL string) {
+	// form posts to relative path working behind proxy stripping public URL prefix
+	data := struct {
+		ShortURL string
+		Action   string
+		Wrong    bool
+	}{
+		ShortURL: shortURL,
+		Action:   path.Base(r.URL.Path),
+		Wrong:    r.Method == http.MethodPost,
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusForbidden)
+	if err := passwordTemplate.Execute(w, data); err != nil {
+		log.Errorf("frontend: cannot render password page of short=%s: %v", shortURL, err)
+	}
+}
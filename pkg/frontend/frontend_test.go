@@ -0,0 +1,225 @@
+package frontend
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"url_shortener/pkg/server"
+
+	pb "url_shortener/pkg/grpc"
+)
+
+type shortenerMock struct {
+	pb.UnimplementedURLShortenerServer
+
+	qrRequest *pb.GetQRCodeRequest
+}
+
+func (s *shortenerMock) GetQRCode(_ context.Context, req *pb.GetQRCodeRequest) (*pb.GetQRCodeResponse, error) {
+	if req.GetShortUrl() != "short" {
+		return nil, status.Error(codes.NotFound, "no pair to provided short URL")
+	}
+	s.qrRequest = req
+	return &pb.GetQRCodeResponse{Url: "https://sho.rt/short", Image: []byte("image"), ContentType: "image/png"}, nil
+}
+
+func (s *shortenerMock) Visit(ctx context.Context, req *pb.ResolveRequest) (*pb.Link, error) {
+	shortURL := req.GetShortUrl()
+	switch shortURL {
+	case "protected":
+		md, _ := metadata.FromIncomingContext(ctx)
+		if values := md.Get(server.PasswordMetadataKey); len(values) == 0 || values[0] != "secret" {
+			st, _ := status.New(codes.PermissionDenied, "link is password protected").
+				WithDetails(&errdetails.ErrorInfo{Reason: server.PasswordRequiredReason})
+			return nil, st.Err()
+		}
+		return &pb.Link{ShortUrl: shortURL, OriginalUrl: "https://example.com/internal", PasswordProtected: true}, nil
+	case "short":
+		return &pb.Link{ShortUrl: shortURL, OriginalUrl: "https://google.com"}, nil
+	case "expired":
+		return nil, status.Error(codes.FailedPrecondition, "link expired at 2021-09-01T10:00:00Z")
+	case "used":
+		return nil, status.Error(codes.ResourceExhausted, "link click limit is reached")
+	case "app":
+		if strings.Contains(req.GetUserAgent(), "iPhone") && req.GetQuery()["ref"] == "qr" {
+			return &pb.Link{ShortUrl: shortURL, OriginalUrl: "https://apps.apple.com/app"}, nil
+		}
+		return &pb.Link{ShortUrl: shortURL, OriginalUrl: "https://example.com/app"}, nil
+	case "split":
+		variants := []*pb.Variant{{DestinationUrl: "https://example.com/a", Weight: 50}, {DestinationUrl: "https://example.com/b", Weight: 50}}
+		url := variants[0].GetDestinationUrl()
+		if req.GetVisitorId() == "b-visitor" {
+			url = variants[1].GetDestinationUrl()
+		}
+		return &pb.Link{ShortUrl: shortURL, OriginalUrl: url, Variants: variants}, nil
+	case "careful":
+		return &pb.Link{ShortUrl: shortURL, OriginalUrl: "https://example.com/?a=<b>", Interstitial: true}, nil
+	}
+	return nil, status.Error(codes.NotFound, "no pair to provided short URL")
+}
+
+func (s *shortenerMock) Preview(_ context.Context, req *pb.PreviewRequest) (*pb.PreviewResponse, error) {
+	if req.GetShortUrl() != "short" {
+		return nil, status.Error(codes.NotFound, "no pair to provided short URL")
+	}
+	return &pb.PreviewResponse{Link: &pb.Link{
+		ShortUrl:    "short",
+		OriginalUrl: "https://google.com",
+		CreatedAt:   timestamppb.New(time.Date(2021, 8, 30, 10, 0, 0, 0, time.UTC)),
+		Clicks:      42,
+	}}, nil
+}
+
+func serve(handler http.Handler, method, target string) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(method, target, nil))
+	return rec
+}
+
+// postPassword posts password form
+func postPassword(handler http.Handler, target, password string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, target, strings.NewReader(url.Values{"password": {password}}.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestFrontend_QRCode(t *testing.T) {
+	srv := &shortenerMock{}
+	handler := New(srv)
+
+	rec := serve(handler, http.MethodGet, "/short.png")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "image/png", rec.Header().Get("Content-Type"))
+	assert.Equal(t, qrCacheControl, rec.Header().Get("Cache-Control"))
+	assert.Equal(t, "image", rec.Body.String())
+	assert.Equal(t, pb.QRFormat_QR_FORMAT_PNG, srv.qrRequest.GetFormat())
+
+	rec = serve(handler, http.MethodGet, "/short.svg?size=512&level=high")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, pb.QRFormat_QR_FORMAT_SVG, srv.qrRequest.GetFormat())
+	assert.Equal(t, int32(512), srv.qrRequest.GetSize())
+	assert.Equal(t, pb.QRLevel_QR_LEVEL_HIGH, srv.qrRequest.GetLevel())
+
+	assert.Equal(t, http.StatusNotFound, serve(handler, http.MethodGet, "/unknown.png").Code)
+	assert.Equal(t, http.StatusBadRequest, serve(handler, http.MethodGet, "/short.png?size=big").Code)
+	assert.Equal(t, http.StatusBadRequest, serve(handler, http.MethodGet, "/short.png?level=max").Code)
+	assert.Equal(t, http.StatusNotFound, serve(handler, http.MethodGet, "/short.gif").Code)
+	assert.Equal(t, http.StatusNotFound, serve(handler, http.MethodGet, "/a/short.png").Code)
+	assert.Equal(t, http.StatusMethodNotAllowed, serve(handler, http.MethodPost, "/short.png").Code)
+}
+
+func TestFrontend_Redirect(t *testing.T) {
+	handler := New(&shortenerMock{})
+
+	rec := serve(handler, http.MethodGet, "/short")
+	assert.Equal(t, http.StatusFound, rec.Code)
+	assert.Equal(t, "https://google.com", rec.Header().Get("Location"))
+	assert.Equal(t, "no-store", rec.Header().Get("Cache-Control"))
+
+	rec = serve(handler, http.MethodGet, "/careful")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "text/html; charset=utf-8", rec.Header().Get("Content-Type"))
+	assert.Contains(t, rec.Body.String(), "You are leaving for")
+	assert.Contains(t, rec.Body.String(), "https://example.com/?a=&lt;b&gt;")
+
+	// rules are matched with User-Agent and query of request
+	req := httptest.NewRequest(http.MethodGet, "/app?ref=qr", nil)
+	req.Header.Set("User-Agent", "Mozilla/5.0 (iPhone; CPU iPhone OS 14_7 like Mac OS X)")
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	assert.Equal(t, "https://apps.apple.com/app", rec.Header().Get("Location"))
+	assert.Equal(t, "https://example.com/app", serve(handler, http.MethodGet, "/app?ref=qr").Header().Get("Location"))
+
+	assert.Equal(t, http.StatusGone, serve(handler, http.MethodGet, "/used").Code)
+	assert.Equal(t, http.StatusNotFound, serve(handler, http.MethodGet, "/expired").Code)
+	assert.Equal(t, http.StatusNotFound, serve(handler, http.MethodGet, "/unknown").Code)
+	assert.Equal(t, http.StatusNotFound, serve(handler, http.MethodGet, "/").Code)
+}
+
+func TestFrontend_VisitorCookie(t *testing.T) {
+	handler := New(&shortenerMock{})
+
+	// new visitor of split link gets cookie
+	rec := serve(handler, http.MethodGet, "/split")
+	assert.Equal(t, "https://example.com/a", rec.Header().Get("Location"))
+	cookies := rec.Result().Cookies()
+	assert.Len(t, cookies, 1)
+	assert.Equal(t, visitorCookie, cookies[0].Name)
+	assert.Len(t, cookies[0].Value, 32)
+	assert.True(t, cookies[0].HttpOnly)
+
+	// returning visitor keeps cookie
+	req := httptest.NewRequest(http.MethodGet, "/split", nil)
+	req.AddCookie(&http.Cookie{Name: visitorCookie, Value: "b-visitor"})
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	assert.Equal(t, "https://example.com/b", rec.Header().Get("Location"))
+	assert.Empty(t, rec.Result().Cookies())
+
+	// links without variants don't set cookie
+	assert.Empty(t, serve(handler, http.MethodGet, "/short").Result().Cookies())
+}
+
+func TestFrontend_ClientIP(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/short", nil)
+	req.RemoteAddr = "[2001:218::1]:41234"
+	req.Header.Add("X-Forwarded-For", "10.0.0.1")
+	req.Header.Add("X-Forwarded-For", "192.0.2.1, 81.2.69.142")
+
+	direct := &frontend{}
+	assert.Equal(t, "2001:218::1", direct.clientIP(req))
+	proxied := &frontend{trustForwardedFor: true}
+	assert.Equal(t, "81.2.69.142", proxied.clientIP(req))
+
+	// invalid header falls back to proxy address
+	req.Header.Set("X-Forwarded-For", "unknown")
+	assert.Equal(t, "2001:218::1", proxied.clientIP(req))
+}
+
+func TestFrontend_Preview(t *testing.T) {
+	handler := New(&shortenerMock{})
+
+	rec := serve(handler, http.MethodGet, "/short+")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), "https://google.com")
+	assert.Contains(t, rec.Body.String(), "Mon, 30 Aug 2021 10:00:00 UTC, 42 clicks")
+
+	assert.Equal(t, http.StatusNotFound, serve(handler, http.MethodGet, "/unknown+").Code)
+}
+
+func TestFrontend_Password(t *testing.T) {
+	handler := New(&shortenerMock{})
+
+	rec := serve(handler, http.MethodGet, "/protected")
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+	assert.Equal(t, "no-store", rec.Header().Get("Cache-Control"))
+	assert.Contains(t, rec.Body.String(), `<form method="post" action="protected">`)
+	assert.NotContains(t, rec.Body.String(), "Wrong password")
+
+	rec = postPassword(handler, "/protected", "wrong")
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+	assert.Contains(t, rec.Body.String(), "Wrong password")
+
+	rec = postPassword(handler, "/protected", "secret")
+	assert.Equal(t, http.StatusSeeOther, rec.Code)
+	assert.Equal(t, "https://example.com/internal", rec.Header().Get("Location"))
+
+	// not password errors aren't forms
+	rec = postPassword(handler, "/unknown", "secret")
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	assert.Equal(t, http.StatusMethodNotAllowed, serve(handler, http.MethodPut, "/protected").Code)
+}
@@ -0,0 +1,87 @@
+package gateway
+
+import (
+	"net/http"
+
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+
+	"url_shortener/pkg/auth"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// DescriptorSetPath path of binary FileDescriptorSet of all gRPC services,
+// usable by tools without reflection support (e.g. `grpcurl -protoset`)
+const DescriptorSetPath = "/descriptors.pb"
+
+// DescriptorSet serves FileDescriptorSet of services registered in grpcServer
+// with their dependencies, admins only if auth is enabled
+func DescriptorSet(grpcServer *grpc.Server, authn *auth.Authenticator) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if authn.Enabled() {
+			token, ok := auth.ParseBearer(r.Header.Get("Authorization"))
+			if !ok {
+				http.Error(w, "authorization token is required", http.StatusUnauthorized)
+				return
+			}
+			identity, ok := authn.Authenticate(token)
+			if !ok {
+				http.Error(w, "invalid authorization token", http.StatusUnauthorized)
+				return
+			}
+			if !identity.Admin {
+				http.Error(w, "available to admins only", http.StatusForbidden)
+				return
+			}
+		}
+
+		set, err := descriptorSet(grpcServer)
+		if err != nil {
+			log.Errorf("gateway: cannot build descriptor set: %v", err)
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/x-protobuf")
+		_, _ = w.Write(set)
+	})
+}
+
+// descriptorSet builds FileDescriptorSet with files in dependency order
+func descriptorSet(grpcServer *grpc.Server) ([]byte, error) {
+	set := &descriptorpb.FileDescriptorSet{}
+	seen := map[string]bool{}
+
+	var add func(fd protoreflect.FileDescriptor)
+	add = func(fd protoreflect.FileDescriptor) {
+		if seen[fd.Path()] {
+			return
+		}
+		seen[fd.Path()] = true
+
+		imports := fd.Imports()
+		for i := 0; i < imports.Len(); i++ {
+			add(imports.Get(i).FileDescriptor)
+		}
+		set.File = append(set.File, protodesc.ToFileDescriptorProto(fd))
+	}
+
+	for name, info := range grpcServer.GetServiceInfo() {
+		file, ok := info.Metadata.(string)
+		if !ok {
+			continue
+		}
+		fd, err := protoregistry.GlobalFiles.FindFileByPath(file)
+		if err != nil {
+			log.Debugf("gateway: no descriptor of service %s: %v", name, err)
+			continue
+		}
+		add(fd)
+	}
+
+	return proto.Marshal(set)
+}
@@ -0,0 +1,53 @@
+package gateway
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"google.golang.org/grpc"
+
+	pb "url_shortener/pkg/grpc"
+)
+
+// OpenAPIPath path of OpenAPI document
+const OpenAPIPath = "/openapi.json"
+
+// New creates REST/JSON handler proxying requests to gRPC server on endpoint,
+// so REST requests pass the same interceptors as gRPC ones
+//
+// Routes:
+//
+//	POST  /v1/links                      -> URLShortener.Create
+//	GET   /v1/links                      -> URLShortener.ListLinks
+//	GET   /v1/links/{short_url}          -> URLShortener.Get
+//	POST  /v1/links/{short_url}:resolve  -> URLShortener.Resolve
+//	GET   /v1/links/{short_url}/info     -> URLShortener.GetLinkInfo
+//	GET   /v1/links/{short_url}/qr       -> URLShortener.GetQRCode
+//	GET   /v1/links/{short_url}/preview  -> URLShortener.Preview
+//	PATCH /v1/links/{short_url}/metadata -> URLShortener.UpdateMetadata
+//	POST  /v1/policy:apply               -> URLShortener.ApplyPolicy
+//	GET   /openapi.json                  -> OpenAPI document
+func New(ctx context.Context, endpoint string, opts ...grpc.DialOption) (http.Handler, error) {
+	gwMux := runtime.NewServeMux()
+	if err := pb.RegisterURLShortenerHandlerFromEndpoint(ctx, gwMux, endpoint, opts); err != nil {
+		return nil, fmt.Errorf("gateway: cannot register handler: %w", err)
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/v1/", gwMux)
+	mux.HandleFunc(OpenAPIPath, serveOpenAPI)
+
+	return mux, nil
+}
+
+func serveOpenAPI(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(pb.OpenAPI)
+}
@@ -0,0 +1,227 @@
+package gateway
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/descriptorpb"
+
+	"url_shortener/pkg/auth"
+	"url_shortener/pkg/config"
+	pb "url_shortener/pkg/grpc"
+)
+
+type shortenerMock struct {
+	pb.UnimplementedURLShortenerServer
+}
+
+func (s *shortenerMock) Create(_ context.Context, req *pb.CreateRequest) (*pb.CreateResponse, error) {
+	return &pb.CreateResponse{ShortUrl: "short_" + req.GetOriginalUrl()}, nil
+}
+
+func (s *shortenerMock) Get(_ context.Context, req *pb.GetRequest) (*pb.GetResponse, error) {
+	if req.GetShortUrl() != "short" {
+		return nil, status.Error(codes.NotFound, "no pair to provided short URL")
+	}
+	return &pb.GetResponse{OriginalUrl: "original"}, nil
+}
+
+func newGateway(t *testing.T) http.Handler {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+
+	grpcServer := grpc.NewServer()
+	pb.RegisterURLShortenerServer(grpcServer, &shortenerMock{})
+	go func() { _ = grpcServer.Serve(lis) }()
+	t.Cleanup(grpcServer.Stop)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	handler, err := New(ctx, lis.Addr().String(), grpc.WithInsecure())
+	assert.Nil(t, err)
+	return handler
+}
+
+func TestGateway_Create(t *testing.T) {
+	handler := newGateway(t)
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/v1/links", strings.NewReader(`{"original_url": "google.com"}`)))
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	resp := map[string]string{}
+	assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, "short_google.com", resp["shortUrl"])
+}
+
+func TestGateway_Get(t *testing.T) {
+	handler := newGateway(t)
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/v1/links/short", nil))
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	resp := map[string]interface{}{}
+	assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, "original", resp["originalUrl"])
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/v1/links/not_exist", nil))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestGateway_OpenAPI(t *testing.T) {
+	handler := newGateway(t)
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, OpenAPIPath, nil))
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+
+	doc := map[string]interface{}{}
+	assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &doc))
+	assert.Contains(t, doc["paths"], "/v1/links")
+}
+
+func TestGateway_GRPCWeb(t *testing.T) {
+	grpcServer := grpc.NewServer()
+	pb.RegisterURLShortenerServer(grpcServer, &shortenerMock{})
+
+	rest := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	})
+	handler := WithGRPCWeb(config.CORSConfig{AllowedOrigins: []string{"https://dashboard.example.com"}}, grpcServer, rest)
+
+	// length-prefixed gRPC-Web message frame
+	msg, err := proto.Marshal(&pb.GetRequest{ShortUrl: "short"})
+	assert.Nil(t, err)
+	frame := make([]byte, 5, 5+len(msg))
+	binary.BigEndian.PutUint32(frame[1:], uint32(len(msg)))
+	frame = append(frame, msg...)
+
+	req := httptest.NewRequest(http.MethodPost, "/grpc.URLShortener/Get", bytes.NewReader(frame))
+	req.Header.Set("Content-Type", "application/grpc-web+proto")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	body := w.Body.Bytes()
+	assert.True(t, len(body) > 5)
+	assert.Equal(t, byte(0), body[0])
+	n := binary.BigEndian.Uint32(body[1:5])
+	resp := &pb.GetResponse{}
+	assert.Nil(t, proto.Unmarshal(body[5:5+n], resp))
+	assert.Equal(t, "original", resp.GetOriginalUrl())
+
+	// gRPC-Web responses follow allowed origins, preflight is handled by WithCORS
+	for origin, allowed := range map[string]string{
+		"https://dashboard.example.com": "https://dashboard.example.com",
+		"https://evil.example.com":      "",
+	} {
+		req = httptest.NewRequest(http.MethodPost, "/grpc.URLShortener/Get", bytes.NewReader(frame))
+		req.Header.Set("Content-Type", "application/grpc-web+proto")
+		req.Header.Set("Origin", origin)
+		w = httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		assert.Equal(t, allowed, w.Header().Get("Access-Control-Allow-Origin"))
+	}
+
+	// not gRPC-Web request is passed to REST handler
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/v1/links/short", nil))
+	assert.Equal(t, http.StatusTeapot, w.Code)
+}
+
+func TestGateway_CORS(t *testing.T) {
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	handler := WithCORS(config.CORSConfig{AllowedOrigins: []string{"https://dashboard.example.com"}}, next)
+
+	req := httptest.NewRequest(http.MethodOptions, "/grpc.URLShortener/Get", nil)
+	req.Header.Set("Origin", "https://dashboard.example.com")
+	req.Header.Set("Access-Control-Request-Method", http.MethodPost)
+	req.Header.Set("Access-Control-Request-Headers", "x-grpc-web, content-type")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	assert.Equal(t, "https://dashboard.example.com", w.Header().Get("Access-Control-Allow-Origin"))
+
+	// link password of protected links
+	req.Header.Set("Access-Control-Request-Headers", "x-grpc-web, content-type, x-link-password")
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	assert.Equal(t, "https://dashboard.example.com", w.Header().Get("Access-Control-Allow-Origin"))
+	assert.Contains(t, strings.ToLower(w.Header().Get("Access-Control-Allow-Headers")), "x-link-password")
+
+	// metadata update of REST API
+	patch := httptest.NewRequest(http.MethodOptions, "/v1/links/short/metadata", nil)
+	patch.Header.Set("Origin", "https://dashboard.example.com")
+	patch.Header.Set("Access-Control-Request-Method", http.MethodPatch)
+	patch.Header.Set("Access-Control-Request-Headers", "content-type")
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, patch)
+
+	assert.Equal(t, "https://dashboard.example.com", w.Header().Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, http.MethodPatch, w.Header().Get("Access-Control-Allow-Methods"))
+
+	req.Header.Set("Origin", "https://evil.example.com")
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	assert.Equal(t, "", w.Header().Get("Access-Control-Allow-Origin"))
+}
+
+func TestGateway_DescriptorSet(t *testing.T) {
+	grpcServer := grpc.NewServer()
+	pb.RegisterURLShortenerServer(grpcServer, &shortenerMock{})
+
+	authn := auth.New(config.AuthConfig{
+		Enabled: true,
+		Tokens: []config.TokenConfig{
+			{Name: "user", Token: "user-token"},
+			{Name: "admin", Token: "admin-token", Admin: true},
+		},
+	})
+	handler := DescriptorSet(grpcServer, authn)
+
+	for token, code := range map[string]int{
+		"":            http.StatusUnauthorized,
+		"user-token":  http.StatusForbidden,
+		"admin-token": http.StatusOK,
+	} {
+		req := httptest.NewRequest(http.MethodGet, DescriptorSetPath, nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		assert.Equal(t, code, w.Code, token)
+
+		if code == http.StatusOK {
+			set := &descriptorpb.FileDescriptorSet{}
+			assert.Nil(t, proto.Unmarshal(w.Body.Bytes(), set))
+
+			var files []string
+			for _, f := range set.GetFile() {
+				files = append(files, f.GetName())
+			}
+			assert.Contains(t, files, "url_shortener.proto")
+			// dependencies go first
+			assert.Equal(t, "url_shortener.proto", files[len(files)-1])
+		}
+	}
+}
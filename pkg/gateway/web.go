@@ -0,0 +1,70 @@
+package gateway
+
+import (
+	"net/http"
+
+	"github.com/improbable-eng/grpc-web/go/grpcweb"
+	"github.com/rs/cors"
+	"google.golang.org/grpc"
+
+	"url_shortener/pkg/config"
+	"url_shortener/pkg/server"
+)
+
+var (
+	// headers used by gRPC-Web and REST clients
+	corsAllowedHeaders = []string{
+		"Accept", "Authorization", "Content-Type",
+		"Grpc-Timeout", "X-Grpc-Web", "X-User-Agent",
+		// link password of gRPC-Web and REST requests
+		server.PasswordMetadataKey, "Grpc-Metadata-" + server.PasswordMetadataKey,
+	}
+	// gRPC status is sent in headers for unary calls
+	corsExposedHeaders = []string{
+		"Grpc-Status", "Grpc-Message", "Grpc-Status-Details-Bin",
+	}
+)
+
+// WithGRPCWeb serves gRPC-Web requests by grpcServer and passes other requests to next,
+// so the same service implementation handles native gRPC and browser clients.
+// gRPC-Web requests are allowed from origins of cfg as REST ones
+func WithGRPCWeb(cfg config.CORSConfig, grpcServer *grpc.Server, next http.Handler) http.Handler {
+	// preflight requests are handled by WithCORS for all HTTP routes
+	wrapped := grpcweb.WrapServer(
+		grpcServer,
+		grpcweb.WithOriginFunc(originFunc(cfg.AllowedOrigins)),
+		grpcweb.WithCorsForRegisteredEndpointsOnly(false),
+	)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if wrapped.IsGrpcWebRequest(r) {
+			wrapped.ServeHTTP(w, r)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// originFunc checks origin is in allowed origins, `*` allows any origin
+func originFunc(allowed []string) func(string) bool {
+	return func(origin string) bool {
+		for _, o := range allowed {
+			if o == "*" || o == origin {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// WithCORS handles CORS requests by configuration
+func WithCORS(cfg config.CORSConfig, next http.Handler) http.Handler {
+	return cors.New(cors.Options{
+		AllowedOrigins:   cfg.AllowedOrigins,
+		AllowedMethods:   []string{http.MethodGet, http.MethodPost, http.MethodPatch, http.MethodHead},
+		AllowedHeaders:   append(append([]string{}, corsAllowedHeaders...), cfg.AllowedHeaders...),
+		ExposedHeaders:   corsExposedHeaders,
+		AllowCredentials: cfg.AllowCredentials,
+		MaxAge:           cfg.MaxAge,
+	}).Handler(next)
+}
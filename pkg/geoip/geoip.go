@@ -0,0 +1,92 @@
+package geoip
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"github.com/oschwald/maxminddb-golang"
+
+	"url_shortener/pkg/filewatch"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// DB country lookup in MaxMind format database, e.g. GeoLite2-Country or GeoIP2-City
+type DB struct {
+	path string
+
+	// *maxminddb.Reader, replaced on reload
+	reader atomic.Value
+}
+
+// record country fields of GeoIP2 country and city databases
+type record struct {
+	Country struct {
+		ISOCode string `maxminddb:"iso_code"`
+	} `maxminddb:"country"`
+	RegisteredCountry struct {
+		ISOCode string `maxminddb:"iso_code"`
+	} `maxminddb:"registered_country"`
+}
+
+// Open loads database file
+func Open(path string) (*DB, error) {
+	d := &DB{path: path}
+	if err := d.Reload(); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// Close releases database, lookups aren't allowed after it
+func (d *DB) Close() error {
+	return d.reader.Load().(*maxminddb.Reader).Close()
+}
+
+// Reload reloads database file, current database is kept on error
+func (d *DB) Reload() error {
+	// database is read to memory, so lookups in progress don't need the replaced one to be open
+	data, err := os.ReadFile(d.path)
+	if err != nil {
+		return fmt.Errorf("geoip: cannot read database: %w", err)
+	}
+	reader, err := maxminddb.FromBytes(data)
+	if err != nil {
+		return fmt.Errorf("geoip: cannot open database %s: %w", d.path, err)
+	}
+	d.reader.Store(reader)
+
+	log.Printf("geoip: loaded %s database built at %s", reader.Metadata.DatabaseType,
+		time.Unix(int64(reader.Metadata.BuildEpoch), 0).UTC().Format(time.RFC3339))
+	return nil
+}
+
+// Country returns ISO 3166-1 alpha-2 code of IP country, registered country
+// is used for anonymous networks, empty if IP isn't found
+func (d *DB) Country(ip net.IP) (string, error) {
+	var r record
+	if err := d.reader.Load().(*maxminddb.Reader).Lookup(ip, &r); err != nil {
+		return "", fmt.Errorf("geoip: cannot lookup %s: %w", ip, err)
+	}
+	if r.Country.ISOCode != "" {
+		return r.Country.ISOCode, nil
+	}
+	return r.RegisteredCountry.ISOCode, nil
+}
+
+// Watch reloads database on file change until context is done
+func (d *DB) Watch(ctx context.Context) error {
+	err := filewatch.Watch(ctx, []string{d.path}, func() {
+		if err := d.Reload(); err != nil {
+			log.Errorf("geoip: cannot reload database, previous database is kept: %v", err)
+		}
+	})
+	if err != nil {
+		return fmt.Errorf("geoip: cannot watch database: %w", err)
+	}
+	return nil
+}
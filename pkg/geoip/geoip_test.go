@@ -0,0 +1,79 @@
+package geoip
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+//go:generate go run testdata/gen.go
+
+// fixture countries.mmdb networks are listed in testdata/gen.go
+const fixture = "testdata/countries.mmdb"
+
+func TestDB_Country(t *testing.T) {
+	d, err := Open(fixture)
+	assert.Nil(t, err)
+
+	for ip, country := range map[string]string{
+		"81.2.69.160":        "GB",
+		"::ffff:81.2.69.130": "GB",
+		"89.160.20.120":      "SE",
+		"2001:218::1":        "JP",
+		// registered country of anonymous network
+		"67.43.156.1": "BT",
+		"1.1.1.1":     "",
+		"2001:db8::1": "",
+	} {
+		got, err := d.Country(net.ParseIP(ip))
+		assert.Nil(t, err, ip)
+		assert.Equal(t, country, got, ip)
+	}
+
+	_, err = Open("testdata/not_exist.mmdb")
+	assert.NotNil(t, err)
+	_, err = Open("testdata/gen.go")
+	assert.NotNil(t, err)
+
+	assert.Nil(t, d.Close())
+}
+
+func TestDB_Watch(t *testing.T) {
+	data, err := os.ReadFile(fixture)
+	assert.Nil(t, err)
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "countries.mmdb")
+	assert.Nil(t, os.WriteFile(path, data, 0600))
+
+	d, err := Open(path)
+	assert.Nil(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() { _ = d.Watch(ctx) }()
+	time.Sleep(50 * time.Millisecond)
+
+	// file is replaced as database updaters do, SE string record becomes NO
+	tmp := filepath.Join(dir, "countries.mmdb.tmp")
+	assert.Nil(t, os.WriteFile(tmp, bytes.Replace(data, []byte("\x42SE"), []byte("\x42NO"), -1), 0600))
+	assert.Nil(t, os.Rename(tmp, path))
+
+	assert.Eventually(t, func() bool {
+		country, _ := d.Country(net.ParseIP("89.160.20.120"))
+		return country == "NO"
+	}, 2*time.Second, 10*time.Millisecond)
+
+	// invalid database keeps previous one
+	assert.Nil(t, os.WriteFile(path, []byte("not a database"), 0600))
+	time.Sleep(300 * time.Millisecond)
+	country, err := d.Country(net.ParseIP("89.160.20.120"))
+	assert.Nil(t, err)
+	assert.Equal(t, "NO", country)
+}
@@ -0,0 +1,191 @@
+//go:build ignore
+// +build ignore
+
+// gen writes countries.mmdb fixture: IPv6 MaxMind DB with 24 bit records mapping
+// few networks to GeoIP2-Country like records
+//
+//	go run testdata/gen.go
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"log"
+	"net"
+	"os"
+	"sort"
+)
+
+// fixture networks and their records
+var networks = []struct {
+	cidr string
+	// country of `country.iso_code`, empty if not set
+	country string
+	// country of `registered_country.iso_code`, empty if not set
+	registered string
+}{
+	{"81.2.69.128/26", "GB", "GB"},
+	{"89.160.20.112/28", "SE", "SE"},
+	{"2001:218::/32", "JP", "JP"},
+	// anonymous networks have registered country only
+	{"67.43.156.0/24", "", "BT"},
+}
+
+const recordSize = 24
+
+type node struct {
+	// child nodes or data offsets of bits 0 and 1
+	children [2]*node
+	data     [2]int
+	hasData  [2]bool
+	number   int
+}
+
+func main() {
+	root := &node{}
+	var data bytes.Buffer
+	for _, n := range networks {
+		_, ipNet, err := net.ParseCIDR(n.cidr)
+		if err != nil {
+			log.Fatal(err)
+		}
+		offset := data.Len()
+		data.Write(record(n.country, n.registered))
+		insert(root, ipNet, offset)
+	}
+
+	nodes := number(root)
+	var tree bytes.Buffer
+	for _, n := range nodes {
+		for bit := 0; bit < 2; bit++ {
+			value := len(nodes) // empty record
+			switch {
+			case n.children[bit] != nil:
+				value = n.children[bit].number
+			case n.hasData[bit]:
+				value = len(nodes) + 16 + n.data[bit]
+			}
+			tree.Write([]byte{byte(value >> 16), byte(value >> 8), byte(value)})
+		}
+	}
+
+	var out bytes.Buffer
+	out.Write(tree.Bytes())
+	out.Write(make([]byte, 16))
+	out.Write(data.Bytes())
+	out.WriteString("\xAB\xCD\xEFMaxMind.com")
+	out.Write(metadata(len(nodes)))
+
+	if err := os.WriteFile("testdata/countries.mmdb", out.Bytes(), 0644); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// insert adds data record of network to tree of 128 bit addresses,
+// IPv4 networks are in ::/96 subtree
+func insert(root *node, ipNet *net.IPNet, offset int) {
+	ip := ipNet.IP.To16()
+	ones, bits := ipNet.Mask.Size()
+	if bits == 32 {
+		ip = append(make(net.IP, 12), ipNet.IP.To4()...)
+		ones += 96
+	}
+
+	n := root
+	for i := 0; i < ones; i++ {
+		bit := int(ip[i/8]>>(7-uint(i%8))) & 1
+		if i == ones-1 {
+			n.data[bit], n.hasData[bit] = offset, true
+			return
+		}
+		if n.children[bit] == nil {
+			n.children[bit] = &node{}
+		}
+		n = n.children[bit]
+	}
+}
+
+// number numbers nodes breadth first, root is 0
+func number(root *node) []*node {
+	nodes := []*node{root}
+	for i := 0; i < len(nodes); i++ {
+		nodes[i].number = i
+		for _, child := range nodes[i].children {
+			if child != nil {
+				nodes = append(nodes, child)
+			}
+		}
+	}
+	return nodes
+}
+
+func record(country, registered string) []byte {
+	m := map[string]interface{}{}
+	if country != "" {
+		m["country"] = map[string]interface{}{"iso_code": country}
+	}
+	if registered != "" {
+		m["registered_country"] = map[string]interface{}{"iso_code": registered}
+	}
+	return encode(m)
+}
+
+func metadata(nodeCount int) []byte {
+	return encode(map[string]interface{}{
+		"binary_format_major_version": uint16(2),
+		"binary_format_minor_version": uint16(0),
+		"build_epoch":                 uint64(1630454400),
+		"database_type":               "URL-Shortener-Test-Country",
+		"description":                 map[string]interface{}{"en": "URL shortener test countries"},
+		"ip_version":                  uint16(6),
+		"languages":                   []interface{}{"en"},
+		"node_count":                  uint32(nodeCount),
+		"record_size":                 uint16(recordSize),
+	})
+}
+
+// encode encodes value of MaxMind DB data section, sizes are below 29
+func encode(v interface{}) []byte {
+	var b bytes.Buffer
+	switch v := v.(type) {
+	case string:
+		b.WriteByte(2<<5 | byte(len(v)))
+		b.WriteString(v)
+	case uint16:
+		b.Write(encodeUint(5, 0, uint64(v)))
+	case uint32:
+		b.Write(encodeUint(6, 0, uint64(v)))
+	case uint64:
+		b.Write(encodeUint(0, 9, v))
+	case map[string]interface{}:
+		b.WriteByte(7<<5 | byte(len(v)))
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			b.Write(encode(k))
+			b.Write(encode(v[k]))
+		}
+	case []interface{}:
+		b.Write([]byte{byte(len(v)), 11 - 7})
+		for _, item := range v {
+			b.Write(encode(item))
+		}
+	default:
+		log.Fatalf("cannot encode %T", v)
+	}
+	return b.Bytes()
+}
+
+// encodeUint encodes unsigned integer of type or of extended type if type is 0
+func encodeUint(typ, extended byte, v uint64) []byte {
+	buf := make([]byte, 8)
+	binary.BigEndian.PutUint64(buf, v)
+	value := bytes.TrimLeft(buf, "\x00")
+	if extended != 0 {
+		return append([]byte{byte(len(value)), extended - 7}, value...)
+	}
+	return append([]byte{typ<<5 | byte(len(value))}, value...)
+}
@@ -0,0 +1,10 @@
+package grpc
+
+import (
+	_ "embed"
+)
+
+// OpenAPI OpenAPI v2 document of URLShortener REST API generated from url_shortener.proto
+//
+//go:embed url_shortener.swagger.json
+var OpenAPI []byte
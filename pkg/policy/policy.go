@@ -0,0 +1,303 @@
+package policy
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"sync/atomic"
+
+	"golang.org/x/net/idna"
+
+	"url_shortener/pkg/config"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// regexPrefix prefix of regular expression rule
+const regexPrefix = "regex:"
+
+var defaultSchemes = []string{"http", "https"}
+
+// Violation URL is rejected by policy
+type Violation struct {
+	// matched rule, empty if URL itself is invalid
+	Rule   string
+	Reason string
+}
+
+func (v *Violation) Error() string {
+	return "URL is blocked by policy: " + v.Reason
+}
+
+// Policy checks destination URLs by block and allow lists
+type Policy struct {
+	cfg     config.PolicyConfig
+	schemes map[string]bool
+
+	// *lists, replaced on reload
+	lists atomic.Value
+}
+
+type lists struct {
+	block *ruleSet
+	allow *ruleSet
+}
+
+// New creates policy and loads its rules files
+func New(cfg config.PolicyConfig) (*Policy, error) {
+	p := &Policy{cfg: cfg, schemes: map[string]bool{}}
+
+	schemes := cfg.AllowedSchemes
+	if len(schemes) == 0 {
+		schemes = defaultSchemes
+	}
+	for _, scheme := range schemes {
+		p.schemes[strings.ToLower(scheme)] = true
+	}
+
+	if err := p.Reload(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// Reload reloads rules files, current rules are kept on error
+func (p *Policy) Reload() error {
+	block, err := loadRules(p.cfg.Blocklist, p.cfg.BlocklistFiles)
+	if err != nil {
+		return err
+	}
+	allow, err := loadRules(p.cfg.Allowlist, p.cfg.AllowlistFiles)
+	if err != nil {
+		return err
+	}
+	p.lists.Store(&lists{block: block, allow: allow})
+
+	log.Printf("policy: loaded %d blocklist and %d allowlist rules", block.len(), allow.len())
+	return nil
+}
+
+// CheckRedirects returns true if links are checked on redirect
+func (p *Policy) CheckRedirects() bool {
+	return p.cfg.CheckRedirects
+}
+
+// Check returns Violation if URL is invalid, has not allowed scheme
+// or matches blocklist and doesn't match allowlist
+func (p *Policy) Check(rawURL string) error {
+	u, err := Normalize(rawURL)
+	if err != nil {
+		return &Violation{Reason: "invalid URL"}
+	}
+	if !p.schemes[u.Scheme] {
+		return &Violation{Reason: fmt.Sprintf("scheme `%s` isn't allowed", u.Scheme)}
+	}
+
+	l := p.lists.Load().(*lists)
+	if _, ok := l.allow.match(u); ok {
+		return nil
+	}
+	if r, ok := l.block.match(u); ok {
+		return &Violation{Rule: r.text, Reason: r.reason}
+	}
+	return nil
+}
+
+// Normalize parses URL, URL without scheme is http one, host is lowercased
+// ASCII without port and trailing dot
+func Normalize(rawURL string) (*url.URL, error) {
+	rawURL = strings.TrimSpace(rawURL)
+	if !strings.Contains(rawURL, "://") && !hasScheme(rawURL) {
+		rawURL = "http://" + rawURL
+	}
+
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	u.Scheme = strings.ToLower(u.Scheme)
+	if u.Opaque != "" || u.Host == "" {
+		// e.g. javascript: and mailto: URLs
+		return u, nil
+	}
+
+	host := u.Hostname()
+	if ip := net.ParseIP(host); ip == nil {
+		host, err = idna.Lookup.ToASCII(strings.TrimSuffix(host, "."))
+		if err != nil {
+			return nil, err
+		}
+	}
+	u.Host = strings.ToLower(host)
+	return u, nil
+}
+
+// hasScheme checks URL has scheme without slashes, e.g. `javascript:alert(1)`,
+// host with port `example.com:8080` has no scheme
+func hasScheme(rawURL string) bool {
+	i := strings.Index(rawURL, ":")
+	if i <= 0 {
+		return false
+	}
+	for _, c := range rawURL[:i] {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '+' || c == '-' || c == '.') {
+			return false
+		}
+	}
+	rest := rawURL[i+1:]
+	if j := strings.IndexAny(rest, "/?#"); j >= 0 {
+		rest = rest[:j]
+	}
+	// port isn't scheme
+	for _, c := range rest {
+		if c < '0' || c > '9' {
+			return true
+		}
+	}
+	return rest == ""
+}
+
+// DomainSet set of domains matching their subdomains too
+type DomainSet map[string]bool
+
+// NewDomainSet creates set of normalized domains
+func NewDomainSet(domains []string) (DomainSet, error) {
+	s := DomainSet{}
+	for _, domain := range domains {
+		u, err := Normalize(domain)
+		if err != nil || u.Hostname() == "" {
+			return nil, fmt.Errorf("policy: invalid domain `%s`", domain)
+		}
+		s[u.Hostname()] = true
+	}
+	return s, nil
+}
+
+// Match checks normalized host or its parent domain is in set
+func (s DomainSet) Match(host string) bool {
+	for _, domain := range parentDomains(host) {
+		if s[domain] {
+			return true
+		}
+	}
+	return false
+}
+
+// parentDomains returns host and its parent domains, e.g. `a.b.c`, `b.c`, `c`
+func parentDomains(host string) []string {
+	var domains []string
+	for host != "" {
+		domains = append(domains, host)
+		i := strings.Index(host, ".")
+		if i < 0 {
+			break
+		}
+		host = host[i+1:]
+	}
+	return domains
+}
+
+type rule struct {
+	text   string
+	reason string
+	regex  *regexp.Regexp
+}
+
+// ruleSet domain rules match host and its parent domains, regex rules match normalized URL
+type ruleSet struct {
+	domains map[string]rule
+	regexps []rule
+}
+
+func (s *ruleSet) len() int {
+	return len(s.domains) + len(s.regexps)
+}
+
+func (s *ruleSet) match(u *url.URL) (rule, bool) {
+	for _, domain := range parentDomains(u.Hostname()) {
+		if r, ok := s.domains[domain]; ok {
+			return r, true
+		}
+	}
+
+	normalized := u.String()
+	for _, r := range s.regexps {
+		if r.regex.MatchString(normalized) {
+			return r, true
+		}
+	}
+	return rule{}, false
+}
+
+func (s *ruleSet) add(line, source string) error {
+	text, reason := line, ""
+	if i := strings.Index(line, " #"); i >= 0 {
+		text, reason = strings.TrimSpace(line[:i]), strings.TrimSpace(line[i+2:])
+	}
+	if text == "" {
+		return nil
+	}
+	if reason == "" {
+		reason = fmt.Sprintf("matches rule `%s`", text)
+	}
+
+	if strings.HasPrefix(text, regexPrefix) {
+		re, err := regexp.Compile(strings.TrimPrefix(text, regexPrefix))
+		if err != nil {
+			return fmt.Errorf("policy: invalid rule `%s` in %s: %w", text, source, err)
+		}
+		s.regexps = append(s.regexps, rule{text: text, reason: reason, regex: re})
+		return nil
+	}
+
+	u, err := Normalize(text)
+	if err != nil || u.Hostname() == "" {
+		return fmt.Errorf("policy: invalid domain `%s` in %s", text, source)
+	}
+	s.domains[u.Hostname()] = rule{text: text, reason: reason}
+	return nil
+}
+
+// loadRules loads inline rules and rules files, lines starting with `#` are comments
+func loadRules(inline []string, files []string) (*ruleSet, error) {
+	s := &ruleSet{domains: map[string]rule{}}
+	for _, line := range inline {
+		if err := s.add(strings.TrimSpace(line), "config"); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, path := range files {
+		if err := s.loadFile(path); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+func (s *ruleSet) loadFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("policy: cannot open rules: %w", err)
+	}
+	defer func() { _ = f.Close() }()
+
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if err := s.add(line, fmt.Sprintf("%s:%d", path, n)); err != nil {
+			return err
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("policy: cannot read %s: %w", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,107 @@
+package policy
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"url_shortener/pkg/config"
+)
+
+func TestNormalize(t *testing.T) {
+	for raw, expected := range map[string]string{
+		"google.com":                  "http://google.com",
+		"  HTTPS://WWW.Google.COM./a": "https://www.google.com/a",
+		"example.com:8080/path":       "http://example.com/path",
+		"http://пример.рф/путь":       "http://xn--e1afmkfd.xn--p1ai/%D0%BF%D1%83%D1%82%D1%8C",
+		"http://127.0.0.1:80/":        "http://127.0.0.1/",
+		"javascript:alert(1)":         "javascript:alert(1)",
+	} {
+		u, err := Normalize(raw)
+		assert.Nil(t, err, raw)
+		assert.Equal(t, expected, u.String(), raw)
+	}
+}
+
+func TestPolicy_Check(t *testing.T) {
+	p, err := New(config.PolicyConfig{
+		Blocklist: []string{
+			"evil.com # phishing",
+			`regex:^https?://[^/]+/wp-login\.php`,
+		},
+		Allowlist: []string{"good.evil.com"},
+	})
+	assert.Nil(t, err)
+
+	for _, allowed := range []string{"google.com", "https://notevil.com", "https://good.evil.com/login", "example.com/wp-login"} {
+		assert.Nil(t, p.Check(allowed), allowed)
+	}
+
+	violation := &Violation{}
+	err = p.Check("https://login.EVIL.com./account")
+	assert.True(t, errors.As(err, &violation))
+	assert.Equal(t, "evil.com", violation.Rule)
+	assert.Equal(t, "phishing", violation.Reason)
+
+	err = p.Check("http://example.com/wp-login.php?a=1")
+	assert.True(t, errors.As(err, &violation))
+	assert.Equal(t, "matches rule `regex:^https?://[^/]+/wp-login\\.php`", violation.Reason)
+
+	err = p.Check("javascript:alert(1)")
+	assert.True(t, errors.As(err, &violation))
+	assert.Equal(t, "scheme `javascript` isn't allowed", violation.Reason)
+
+	err = p.Check("http://[::1")
+	assert.True(t, errors.As(err, &violation))
+	assert.Equal(t, "invalid URL", violation.Reason)
+
+	_, err = New(config.PolicyConfig{Blocklist: []string{"regex:("}})
+	assert.NotNil(t, err)
+}
+
+func TestDomainSet(t *testing.T) {
+	s, err := NewDomainSet([]string{"Bit.ly", "https://t.co/"})
+	assert.Nil(t, err)
+
+	assert.True(t, s.Match("bit.ly"))
+	assert.True(t, s.Match("www.bit.ly"))
+	assert.True(t, s.Match("t.co"))
+	assert.False(t, s.Match("notbit.ly"))
+	assert.False(t, s.Match("ly"))
+
+	_, err = NewDomainSet([]string{"http://"})
+	assert.NotNil(t, err)
+}
+
+func TestPolicy_Watch(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "blocklist.txt")
+	assert.Nil(t, os.WriteFile(path, []byte("# comment\nevil.com\n"), 0600))
+
+	p, err := New(config.PolicyConfig{BlocklistFiles: []string{path}})
+	assert.Nil(t, err)
+	assert.NotNil(t, p.Check("evil.com"))
+	assert.Nil(t, p.Check("bad.org"))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() { _ = p.Watch(ctx) }()
+	time.Sleep(50 * time.Millisecond)
+
+	// file is replaced as editors do
+	tmp := filepath.Join(dir, "blocklist.txt.tmp")
+	assert.Nil(t, os.WriteFile(tmp, []byte("evil.com\nbad.org # malware\n"), 0600))
+	assert.Nil(t, os.Rename(tmp, path))
+
+	assert.Eventually(t, func() bool { return p.Check("bad.org") != nil }, 2*time.Second, 10*time.Millisecond)
+
+	// invalid rules keep previous ones
+	assert.Nil(t, os.WriteFile(path, []byte("regex:(\n"), 0600))
+	time.Sleep(300 * time.Millisecond)
+	assert.NotNil(t, p.Check("bad.org"))
+}
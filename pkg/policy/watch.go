@@ -0,0 +1,24 @@
+package policy
+
+import (
+	"context"
+	"fmt"
+
+	"url_shortener/pkg/filewatch"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Watch reloads rules on rules files changes until context is done
+func (p *Policy) Watch(ctx context.Context) error {
+	files := append(append([]string{}, p.cfg.BlocklistFiles...), p.cfg.AllowlistFiles...)
+	err := filewatch.Watch(ctx, files, func() {
+		if err := p.Reload(); err != nil {
+			log.Errorf("policy: cannot reload rules, previous rules are kept: %v", err)
+		}
+	})
+	if err != nil {
+		return fmt.Errorf("policy: cannot watch rules: %w", err)
+	}
+	return nil
+}
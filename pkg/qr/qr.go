@@ -0,0 +1,100 @@
+package qr
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	"github.com/skip2/go-qrcode"
+)
+
+const (
+	DefaultSize = 256
+	MinSize     = 64
+	MaxSize     = 2048
+)
+
+type Format string
+
+const (
+	FormatPNG Format = "png"
+	FormatSVG Format = "svg"
+)
+
+type Level = qrcode.RecoveryLevel
+
+const (
+	LevelLow     = qrcode.Low
+	LevelMedium  = qrcode.Medium
+	LevelHigh    = qrcode.High
+	LevelHighest = qrcode.Highest
+)
+
+// ErrSize size is out of [MinSize, MaxSize]
+var ErrSize = fmt.Errorf("qr: size must be in [%d, %d]", MinSize, MaxSize)
+
+// Options QR code rendering options, zero size is DefaultSize
+type Options struct {
+	Size   int
+	Level  Level
+	Format Format
+}
+
+// Render renders QR code of content, returns image and its content type
+func Render(content string, opts Options) ([]byte, string, error) {
+	if opts.Size == 0 {
+		opts.Size = DefaultSize
+	}
+	if opts.Size < MinSize || opts.Size > MaxSize {
+		return nil, "", ErrSize
+	}
+
+	q, err := qrcode.New(content, opts.Level)
+	if err != nil {
+		return nil, "", fmt.Errorf("qr: cannot encode: %w", err)
+	}
+
+	switch opts.Format {
+	case FormatPNG, "":
+		image, err := q.PNG(opts.Size)
+		if err != nil {
+			return nil, "", fmt.Errorf("qr: cannot render PNG: %w", err)
+		}
+		return image, "image/png", nil
+	case FormatSVG:
+		return svg(q.Bitmap(), opts.Size), "image/svg+xml", nil
+	default:
+		return nil, "", errors.New("qr: unknown format")
+	}
+}
+
+// Terminal renders QR code of content by Unicode half blocks
+func Terminal(content string, level Level) (string, error) {
+	q, err := qrcode.New(content, level)
+	if err != nil {
+		return "", fmt.Errorf("qr: cannot encode: %w", err)
+	}
+	return q.ToSmallString(false), nil
+}
+
+// svg renders bitmap as SVG, dark modules of row are merged into horizontal runs
+func svg(bitmap [][]bool, size int) []byte {
+	buf := &bytes.Buffer{}
+	_, _ = fmt.Fprintf(buf, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" shape-rendering="crispEdges">`,
+		size, size, len(bitmap), len(bitmap))
+	_, _ = fmt.Fprintf(buf, `<rect width="100%%" height="100%%" fill="#fff"/><path fill="#000" d="`)
+	for y, row := range bitmap {
+		for x := 0; x < len(row); x++ {
+			if !row[x] {
+				continue
+			}
+			start := x
+			for x < len(row) && row[x] {
+				x++
+			}
+			_, _ = fmt.Fprintf(buf, "M%d %dh%dv1h-%dz", start, y, x-start, x-start)
+		}
+	}
+	buf.WriteString(`"/></svg>`)
+	return buf.Bytes()
+}
@@ -0,0 +1,47 @@
+package qr
+
+import (
+	"bytes"
+	"image/png"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRender(t *testing.T) {
+	image, contentType, err := Render("https://sho.rt/3PjSsTTFog", Options{})
+	assert.Nil(t, err)
+	assert.Equal(t, "image/png", contentType)
+
+	decoded, err := png.Decode(bytes.NewReader(image))
+	assert.Nil(t, err)
+	assert.Equal(t, DefaultSize, decoded.Bounds().Dx())
+
+	image, contentType, err = Render("https://sho.rt/3PjSsTTFog", Options{Size: 512, Level: LevelHigh, Format: FormatSVG})
+	assert.Nil(t, err)
+	assert.Equal(t, "image/svg+xml", contentType)
+	assert.True(t, strings.HasPrefix(string(image), "<svg "))
+	assert.Contains(t, string(image), `width="512"`)
+
+	_, _, err = Render("https://sho.rt/3PjSsTTFog", Options{Size: MaxSize + 1})
+	assert.ErrorIs(t, err, ErrSize)
+
+	_, _, err = Render("https://sho.rt/3PjSsTTFog", Options{Format: "gif"})
+	assert.NotNil(t, err)
+}
+
+func TestSVG(t *testing.T) {
+	image := svg([][]bool{
+		{true, true, false},
+		{false, true, true},
+	}, 64)
+	assert.Contains(t, string(image), `viewBox="0 0 2 2"`)
+	assert.Contains(t, string(image), `d="M0 0h2v1h-2zM1 1h2v1h-2z"`)
+}
+
+func TestTerminal(t *testing.T) {
+	s, err := Terminal("https://sho.rt/3PjSsTTFog", LevelMedium)
+	assert.Nil(t, err)
+	assert.NotEmpty(t, s)
+}
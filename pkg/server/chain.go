@@ -0,0 +1,62 @@
+package server
+
+import (
+	"context"
+	"errors"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"url_shortener/pkg/chain"
+)
+
+// resolveChain returns destination of links to own short links and third-party shorteners,
+// links to not existing short links, rejected shorteners and loops are InvalidArgument
+func (s *Server) resolveChain(ctx context.Context, url string) (string, error) {
+	resolved, err := s.chains.Resolve(ctx, url)
+	if err == nil {
+		return resolved, nil
+	}
+	if _, ok := status.FromError(err); ok {
+		return "", err
+	}
+	switch {
+	case errors.Is(err, chain.ErrShortener), errors.Is(err, chain.ErrLoop), errors.Is(err, chain.ErrTooManyHops):
+		return "", status.Error(codes.InvalidArgument, err.Error())
+	case errors.Is(err, chain.ErrUnwrap):
+		return "", status.Error(codes.FailedPrecondition, err.Error())
+	default:
+		return "", status.Error(codes.Unknown, "cannot resolve URL")
+	}
+}
+
+// lookupOriginalURL returns original URL of own short link for chain resolving
+func (s *Server) lookupOriginalURL(ctx context.Context, shortURL string) (string, error) {
+	row, err := s.row(ctx, shortURL)
+	if status.Code(err) == codes.NotFound {
+		return "", status.Error(codes.InvalidArgument, "link to not existing short URL")
+	}
+	if err != nil {
+		return "", err
+	}
+	if err := disabledError(row); err != nil {
+		return "", err
+	}
+	// link to protected link would reveal its destination without password
+	if row.PasswordHash != "" {
+		return "", status.Error(codes.InvalidArgument, "link to password protected short URL")
+	}
+	// link to click limited link would bypass its limit
+	if row.MaxClicks != 0 {
+		return "", status.Error(codes.InvalidArgument, "link to click limited short URL")
+	}
+	// link to scheduled link would outlive its activation window
+	if !row.NotBefore.IsZero() || !row.NotAfter.IsZero() {
+		return "", status.Error(codes.InvalidArgument, "link to scheduled short URL")
+	}
+	// link to link with rules, country URLs or variants would resolve to its original URL only
+	if len(row.Rules) != 0 || len(row.CountryURLs) != 0 || len(row.Variants) != 0 {
+		return "", status.Error(codes.InvalidArgument, "link to short URL with conditional destinations")
+	}
+	return row.OriginalURL, nil
+}
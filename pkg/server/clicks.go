@@ -0,0 +1,105 @@
+package server
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// DefaultClickFlushTime period of clicks flush to database
+const DefaultClickFlushTime = 5 * time.Second
+
+// clickCounter counts clicks in memory until they are flushed to database,
+// so redirects don't wait for database writes
+type clickCounter struct {
+	mu       sync.Mutex
+	counts   map[string]int64
+	variants map[variantKey]int64
+}
+
+// variantKey variant of short URL at position starting from 0
+type variantKey struct {
+	shortURL string
+	variant  int
+}
+
+func newClickCounter() *clickCounter {
+	return &clickCounter{counts: map[string]int64{}, variants: map[variantKey]int64{}}
+}
+
+func (c *clickCounter) add(shortURL string, n int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.counts[shortURL] += n
+}
+
+func (c *clickCounter) addVariant(shortURL string, variant int, n int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.variants[variantKey{shortURL, variant}] += n
+}
+
+// pending returns not flushed clicks of short URL
+func (c *clickCounter) pending(shortURL string) int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.counts[shortURL]
+}
+
+// pendingVariant returns not flushed clicks of short URL variant
+func (c *clickCounter) pendingVariant(shortURL string, variant int) int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.variants[variantKey{shortURL, variant}]
+}
+
+// take returns not flushed clicks of short URLs and their variants and resets them
+func (c *clickCounter) take() (map[string]int64, map[variantKey]int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	counts, variants := c.counts, c.variants
+	c.counts, c.variants = map[string]int64{}, map[variantKey]int64{}
+	return counts, variants
+}
+
+// RunClickFlush flushes clicks to database every period until context is done
+func (s *Server) RunClickFlush(ctx context.Context, period time.Duration) {
+	if period <= 0 {
+		period = DefaultClickFlushTime
+	}
+	ticker := time.NewTicker(period)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.FlushClicks(ctx)
+		}
+	}
+}
+
+// FlushClicks writes counted clicks to database, failed ones are kept for next flush
+func (s *Server) FlushClicks(ctx context.Context) {
+	counts, variants := s.clicks.take()
+	for shortURL, n := range counts {
+		if err := s.db.AddClicks(ctx, shortURL, n); err != nil {
+			log.Warnf("clicks: cannot flush %d clicks of short=%s: %v", n, shortURL, err)
+			s.clicks.add(shortURL, n)
+		}
+	}
+	for key, n := range variants {
+		if err := s.db.AddVariantClicks(ctx, key.shortURL, key.variant, n); err != nil {
+			log.Warnf("clicks: cannot flush %d clicks of variant %d of short=%s: %v", n, key.variant, key.shortURL, err)
+			s.clicks.addVariant(key.shortURL, key.variant, n)
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package server
+
+import (
+	"context"
+	"errors"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"url_shortener/pkg/auth"
+	"url_shortener/pkg/db"
+
+	pb "url_shortener/pkg/grpc"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// linkSources database sources by request sources, links are created with API by default
+var linkSources = map[pb.LinkSource]string{
+	pb.LinkSource_LINK_SOURCE_UNSPECIFIED: db.SourceAPI,
+	pb.LinkSource_LINK_SOURCE_API:         db.SourceAPI,
+	pb.LinkSource_LINK_SOURCE_CLI:         db.SourceCLI,
+	pb.LinkSource_LINK_SOURCE_IMPORT:      db.SourceImport,
+}
+
+func linkSourceToProto(source string) pb.LinkSource {
+	switch source {
+	case db.SourceAPI:
+		return pb.LinkSource_LINK_SOURCE_API
+	case db.SourceCLI:
+		return pb.LinkSource_LINK_SOURCE_CLI
+	case db.SourceImport:
+		return pb.LinkSource_LINK_SOURCE_IMPORT
+	default:
+		return pb.LinkSource_LINK_SOURCE_UNSPECIFIED
+	}
+}
+
+// GetLinkInfo returns full link record including disabled links,
+// links with owner are returned to owner and admins only
+func (s *Server) GetLinkInfo(ctx context.Context, req *pb.GetLinkInfoRequest) (*pb.GetLinkInfoResponse, error) {
+	if req.GetShortUrl() == "" {
+		return &pb.GetLinkInfoResponse{}, status.Error(codes.InvalidArgument, "empty short URL")
+	}
+
+	// cached row can be outdated
+	row, err := s.db.GetRow(ctx, req.GetShortUrl())
+	if err != nil {
+		if errors.Is(err, &db.NoRowError{}) {
+			return &pb.GetLinkInfoResponse{}, status.Error(codes.NotFound, "no pair to provided short URL")
+		}
+		log.Errorf("info: cannot get row with short_url=%s: %v", req.GetShortUrl(), err)
+		return &pb.GetLinkInfoResponse{}, dbStatusError(err, "cannot get link")
+	}
+	if !ownedBy(ctx, row) {
+		return &pb.GetLinkInfoResponse{}, status.Error(codes.PermissionDenied, "link info is returned to its owner only")
+	}
+	row.Clicks += s.clicks.pending(req.GetShortUrl())
+	if len(row.Variants) != 0 {
+		variants := make(db.Variants, len(row.Variants))
+		for i, v := range row.Variants {
+			v.Clicks += s.clicks.pendingVariant(req.GetShortUrl(), i)
+			variants[i] = v
+		}
+		row.Variants = variants
+	}
+
+	return &pb.GetLinkInfoResponse{Link: s.protectedLink(ctx, row)}, nil
+}
+
+// ownedBy checks link is managed by identity of context: link has no owner,
+// identity is its owner or admin
+func ownedBy(ctx context.Context, row db.Row) bool {
+	return row.Owner == "" || ownerOrAdmin(ctx, row)
+}
+
+// ownerOrAdmin checks identity of context is owner of link or admin, links without owner
+// have no owner identity
+func ownerOrAdmin(ctx context.Context, row db.Row) bool {
+	identity, ok := auth.FromContext(ctx)
+	return identity.Admin || ok && row.Owner != "" && identity.Name == row.Owner
+}
+
+// protectedLink converts row to link, destinations of password protected link are returned
+// to its owner, admins and callers with password in incoming metadata only
+func (s *Server) protectedLink(ctx context.Context, row db.Row) *pb.Link {
+	link := s.link(row)
+	if row.PasswordHash == "" || ownerOrAdmin(ctx, row) || checkPassword(ctx, row, "") == nil {
+		return link
+	}
+	link.OriginalUrl, link.FallbackUrl = "", ""
+	link.Rules, link.CountryUrls, link.Variants = nil, nil, nil
+	return link
+}
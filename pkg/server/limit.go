@@ -0,0 +1,31 @@
+package server
+
+import (
+	"context"
+	"errors"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"url_shortener/pkg/db"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// useClick takes click of click limited link in database and returns clicks left,
+// cached rows of limited links don't bypass limit as every resolution is written,
+// links without clicks left are ResourceExhausted
+func (s *Server) useClick(ctx context.Context, row db.Row) (int64, error) {
+	if row.MaxClicks == 0 {
+		return 0, nil
+	}
+	left, err := s.db.UseClick(ctx, row.ShortURL)
+	if err != nil {
+		if errors.Is(err, &db.ExhaustedError{}) {
+			return 0, status.Error(codes.ResourceExhausted, "link click limit is reached")
+		}
+		log.Errorf("limit: cannot use click of short_url=%s: %v", row.ShortURL, err)
+		return 0, dbStatusError(err, "cannot use link click")
+	}
+	return left, nil
+}
@@ -0,0 +1,147 @@
+package server
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"url_shortener/pkg/db"
+	"url_shortener/pkg/policy"
+
+	pb "url_shortener/pkg/grpc"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	defaultPageSize = 50
+	maxPageSize     = 1000
+)
+
+var listOrders = map[pb.ListOrder]db.Order{
+	pb.ListOrder_LIST_ORDER_CREATED_DESC: db.OrderCreatedDesc,
+	pb.ListOrder_LIST_ORDER_CREATED_ASC:  db.OrderCreatedAsc,
+	pb.ListOrder_LIST_ORDER_CLICKS_DESC:  db.OrderClicksDesc,
+	pb.ListOrder_LIST_ORDER_SHORT_URL:    db.OrderShortURL,
+}
+
+// pageToken sort key of last link of page and hash of filters it was listed by
+type pageToken struct {
+	ShortURL  string    `json:"s"`
+	CreatedAt time.Time `json:"c"`
+	Clicks    int64     `json:"k"`
+	Filter    string    `json:"f"`
+}
+
+// ListLinks lists links matching filters page by page in given order
+func (s *Server) ListLinks(ctx context.Context, req *pb.ListLinksRequest) (*pb.ListLinksResponse, error) {
+	f, err := listFilter(req)
+	if err != nil {
+		return &pb.ListLinksResponse{}, status.Error(codes.InvalidArgument, err.Error())
+	}
+	pageSize := f.Limit
+	// extra row shows there is next page
+	f.Limit++
+
+	filterHash := hashFilter(f)
+	if req.GetPageToken() != "" {
+		token, err := decodePageToken(req.GetPageToken())
+		if err != nil || token.Filter != filterHash {
+			return &pb.ListLinksResponse{}, status.Error(codes.InvalidArgument, "invalid page token")
+		}
+		f.After = &db.Row{ShortURL: token.ShortURL, CreatedAt: token.CreatedAt, Clicks: token.Clicks}
+	}
+
+	rows, err := s.db.FindRows(ctx, f)
+	if err != nil {
+		log.Errorf("list: cannot find rows: %v", err)
+		return &pb.ListLinksResponse{}, dbStatusError(err, "cannot list links")
+	}
+
+	resp := &pb.ListLinksResponse{}
+	if len(rows) > pageSize {
+		rows = rows[:pageSize]
+		last := rows[len(rows)-1]
+		resp.NextPageToken = encodePageToken(pageToken{
+			ShortURL:  last.ShortURL,
+			CreatedAt: last.CreatedAt,
+			Clicks:    last.Clicks,
+			Filter:    filterHash,
+		})
+	}
+	for _, row := range rows {
+		resp.Links = append(resp.Links, s.protectedLink(ctx, row))
+	}
+	return resp, nil
+}
+
+// listFilter converts request to database filter without page token
+func listFilter(req *pb.ListLinksRequest) (db.Filter, error) {
+	f := db.Filter{Owner: req.GetOwner(), Limit: int(req.GetPageSize())}
+
+	switch {
+	case f.Limit < 0:
+		return db.Filter{}, fmt.Errorf("negative page size")
+	case f.Limit == 0:
+		f.Limit = defaultPageSize
+	case f.Limit > maxPageSize:
+		f.Limit = maxPageSize
+	}
+
+	order, ok := listOrders[req.GetOrder()]
+	if !ok {
+		return db.Filter{}, fmt.Errorf("unknown order")
+	}
+	f.Order = order
+
+	if req.GetDomain() != "" {
+		u, err := policy.Normalize(req.GetDomain())
+		if err != nil || u.Hostname() == "" {
+			return db.Filter{}, fmt.Errorf("invalid domain")
+		}
+		f.Domain = u.Hostname()
+	}
+	if req.GetTag() != "" {
+		tag, err := normalizeTag(req.GetTag())
+		if err != nil {
+			return db.Filter{}, err
+		}
+		f.Tag = tag
+	}
+	if req.GetCreatedAfter() != nil {
+		f.CreatedAfter = req.GetCreatedAfter().AsTime()
+	}
+	if req.GetCreatedBefore() != nil {
+		f.CreatedBefore = req.GetCreatedBefore().AsTime()
+	}
+	return f, nil
+}
+
+// hashFilter returns hash of filters and order, page token of other filters is invalid
+func hashFilter(f db.Filter) string {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%s\x00%s\x00%s\x00%s\x00%s\x00%d", f.Owner, f.Domain,
+		f.CreatedAfter.Format(time.RFC3339Nano), f.CreatedBefore.Format(time.RFC3339Nano), f.Tag, f.Order)))
+	return hex.EncodeToString(sum[:8])
+}
+
+func encodePageToken(token pageToken) string {
+	data, _ := json.Marshal(token)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodePageToken(s string) (pageToken, error) {
+	token := pageToken{}
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return token, err
+	}
+	err = json.Unmarshal(data, &token)
+	return token, err
+}
@@ -0,0 +1,134 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"url_shortener/pkg/db"
+
+	pb "url_shortener/pkg/grpc"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	maxTitleLen = 256
+	maxNotesLen = 4096
+	maxTagLen   = 64
+	maxTags     = 32
+)
+
+// metadataFields fields updated if update mask isn't set
+var metadataFields = []string{db.MetadataTitle, db.MetadataNotes, db.MetadataTags}
+
+// UpdateMetadata updates fields of update mask, links with owner are updated by owner and admins only
+func (s *Server) UpdateMetadata(ctx context.Context, req *pb.UpdateMetadataRequest) (*pb.UpdateMetadataResponse, error) {
+	if req.GetShortUrl() == "" {
+		return &pb.UpdateMetadataResponse{}, status.Error(codes.InvalidArgument, "empty short URL")
+	}
+	m, err := metadataFromProto(req.GetMetadata())
+	if err != nil {
+		return &pb.UpdateMetadataResponse{}, status.Error(codes.InvalidArgument, err.Error())
+	}
+	fields := metadataFields
+	if len(req.GetUpdateMask().GetPaths()) != 0 {
+		fields = req.GetUpdateMask().GetPaths()
+		for _, field := range fields {
+			if field != db.MetadataTitle && field != db.MetadataNotes && field != db.MetadataTags {
+				return &pb.UpdateMetadataResponse{}, status.Errorf(codes.InvalidArgument, "unknown metadata field `%s`", field)
+			}
+		}
+	}
+
+	row, err := s.db.GetRow(ctx, req.GetShortUrl())
+	if err != nil {
+		if errors.Is(err, &db.NoRowError{}) {
+			return &pb.UpdateMetadataResponse{}, status.Error(codes.NotFound, "no pair to provided short URL")
+		}
+		log.Errorf("metadata: cannot get row with short_url=%s: %v", req.GetShortUrl(), err)
+		return &pb.UpdateMetadataResponse{}, dbStatusError(err, "cannot get link")
+	}
+	if !ownedBy(ctx, row) {
+		return &pb.UpdateMetadataResponse{}, status.Error(codes.PermissionDenied, "link metadata is updated by its owner only")
+	}
+
+	updated, err := s.db.UpdateMetadata(ctx, req.GetShortUrl(), m, fields)
+	if err != nil {
+		if errors.Is(err, &db.NoRowError{}) {
+			return &pb.UpdateMetadataResponse{}, status.Error(codes.NotFound, "no pair to provided short URL")
+		}
+		log.Errorf("metadata: cannot update short_url=%s: %v", req.GetShortUrl(), err)
+		return &pb.UpdateMetadataResponse{}, dbStatusError(err, "cannot update metadata")
+	}
+	s.lruShortOrig.Remove(req.GetShortUrl())
+
+	log.Debugf("metadata: updated %v of short=%s", fields, req.GetShortUrl())
+
+	return &pb.UpdateMetadataResponse{Metadata: metadataToProto(updated)}, nil
+}
+
+// metadataFromProto validates metadata, tags are normalized and sorted
+func metadataFromProto(m *pb.Metadata) (db.Metadata, error) {
+	if utf8.RuneCountInString(m.GetTitle()) > maxTitleLen {
+		return db.Metadata{}, fmt.Errorf("title is longer than %d characters", maxTitleLen)
+	}
+	if utf8.RuneCountInString(m.GetNotes()) > maxNotesLen {
+		return db.Metadata{}, fmt.Errorf("notes are longer than %d characters", maxNotesLen)
+	}
+
+	tags := map[string]bool{}
+	for _, tag := range m.GetTags() {
+		tag, err := normalizeTag(tag)
+		if err != nil {
+			return db.Metadata{}, err
+		}
+		tags[tag] = true
+	}
+	if len(tags) > maxTags {
+		return db.Metadata{}, fmt.Errorf("more than %d tags", maxTags)
+	}
+
+	res := db.Metadata{Title: strings.TrimSpace(m.GetTitle()), Notes: m.GetNotes()}
+	for tag := range tags {
+		res.Tags = append(res.Tags, tag)
+	}
+	sort.Strings(res.Tags)
+	return res, nil
+}
+
+// normalizeTag lowercases tag, tags can't be empty or contain spaces and commas
+func normalizeTag(tag string) (string, error) {
+	tag = strings.ToLower(strings.TrimSpace(tag))
+	if tag == "" {
+		return "", fmt.Errorf("empty tag")
+	}
+	if utf8.RuneCountInString(tag) > maxTagLen {
+		return "", fmt.Errorf("tag `%s` is longer than %d characters", tag, maxTagLen)
+	}
+	if strings.IndexFunc(tag, func(r rune) bool { return unicode.IsSpace(r) || r == ',' }) >= 0 {
+		return "", fmt.Errorf("tag `%s` contains space or comma", tag)
+	}
+	return tag, nil
+}
+
+// metadataToProto returns nil for empty metadata
+func metadataToProto(m db.Metadata) *pb.Metadata {
+	if m.Title == "" && m.Notes == "" && len(m.Tags) == 0 {
+		return nil
+	}
+	return &pb.Metadata{Title: m.Title, Notes: m.Notes, Tags: m.Tags}
+}
+
+// publicMetadataToProto returns metadata without notes, notes are returned to owners by GetLinkInfo only
+func publicMetadataToProto(m db.Metadata) *pb.Metadata {
+	m.Notes = ""
+	return metadataToProto(m)
+}
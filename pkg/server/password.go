@@ -0,0 +1,91 @@
+package server
+
+import (
+	"context"
+	"errors"
+
+	"golang.org/x/crypto/bcrypt"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"url_shortener/pkg/db"
+)
+
+const (
+	// PasswordMetadataKey metadata key of link password, used if request has no password,
+	// REST clients send it as Grpc-Metadata-X-Link-Password header
+	PasswordMetadataKey = "x-link-password"
+	// PasswordRequiredReason reason of ErrorInfo detail of missing or wrong link password
+	PasswordRequiredReason = "PASSWORD_REQUIRED"
+
+	// bcrypt ignores password bytes after 72
+	maxPasswordLen = 72
+)
+
+// hashPassword returns bcrypt hash of link password, empty password isn't hashed
+func hashPassword(password string) (string, error) {
+	if password == "" {
+		return "", nil
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", status.Error(codes.Unknown, "cannot hash password")
+	}
+	return string(hash), nil
+}
+
+// passwordMatches checks password of create request is password of stored link,
+// stored row is inserted requested one if hashes are equal
+func passwordMatches(stored, requested db.Row, password string) bool {
+	if password == "" || stored.PasswordHash == "" {
+		return password == "" && stored.PasswordHash == ""
+	}
+	if stored.PasswordHash == requested.PasswordHash {
+		return true
+	}
+	return bcrypt.CompareHashAndPassword([]byte(stored.PasswordHash), []byte(password)) == nil
+}
+
+// checkPassword checks password of protected link, password of request is
+// taken from incoming metadata if empty
+func checkPassword(ctx context.Context, row db.Row, password string) error {
+	if row.PasswordHash == "" {
+		return nil
+	}
+	if password == "" {
+		md, _ := metadata.FromIncomingContext(ctx)
+		if values := md.Get(PasswordMetadataKey); len(values) != 0 {
+			password = values[0]
+		}
+	}
+	if password == "" {
+		return passwordError("link is password protected")
+	}
+
+	err := bcrypt.CompareHashAndPassword([]byte(row.PasswordHash), []byte(password))
+	if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+		return passwordError("wrong link password")
+	}
+	if err != nil {
+		return status.Error(codes.Unknown, "cannot check password")
+	}
+	return nil
+}
+
+// passwordError returns PermissionDenied status with PasswordRequiredReason
+// detail distinguishing it from disabled links
+func passwordError(msg string) error {
+	return reasonError(codes.PermissionDenied, PasswordRequiredReason, msg)
+}
+
+// IsPasswordError checks error is status of missing or wrong link password
+func IsPasswordError(err error) bool {
+	for _, detail := range status.Convert(err).Details() {
+		if info, ok := detail.(*errdetails.ErrorInfo); ok && info.GetReason() == PasswordRequiredReason {
+			return true
+		}
+	}
+	return false
+}
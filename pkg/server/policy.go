@@ -0,0 +1,130 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"url_shortener/pkg/db"
+	"url_shortener/pkg/policy"
+
+	pb "url_shortener/pkg/grpc"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// applyPolicyBatch count of links checked per database query
+const applyPolicyBatch = 500
+
+// checkPolicy returns PermissionDenied status with reason if URL is blocked by policy
+func (s *Server) checkPolicy(url string) error {
+	if s.policy == nil {
+		return nil
+	}
+	err := s.policy.Check(url)
+	if err == nil {
+		return nil
+	}
+	var v *policy.Violation
+	if errors.As(err, &v) {
+		return status.Error(codes.PermissionDenied, v.Error())
+	}
+	return status.Error(codes.Unknown, "cannot check URL policy")
+}
+
+// disabledError returns PermissionDenied status if link is disabled
+func disabledError(row db.Row) error {
+	if !row.Disabled {
+		return nil
+	}
+	return status.Error(codes.PermissionDenied, "link is disabled: "+row.DisabledReason)
+}
+
+// ApplyPolicy checks all enabled links by current policy and disables blocked ones
+func (s *Server) ApplyPolicy(ctx context.Context, req *pb.ApplyPolicyRequest) (*pb.ApplyPolicyResponse, error) {
+	if s.policy == nil {
+		return &pb.ApplyPolicyResponse{}, status.Error(codes.FailedPrecondition, "policy is disabled")
+	}
+
+	resp := &pb.ApplyPolicyResponse{}
+	after := ""
+	for {
+		rows, err := s.db.ListRows(ctx, after, applyPolicyBatch)
+		if err != nil {
+			log.Errorf("apply policy: cannot list rows after short_url=%s: %v", after, err)
+			return resp, dbStatusError(err, "cannot list links")
+		}
+
+		for _, row := range rows {
+			if row.Disabled {
+				continue
+			}
+			resp.Checked++
+
+			reason, blocked := s.blockedReason(row)
+			if !blocked {
+				continue
+			}
+			resp.Blocked = append(resp.Blocked, &pb.BlockedLink{
+				ShortUrl:    row.ShortURL,
+				OriginalUrl: row.OriginalURL,
+				Reason:      reason,
+			})
+			if req.GetDryRun() {
+				continue
+			}
+
+			if err := s.db.DisableRow(ctx, row.ShortURL, reason); err != nil {
+				log.Errorf("apply policy: cannot disable short_url=%s: %v", row.ShortURL, err)
+				return resp, dbStatusError(err, "cannot disable link")
+			}
+			s.lruShortOrig.Remove(row.ShortURL)
+			s.lruOrigShort.Remove(row.OriginalURL)
+			log.Infof("apply policy: disabled short=%s original=%s: %s", row.ShortURL, row.OriginalURL, reason)
+		}
+
+		if len(rows) < applyPolicyBatch {
+			return resp, nil
+		}
+		after = rows[len(rows)-1].ShortURL
+	}
+}
+
+// blockedReason checks original, fallback, rule, country and variant destinations of row by policy and returns
+// violation reason of first blocked one, other destinations than original URL are named in reason
+func (s *Server) blockedReason(row db.Row) (string, bool) {
+	destinations := []string{row.OriginalURL}
+	if row.FallbackURL != "" {
+		destinations = append(destinations, row.FallbackURL)
+	}
+	for _, r := range row.Rules {
+		destinations = append(destinations, r.DestinationURL)
+	}
+	countries := make([]string, 0, len(row.CountryURLs))
+	for country := range row.CountryURLs {
+		countries = append(countries, country)
+	}
+	sort.Strings(countries)
+	for _, country := range countries {
+		destinations = append(destinations, row.CountryURLs[country])
+	}
+	for _, v := range row.Variants {
+		destinations = append(destinations, v.DestinationURL)
+	}
+
+	for _, url := range destinations {
+		var v *policy.Violation
+		if err := s.policy.Check(url); !errors.As(err, &v) {
+			continue
+		}
+		if url != row.OriginalURL {
+			return fmt.Sprintf("destination %s: %s", url, v.Reason), true
+		}
+		return v.Reason, true
+	}
+	return "", false
+}
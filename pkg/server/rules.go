@@ -0,0 +1,367 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"url_shortener/pkg/db"
+
+	pb "url_shortener/pkg/grpc"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// maxRules count of rules of link
+const maxRules = 20
+
+// maxCountryURLs count of country URLs of link
+const maxCountryURLs = 250
+
+// ruleTimeLayout time of day format of rules
+const ruleTimeLayout = "15:04"
+
+// deviceClasses database devices by request device classes
+var deviceClasses = map[pb.DeviceClass]string{
+	pb.DeviceClass_DEVICE_CLASS_UNSPECIFIED: "",
+	pb.DeviceClass_DEVICE_CLASS_IOS:         db.DeviceIOS,
+	pb.DeviceClass_DEVICE_CLASS_ANDROID:     db.DeviceAndroid,
+	pb.DeviceClass_DEVICE_CLASS_MOBILE:      db.DeviceMobile,
+	pb.DeviceClass_DEVICE_CLASS_DESKTOP:     db.DeviceDesktop,
+	pb.DeviceClass_DEVICE_CLASS_BOT:         db.DeviceBot,
+}
+
+func deviceClassToProto(device string) pb.DeviceClass {
+	for class, d := range deviceClasses {
+		if d == device {
+			return class
+		}
+	}
+	return pb.DeviceClass_DEVICE_CLASS_UNSPECIFIED
+}
+
+// rulesFromProto validates rules of create request, destinations are resolved by caller
+func rulesFromProto(rules []*pb.Rule) (db.Rules, error) {
+	if len(rules) > maxRules {
+		return nil, fmt.Errorf("more than %d rules", maxRules)
+	}
+	var converted db.Rules
+	for i, r := range rules {
+		device, ok := deviceClasses[r.GetDevice()]
+		if !ok {
+			return nil, fmt.Errorf("rule %d: unknown device class", i+1)
+		}
+		rule := db.Rule{
+			Device:         device,
+			Language:       strings.ToLower(r.GetLanguage()),
+			TimeStart:      r.GetTimeStart(),
+			TimeEnd:        r.GetTimeEnd(),
+			QueryParam:     r.GetQueryParam(),
+			QueryValue:     r.GetQueryValue(),
+			DestinationURL: r.GetDestinationUrl(),
+		}
+		if rule.DestinationURL == "" {
+			return nil, fmt.Errorf("rule %d: empty destination URL", i+1)
+		}
+		if rule.Language != "" && !isLanguageTag(rule.Language) {
+			return nil, fmt.Errorf("rule %d: invalid language `%s`", i+1, r.GetLanguage())
+		}
+		if (rule.TimeStart == "") != (rule.TimeEnd == "") {
+			return nil, fmt.Errorf("rule %d: time range needs both start and end", i+1)
+		}
+		if rule.TimeStart != "" {
+			start, err := time.Parse(ruleTimeLayout, rule.TimeStart)
+			if err != nil {
+				return nil, fmt.Errorf("rule %d: invalid start time, expected HH:MM: %w", i+1, err)
+			}
+			end, err := time.Parse(ruleTimeLayout, rule.TimeEnd)
+			if err != nil {
+				return nil, fmt.Errorf("rule %d: invalid end time, expected HH:MM: %w", i+1, err)
+			}
+			if start.Equal(end) {
+				return nil, fmt.Errorf("rule %d: empty time range", i+1)
+			}
+		}
+		if rule.QueryValue != "" && rule.QueryParam == "" {
+			return nil, fmt.Errorf("rule %d: query value without query parameter", i+1)
+		}
+		// rule without conditions would shadow original URL and following rules
+		if rule.Device == "" && rule.Language == "" && rule.TimeStart == "" && rule.QueryParam == "" {
+			return nil, fmt.Errorf("rule %d: no conditions", i+1)
+		}
+		converted = append(converted, rule)
+	}
+	return converted, nil
+}
+
+// countryURLsFromProto validates country URLs of create request, codes are uppercased,
+// destinations are resolved by caller
+func countryURLsFromProto(urls map[string]string) (db.CountryURLs, error) {
+	if len(urls) > maxCountryURLs {
+		return nil, fmt.Errorf("more than %d country URLs", maxCountryURLs)
+	}
+	var converted db.CountryURLs
+	for country, url := range urls {
+		code := strings.ToUpper(country)
+		if len(code) != 2 || code[0] < 'A' || code[0] > 'Z' || code[1] < 'A' || code[1] > 'Z' {
+			return nil, fmt.Errorf("invalid country code `%s`, expected ISO 3166-1 alpha-2 code", country)
+		}
+		if url == "" {
+			return nil, fmt.Errorf("empty URL of country %s", code)
+		}
+		if converted == nil {
+			converted = db.CountryURLs{}
+		}
+		if _, ok := converted[code]; ok {
+			return nil, fmt.Errorf("duplicate country %s", code)
+		}
+		converted[code] = url
+	}
+	return converted, nil
+}
+
+func rulesToProto(rules db.Rules) []*pb.Rule {
+	var converted []*pb.Rule
+	for _, r := range rules {
+		converted = append(converted, &pb.Rule{
+			Device:         deviceClassToProto(r.Device),
+			Language:       r.Language,
+			TimeStart:      r.TimeStart,
+			TimeEnd:        r.TimeEnd,
+			QueryParam:     r.QueryParam,
+			QueryValue:     r.QueryValue,
+			DestinationUrl: r.DestinationURL,
+		})
+	}
+	return converted
+}
+
+// isLanguageTag checks tag is made of letters, digits and dashes
+func isLanguageTag(tag string) bool {
+	for _, r := range tag {
+		if !(r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r == '-') {
+			return false
+		}
+	}
+	return !strings.HasPrefix(tag, "-") && !strings.HasSuffix(tag, "-")
+}
+
+// Resolve returns destination of link for request attributes, takes click of click limited link
+func (s *Server) Resolve(ctx context.Context, req *pb.ResolveRequest) (*pb.ResolveResponse, error) {
+	if req.GetShortUrl() == "" {
+		return &pb.ResolveResponse{}, status.Error(codes.InvalidArgument, "empty short URL hasn't original URL")
+	}
+
+	row, err := s.row(ctx, req.GetShortUrl())
+	if err != nil {
+		return &pb.ResolveResponse{}, err
+	}
+	if err := disabledError(row); err != nil {
+		return &pb.ResolveResponse{}, err
+	}
+	if err := checkPassword(ctx, row, req.GetPassword()); err != nil {
+		return &pb.ResolveResponse{}, err
+	}
+	res, err := s.resolveRow(row, req)
+	if err != nil {
+		return &pb.ResolveResponse{}, err
+	}
+	// fallback resolutions don't take clicks
+	if res.active {
+		if _, err := s.useClick(ctx, row); err != nil {
+			return &pb.ResolveResponse{}, err
+		}
+	}
+	return &pb.ResolveResponse{
+		Url:            res.url,
+		Rule:           int32(res.rule),
+		Inactive:       !res.active,
+		Country:        res.country,
+		CountryMatched: res.countryMatched,
+		Variant:        int32(res.variant),
+	}, nil
+}
+
+// resolution destination of link for request
+type resolution struct {
+	url    string
+	active bool
+	// position of matched rule starting from 1, 0 if none matched
+	rule int
+	// client country, looked up for links with country URLs only
+	country        string
+	countryMatched bool
+	// position of chosen variant starting from 1, 0 if url isn't variant
+	variant int
+}
+
+// resolveRow returns destination of row for request attributes at current time: fallback URL
+// of inactive row, destination of first matching rule, URL of client country, variant of visitor
+// or original URL
+func (s *Server) resolveRow(row db.Row, req *pb.ResolveRequest) (resolution, error) {
+	now := s.now()
+	url, active, err := destination(row, now)
+	if err != nil || !active {
+		return resolution{url: url}, err
+	}
+	res := resolution{url: url, active: true}
+
+	if len(row.Rules) != 0 {
+		device := deviceClass(req.GetUserAgent())
+		languages := acceptedLanguages(req.GetAcceptLanguage())
+		for i, r := range row.Rules {
+			if matchRule(r, device, languages, req.GetQuery(), now) {
+				res.url, res.rule = r.DestinationURL, i+1
+				return res, nil
+			}
+		}
+	}
+
+	if len(row.CountryURLs) != 0 {
+		res.country = s.clientCountry(req)
+		if countryURL, ok := row.CountryURLs[res.country]; ok {
+			res.url, res.countryMatched = countryURL, true
+			return res, nil
+		}
+	}
+
+	if len(row.Variants) != 0 {
+		i := chooseVariant(row, visitorID(req))
+		res.url, res.variant = row.Variants[i].DestinationURL, i+1
+	}
+	return res, nil
+}
+
+// clientCountry returns country of request or country of client IP in GeoIP database,
+// empty if unknown
+func (s *Server) clientCountry(req *pb.ResolveRequest) string {
+	if req.GetCountry() != "" {
+		return strings.ToUpper(req.GetCountry())
+	}
+	if s.geoip == nil || req.GetClientIp() == "" {
+		return ""
+	}
+	ip := net.ParseIP(req.GetClientIp())
+	if ip == nil {
+		log.Debugf("resolve: invalid client IP=%s", req.GetClientIp())
+		return ""
+	}
+	country, err := s.geoip.Country(ip)
+	if err != nil {
+		log.Warnf("resolve: %v", err)
+		return ""
+	}
+	return country
+}
+
+// matchRule checks all set conditions of rule match request
+func matchRule(r db.Rule, device string, languages []string, query map[string]string, now time.Time) bool {
+	if r.Device != "" && !matchDevice(r.Device, device) {
+		return false
+	}
+	if r.Language != "" && !matchLanguage(r.Language, languages) {
+		return false
+	}
+	if r.TimeStart != "" && !matchTimeOfDay(r.TimeStart, r.TimeEnd, now) {
+		return false
+	}
+	if r.QueryParam != "" {
+		value, ok := query[r.QueryParam]
+		if !ok || r.QueryValue != "" && value != r.QueryValue {
+			return false
+		}
+	}
+	return true
+}
+
+// matchDevice checks device class of request is rule device, mobile rule matches iOS and Android too
+func matchDevice(ruleDevice, device string) bool {
+	if ruleDevice == db.DeviceMobile {
+		return device == db.DeviceMobile || device == db.DeviceIOS || device == db.DeviceAndroid
+	}
+	return ruleDevice == device
+}
+
+// matchLanguage checks rule language is prefix of any accepted language
+func matchLanguage(ruleLanguage string, languages []string) bool {
+	for _, l := range languages {
+		if l == ruleLanguage || strings.HasPrefix(l, ruleLanguage+"-") {
+			return true
+		}
+	}
+	return false
+}
+
+// matchTimeOfDay checks UTC time of day of now is in [start, end), end before start spans midnight,
+// times are validated on create
+func matchTimeOfDay(start, end string, now time.Time) bool {
+	startTime, _ := time.Parse(ruleTimeLayout, start)
+	endTime, _ := time.Parse(ruleTimeLayout, end)
+	from, to := startTime.Hour()*60+startTime.Minute(), endTime.Hour()*60+endTime.Minute()
+
+	now = now.UTC()
+	minute := now.Hour()*60 + now.Minute()
+	if from < to {
+		return minute >= from && minute < to
+	}
+	return minute >= from || minute < to
+}
+
+// botMarkers lowercased User-Agent substrings of crawlers and link preview fetchers
+var botMarkers = []string{"bot", "crawl", "spider", "slurp", "facebookexternalhit"}
+
+// deviceClass returns device of User-Agent, empty for empty User-Agent
+func deviceClass(userAgent string) string {
+	if userAgent == "" {
+		return ""
+	}
+	ua := strings.ToLower(userAgent)
+	for _, marker := range botMarkers {
+		if strings.Contains(ua, marker) {
+			return db.DeviceBot
+		}
+	}
+	switch {
+	case strings.Contains(ua, "iphone"), strings.Contains(ua, "ipad"), strings.Contains(ua, "ipod"):
+		return db.DeviceIOS
+	case strings.Contains(ua, "android"):
+		return db.DeviceAndroid
+	case strings.Contains(ua, "mobi"):
+		return db.DeviceMobile
+	default:
+		return db.DeviceDesktop
+	}
+}
+
+// acceptedLanguages returns lowercased language ranges of Accept-Language header
+// without zero quality ones and wildcard
+func acceptedLanguages(header string) []string {
+	var languages []string
+	for _, part := range strings.Split(header, ",") {
+		params := strings.Split(part, ";")
+		lang := strings.ToLower(strings.TrimSpace(params[0]))
+		if lang == "" || lang == "*" {
+			continue
+		}
+		accepted := true
+		for _, p := range params[1:] {
+			p = strings.TrimSpace(p)
+			if !strings.HasPrefix(p, "q=") {
+				continue
+			}
+			if q, err := strconv.ParseFloat(strings.TrimPrefix(p, "q="), 64); err == nil && q <= 0 {
+				accepted = false
+			}
+		}
+		if accepted {
+			languages = append(languages, lang)
+		}
+	}
+	return languages
+}
@@ -4,12 +4,24 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"reflect"
+	"strings"
+	"time"
 
 	"github.com/hashicorp/golang-lru"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
 
+	"url_shortener/pkg/auth"
+	"url_shortener/pkg/chain"
+	"url_shortener/pkg/config"
 	"url_shortener/pkg/db"
+	"url_shortener/pkg/geoip"
+	"url_shortener/pkg/policy"
+	"url_shortener/pkg/qr"
 	"url_shortener/pkg/short"
 
 	pb "url_shortener/pkg/grpc"
@@ -23,13 +35,90 @@ type Server struct {
 	db        db.ShortenerDB
 	shortener short.Shortener
 
-	// short -> original URL cache
+	// short URL -> row cache
 	lruShortOrig *lru.Cache
 	// original -> short URL cache
 	lruOrigShort *lru.Cache
+
+	// serve cached URLs while database is unavailable
+	degradedMode bool
+
+	// base URL short URLs are served on
+	publicURL string
+	// show interstitial page before redirect of every link
+	interstitial bool
+
+	// destination URLs policy, nil if disabled
+	policy *policy.Policy
+
+	// resolves links to short links, created by New from chains config
+	chains    *chain.Resolver
+	chainsCfg config.ChainsConfig
+	// public URL of own short links, own domains only are detected if not set
+	chainsPublicURL string
+
+	// country lookup of clients, nil if disabled
+	geoip *geoip.DB
+
+	clicks *clickCounter
+	// current time of activation windows
+	now func() time.Time
+}
+
+// Option configures Server
+type Option func(s *Server)
+
+// WithDegradedMode enables serving of cached URLs while database is unavailable
+func WithDegradedMode(enabled bool) Option {
+	return func(s *Server) {
+		s.degradedMode = enabled
+	}
 }
 
-func New(lruSize int, db db.ShortenerDB, shortener short.Shortener) (*Server, error) {
+// WithPublicURL sets base URL short URLs are served on, e.g. `https://sho.rt`
+func WithPublicURL(url string) Option {
+	return func(s *Server) {
+		s.publicURL = strings.TrimSuffix(url, "/")
+	}
+}
+
+// WithInterstitial enables interstitial page before redirect of every link
+func WithInterstitial(enabled bool) Option {
+	return func(s *Server) {
+		s.interstitial = enabled
+	}
+}
+
+// WithPolicy enables destination URLs policy
+func WithPolicy(p *policy.Policy) Option {
+	return func(s *Server) {
+		s.policy = p
+	}
+}
+
+// WithChains sets detection of links to own short links on publicURL and own domains
+// and links to third-party shorteners
+func WithChains(cfg config.ChainsConfig, publicURL string) Option {
+	return func(s *Server) {
+		s.chainsCfg = cfg
+		s.chainsPublicURL = publicURL
+	}
+}
+
+// WithGeoIP enables country lookup of clients for country URLs of links
+func WithGeoIP(g *geoip.DB) Option {
+	return func(s *Server) {
+		s.geoip = g
+	}
+}
+
+// availability is implemented by databases tracking own availability
+type availability interface {
+	// Available returns false while database is known to be unavailable
+	Available() bool
+}
+
+func New(lruSize int, db db.ShortenerDB, shortener short.Shortener, opts ...Option) (*Server, error) {
 	lruShortOrig, err := lru.New(lruSize)
 	if err != nil {
 		return nil, fmt.Errorf("server: cannot create lru: %w", err)
@@ -38,39 +127,179 @@ func New(lruSize int, db db.ShortenerDB, shortener short.Shortener) (*Server, er
 	if err != nil {
 		return nil, fmt.Errorf("server: cannot create lru: %w", err)
 	}
-	return &Server{
+	s := &Server{
 		db:           db,
 		shortener:    shortener,
 		lruOrigShort: lruOrigShort,
 		lruShortOrig: lruShortOrig,
-	}, nil
+		clicks:       newClickCounter(),
+		now:          time.Now,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	s.chains, err = chain.New(s.chainsCfg, s.chainsPublicURL, s.lookupOriginalURL)
+	if err != nil {
+		return nil, fmt.Errorf("server: %w", err)
+	}
+	return s, nil
 }
 
 // Create shorts original URL and returns shorted
 func (s *Server) Create(ctx context.Context, req *pb.CreateRequest) (*pb.CreateResponse, error) {
 	if req.GetOriginalUrl() == "" {
 		log.Debug("create: empty URL")
-		return &pb.CreateResponse{}, status.Error(codes.Unknown, "cannot short empty URL")
+		return &pb.CreateResponse{}, status.Error(codes.InvalidArgument, "cannot short empty URL")
+	}
+
+	originalURL, err := s.resolveChain(ctx, req.GetOriginalUrl())
+	if err != nil {
+		log.Infof("create: cannot resolve URL=%s: %v", req.GetOriginalUrl(), err)
+		return &pb.CreateResponse{}, err
+	}
+	if originalURL != req.GetOriginalUrl() {
+		log.Debugf("create: URL=%s is resolved to %s", req.GetOriginalUrl(), originalURL)
+		req = proto.Clone(req).(*pb.CreateRequest)
+		req.OriginalUrl = originalURL
+	}
+
+	if err := s.checkPolicy(req.GetOriginalUrl()); err != nil {
+		log.Infof("create: rejected URL=%s: %v", req.GetOriginalUrl(), err)
+		return &pb.CreateResponse{}, err
+	}
+
+	metadata, err := metadataFromProto(req.GetMetadata())
+	if err != nil {
+		return &pb.CreateResponse{}, status.Error(codes.InvalidArgument, err.Error())
+	}
+	notBefore, notAfter, err := windowFromProto(req)
+	if err != nil {
+		return &pb.CreateResponse{}, status.Error(codes.InvalidArgument, err.Error())
+	}
+	fallbackURL := req.GetFallbackUrl()
+	if fallbackURL != "" {
+		if fallbackURL, err = s.resolveDestination(ctx, fallbackURL); err != nil {
+			return &pb.CreateResponse{}, err
+		}
+	}
+	rules, err := rulesFromProto(req.GetRules())
+	if err != nil {
+		return &pb.CreateResponse{}, status.Error(codes.InvalidArgument, err.Error())
+	}
+	for i := range rules {
+		if rules[i].DestinationURL, err = s.resolveDestination(ctx, rules[i].DestinationURL); err != nil {
+			return &pb.CreateResponse{}, err
+		}
+	}
+	countryURLs, err := countryURLsFromProto(req.GetCountryUrls())
+	if err != nil {
+		return &pb.CreateResponse{}, status.Error(codes.InvalidArgument, err.Error())
+	}
+	for country, url := range countryURLs {
+		if countryURLs[country], err = s.resolveDestination(ctx, url); err != nil {
+			return &pb.CreateResponse{}, err
+		}
+	}
+	variants, err := variantsFromProto(req.GetVariants())
+	if err != nil {
+		return &pb.CreateResponse{}, status.Error(codes.InvalidArgument, err.Error())
+	}
+	for i := range variants {
+		if variants[i].DestinationURL, err = s.resolveDestination(ctx, variants[i].DestinationURL); err != nil {
+			return &pb.CreateResponse{}, err
+		}
+	}
+	if req.GetMaxClicks() < 0 {
+		return &pb.CreateResponse{}, status.Error(codes.InvalidArgument, "negative max clicks")
+	}
+	if len(req.GetPassword()) > maxPasswordLen {
+		return &pb.CreateResponse{}, status.Errorf(codes.InvalidArgument, "password is longer than %d bytes", maxPasswordLen)
 	}
 
 	// check not shorted
 	isShort, err := s.isShort(ctx, req.GetOriginalUrl())
 	if err != nil {
 		log.Debugf("create: short check failed for URL=%s: %v:", req.GetOriginalUrl(), err)
-		return &pb.CreateResponse{}, status.Error(codes.Unknown, "cannot short URL")
+		return &pb.CreateResponse{}, dbStatusError(err, "cannot short URL")
 	}
 	if isShort {
 		log.Debugf("create: already shortened URL=%s", req.GetOriginalUrl())
-		return &pb.CreateResponse{}, status.Error(codes.Unknown, "cannot short shortened URL")
+		return &pb.CreateResponse{}, status.Error(codes.InvalidArgument, "cannot short shortened URL")
+	}
+
+	requested := db.Row{
+		Interstitial: req.GetInterstitial(),
+		Metadata:     metadata,
+		MaxClicks:    req.GetMaxClicks(),
+		NotBefore:    notBefore,
+		NotAfter:     notAfter,
+		FallbackURL:  fallbackURL,
+		Rules:        rules,
+		CountryURLs:  countryURLs,
+		Variants:     variants,
 	}
 
 	shortURL, ok := s.lruOrigShort.Get(req.GetOriginalUrl())
 	if ok {
-		log.Debugf("create: original=%s short=%s (LRU)", req.GetOriginalUrl(), shortURL)
-		return &pb.CreateResponse{ShortUrl: shortURL.(string)}, nil
+		if !s.serveCached() {
+			return &pb.CreateResponse{}, status.Error(codes.Unavailable, "database is unavailable")
+		}
+		// settings of link without cached row are checked by database
+		if cached, ok := s.lruShortOrig.Get(shortURL); ok {
+			if err := existingLinkError(cached.(db.Row), requested, req.GetPassword()); err != nil {
+				log.Infof("create: original=%s short=%s: %v", req.GetOriginalUrl(), shortURL, err)
+				return &pb.CreateResponse{}, err
+			}
+			log.Debugf("create: original=%s short=%s (LRU)", req.GetOriginalUrl(), shortURL)
+			return &pb.CreateResponse{ShortUrl: shortURL.(string), OriginalUrl: cached.(db.Row).OriginalURL}, nil
+		}
+	}
+
+	if requested.PasswordHash, err = hashPassword(req.GetPassword()); err != nil {
+		return &pb.CreateResponse{}, err
 	}
+	return s.create(ctx, req, requested)
+}
 
-	return s.create(ctx, req)
+// existingLinkError checks settings of link stored for original URL are requested ones: link of
+// original URL is shared by all its creators, so request of other settings can't get it
+func existingLinkError(stored, requested db.Row, password string) error {
+	var other string
+	switch {
+	case !passwordMatches(stored, requested, password):
+		other = "password"
+	case stored.Interstitial != requested.Interstitial:
+		other = "interstitial mode"
+	case stored.MaxClicks != requested.MaxClicks:
+		other = "click limit"
+	case !sameWindow(stored, requested):
+		other = "activation window"
+	case !reflect.DeepEqual(stored.Rules, requested.Rules):
+		other = "rules"
+	case !reflect.DeepEqual(stored.CountryURLs, requested.CountryURLs):
+		other = "country URLs"
+	case !sameVariants(stored.Variants, requested.Variants):
+		other = "variants"
+	}
+	if other != "" {
+		return status.Errorf(codes.AlreadyExists, "original URL is already shortened with other %s", other)
+	}
+	return nil
+}
+
+// resolveDestination resolves chain of fallback, rule, country or variant destination and checks it by policy
+func (s *Server) resolveDestination(ctx context.Context, url string) (string, error) {
+	resolved, err := s.resolveChain(ctx, url)
+	if err != nil {
+		log.Infof("create: cannot resolve destination URL=%s: %v", url, err)
+		return "", err
+	}
+	if err := s.checkPolicy(resolved); err != nil {
+		log.Infof("create: rejected destination URL=%s: %v", resolved, err)
+		return "", err
+	}
+	return resolved, nil
 }
 
 // isShort checks if URL is shorted one
@@ -81,8 +310,8 @@ func (s *Server) isShort(ctx context.Context, url string) (bool, error) {
 		return true, nil
 	}
 
-	// check db
-	_, err := s.db.GetOriginalURL(ctx, url)
+	// check db, most URLs aren't short, so replicas are skipped
+	_, err := s.db.GetOriginalURL(db.WithPrimary(ctx), url)
 	if err != nil {
 		if errors.Is(err, &db.NoRowError{}) {
 			return false, nil
@@ -92,56 +321,294 @@ func (s *Server) isShort(ctx context.Context, url string) (bool, error) {
 	return true, nil
 }
 
-// create adds new pair <original_url, short_url> to database
-func (s *Server) create(ctx context.Context, req *pb.CreateRequest) (*pb.CreateResponse, error) {
+// create adds new pair <original_url, short_url> to database,
+// insertRow carries interstitial mode, validated metadata, password hash, click limit and activation window of request
+func (s *Server) create(ctx context.Context, req *pb.CreateRequest, insertRow db.Row) (*pb.CreateResponse, error) {
 	shortURL := s.shortener.Short(req.GetOriginalUrl())
 
-	insertRow := db.Row{OriginalURL: req.GetOriginalUrl(), ShortURL: shortURL}
-	if err := s.db.Add(ctx, insertRow); err != nil {
+	insertRow.OriginalURL = req.GetOriginalUrl()
+	insertRow.ShortURL = shortURL
+	insertRow.Source = linkSources[req.GetSource()]
+	if identity, ok := auth.FromContext(ctx); ok {
+		insertRow.Owner = identity.Name
+	}
+	stored, err := s.db.Add(ctx, insertRow)
+	if err != nil {
 		log.Errorf("create: cannot add row original_url=%s: %v", req.GetOriginalUrl(), err)
-		return &pb.CreateResponse{}, status.Error(codes.Unknown, "cannot add row")
+		return &pb.CreateResponse{}, dbStatusError(err, "cannot add row")
+	}
+
+	// original URL can be already stored with another short URL
+	if stored.ShortURL != shortURL {
+		log.Debugf("create: original=%s is stored with short=%s instead of %s", req.GetOriginalUrl(), stored.ShortURL, shortURL)
+	}
+	if err := existingLinkError(stored, insertRow, req.GetPassword()); err != nil {
+		log.Infof("create: original=%s short=%s: %v", req.GetOriginalUrl(), stored.ShortURL, err)
+		return &pb.CreateResponse{}, err
 	}
 
 	// until no database success insert we can't update cache
-	s.lruOrigShort.Add(req.GetOriginalUrl(), shortURL)
+	s.lruOrigShort.Add(req.GetOriginalUrl(), stored.ShortURL)
+	s.lruShortOrig.Add(stored.ShortURL, stored)
 
-	log.Debugf("create: original=%s short=%s (DB)", req.GetOriginalUrl(), shortURL)
+	log.Debugf("create: original=%s short=%s (DB)", req.GetOriginalUrl(), stored.ShortURL)
 
-	return &pb.CreateResponse{ShortUrl: shortURL}, nil
+	return &pb.CreateResponse{ShortUrl: stored.ShortURL, OriginalUrl: stored.OriginalURL}, nil
 }
 
 // Get returns original URL by corresponding short URL
 func (s *Server) Get(ctx context.Context, req *pb.GetRequest) (*pb.GetResponse, error) {
 	if req.GetShortUrl() == "" {
 		log.Debug("get: empty URL")
-		return &pb.GetResponse{}, status.Error(codes.Unknown, "empty short URL hasn't original URL")
+		return &pb.GetResponse{}, status.Error(codes.InvalidArgument, "empty short URL hasn't original URL")
 	}
 
-	originalURL, ok := s.lruShortOrig.Get(req.ShortUrl)
-	if ok {
-		log.Debugf("get: short=%s original=%s (LRU)", req.GetShortUrl(), originalURL)
-		return &pb.GetResponse{OriginalUrl: originalURL.(string)}, nil
+	row, err := s.row(ctx, req.GetShortUrl())
+	if err != nil {
+		return &pb.GetResponse{}, err
+	}
+	if err := disabledError(row); err != nil {
+		return &pb.GetResponse{}, err
+	}
+	if err := checkPassword(ctx, row, req.GetPassword()); err != nil {
+		return &pb.GetResponse{}, err
+	}
+	now := s.now()
+	url, active, err := destination(row, now)
+	if err != nil {
+		return &pb.GetResponse{}, err
+	}
+	resp := &pb.GetResponse{
+		OriginalUrl: url,
+		Metadata:    publicMetadataToProto(row.Metadata),
+		Inactive:    !active,
+		NoCache:     row.MaxClicks != 0,
+	}
+	if until := validUntil(row, now); !until.IsZero() {
+		resp.ValidUntil = timestamppb.New(until)
+	}
+	// fallback resolutions don't take clicks
+	if active {
+		if resp.ClicksLeft, err = s.useClick(ctx, row); err != nil {
+			return &pb.GetResponse{}, err
+		}
 	}
-	return s.get(ctx, req)
+	return resp, nil
 }
 
-// get requests database for original URL
-func (s *Server) get(ctx context.Context, req *pb.GetRequest) (*pb.GetResponse, error) {
-	originalURL, err := s.db.GetOriginalURL(ctx, req.GetShortUrl())
+// row returns row by short URL from cache or database
+func (s *Server) row(ctx context.Context, shortURL string) (db.Row, error) {
+	cached, ok := s.lruShortOrig.Get(shortURL)
+	if ok {
+		if !s.serveCached() {
+			return db.Row{}, status.Error(codes.Unavailable, "database is unavailable")
+		}
+		log.Debugf("get: short=%s original=%s (LRU)", shortURL, cached.(db.Row).OriginalURL)
+		return cached.(db.Row), nil
+	}
+
+	row, err := s.db.GetRow(ctx, shortURL)
 	if err != nil {
 		if errors.Is(err, &db.NoRowError{}) {
-			log.Debugf("get: no pair to provided short_url=%s", req.ShortUrl)
-			return &pb.GetResponse{}, status.Error(codes.NotFound, "no pair to provided short URL")
-		} else {
-			log.Errorf("get: cannot get row with short_url=%s: %v", req.ShortUrl, err)
-			return &pb.GetResponse{}, status.Error(codes.Unknown, "cannot get original URL")
+			log.Debugf("get: no pair to provided short_url=%s", shortURL)
+			return db.Row{}, status.Error(codes.NotFound, "no pair to provided short URL")
 		}
+		log.Errorf("get: cannot get row with short_url=%s: %v", shortURL, err)
+		return db.Row{}, dbStatusError(err, "cannot get original URL")
 	}
 
 	// until no database success select we can't update cache
-	s.lruShortOrig.Add(req.GetShortUrl(), originalURL)
+	s.lruShortOrig.Add(shortURL, row)
+
+	log.Debugf("get: short=%s original=%s (DB)", shortURL, row.OriginalURL)
+
+	return row, nil
+}
+
+// Visit returns link of short URL to redirect to for request attributes and counts its click,
+// original URL of link is its resolved destination
+func (s *Server) Visit(ctx context.Context, req *pb.ResolveRequest) (*pb.Link, error) {
+	shortURL := req.GetShortUrl()
+	if shortURL == "" {
+		return nil, status.Error(codes.InvalidArgument, "empty short URL hasn't original URL")
+	}
+
+	row, err := s.row(ctx, shortURL)
+	if err != nil {
+		return nil, err
+	}
+	if err := disabledError(row); err != nil {
+		return nil, err
+	}
+	// password is passed by frontend in incoming metadata
+	if err := checkPassword(ctx, row, req.GetPassword()); err != nil {
+		return nil, err
+	}
+	res, err := s.resolveRow(row, req)
+	if err != nil {
+		return nil, err
+	}
+	if s.policy != nil && s.policy.CheckRedirects() {
+		if err := s.checkPolicy(res.url); err != nil {
+			log.Infof("visit: blocked short=%s destination=%s: %v", shortURL, res.url, err)
+			return nil, err
+		}
+	}
+	if res.active {
+		if row.ClicksLeft, err = s.useClick(ctx, row); err != nil {
+			return nil, err
+		}
+		s.clicks.add(shortURL, 1)
+		if res.variant != 0 {
+			s.clicks.addVariant(shortURL, res.variant-1, 1)
+		}
+	}
+
+	link := s.link(row)
+	link.OriginalUrl = res.url
+	return link, nil
+}
+
+// Preview returns public link fields without counting click, owner, notes,
+// link history and conditional destinations are returned by GetLinkInfo
+func (s *Server) Preview(ctx context.Context, req *pb.PreviewRequest) (*pb.PreviewResponse, error) {
+	if req.GetShortUrl() == "" {
+		return &pb.PreviewResponse{}, status.Error(codes.InvalidArgument, "empty short URL hasn't original URL")
+	}
+
+	// clicks count isn't cached
+	row, err := s.db.GetRow(ctx, req.GetShortUrl())
+	if err != nil {
+		if errors.Is(err, &db.NoRowError{}) {
+			return &pb.PreviewResponse{}, status.Error(codes.NotFound, "no pair to provided short URL")
+		}
+		log.Errorf("preview: cannot get row with short_url=%s: %v", req.GetShortUrl(), err)
+		return &pb.PreviewResponse{}, dbStatusError(err, "cannot get link")
+	}
+	if err := disabledError(row); err != nil {
+		return &pb.PreviewResponse{}, err
+	}
+	if err := checkPassword(ctx, row, req.GetPassword()); err != nil {
+		return &pb.PreviewResponse{}, err
+	}
+	url, _, err := destination(row, s.now())
+	if err != nil {
+		return &pb.PreviewResponse{}, err
+	}
+	row.Clicks += s.clicks.pending(req.GetShortUrl())
+
+	link := s.link(row)
+	link.OriginalUrl = url
+	link.Owner, link.UpdatedAt, link.Source, link.FallbackUrl = "", nil, pb.LinkSource_LINK_SOURCE_UNSPECIFIED, ""
+	link.Rules, link.CountryUrls, link.Variants = nil, nil, nil
+	link.Metadata = publicMetadataToProto(row.Metadata)
+	return &pb.PreviewResponse{Link: link}, nil
+}
+
+// link converts row to link, interstitial page is shown for all links in interstitial mode
+func (s *Server) link(row db.Row) *pb.Link {
+	link := &pb.Link{
+		ShortUrl:          row.ShortURL,
+		OriginalUrl:       row.OriginalURL,
+		Clicks:            row.Clicks,
+		Interstitial:      row.Interstitial || s.interstitial,
+		Owner:             row.Owner,
+		Disabled:          row.Disabled,
+		DisabledReason:    row.DisabledReason,
+		Metadata:          metadataToProto(row.Metadata),
+		Source:            linkSourceToProto(row.Source),
+		PasswordProtected: row.PasswordHash != "",
+		MaxClicks:         row.MaxClicks,
+		ClicksLeft:        row.ClicksLeft,
+		FallbackUrl:       row.FallbackURL,
+		Inactive:          !isActive(row, s.now()),
+		Rules:             rulesToProto(row.Rules),
+		CountryUrls:       row.CountryURLs,
+		Variants:          variantsToProto(row.Variants),
+	}
+	if !row.CreatedAt.IsZero() {
+		link.CreatedAt = timestamppb.New(row.CreatedAt)
+	}
+	if !row.UpdatedAt.IsZero() {
+		link.UpdatedAt = timestamppb.New(row.UpdatedAt)
+	}
+	if !row.NotBefore.IsZero() {
+		link.NotBefore = timestamppb.New(row.NotBefore)
+	}
+	if !row.NotAfter.IsZero() {
+		link.NotAfter = timestamppb.New(row.NotAfter)
+	}
+	return link
+}
 
-	log.Debugf("get: short=%s original=%s (DB)", req.GetShortUrl(), originalURL)
+// GetQRCode renders QR code of full short URL
+func (s *Server) GetQRCode(ctx context.Context, req *pb.GetQRCodeRequest) (*pb.GetQRCodeResponse, error) {
+	// QR code of not existing short URL is useless, QR code of password
+	// protected link doesn't reveal original URL
+	if req.GetShortUrl() == "" {
+		return &pb.GetQRCodeResponse{}, status.Error(codes.InvalidArgument, "empty short URL hasn't original URL")
+	}
+	row, err := s.row(ctx, req.GetShortUrl())
+	if err != nil {
+		return &pb.GetQRCodeResponse{}, err
+	}
+	if err := disabledError(row); err != nil {
+		return &pb.GetQRCodeResponse{}, err
+	}
 
-	return &pb.GetResponse{OriginalUrl: originalURL}, nil
+	level, ok := qrLevels[req.GetLevel()]
+	if !ok {
+		return &pb.GetQRCodeResponse{}, status.Error(codes.InvalidArgument, "unknown QR code level")
+	}
+	opts := qr.Options{Size: int(req.GetSize()), Level: level, Format: qr.FormatPNG}
+	if req.GetFormat() == pb.QRFormat_QR_FORMAT_SVG {
+		opts.Format = qr.FormatSVG
+	}
+
+	url := s.publicURL + "/" + req.GetShortUrl()
+	image, contentType, err := qr.Render(url, opts)
+	if err != nil {
+		if errors.Is(err, qr.ErrSize) {
+			return &pb.GetQRCodeResponse{}, status.Error(codes.InvalidArgument, err.Error())
+		}
+		log.Errorf("qr: cannot render QR code of short=%s: %v", req.GetShortUrl(), err)
+		return &pb.GetQRCodeResponse{}, status.Error(codes.Unknown, "cannot render QR code")
+	}
+
+	return &pb.GetQRCodeResponse{Url: url, Image: image, ContentType: contentType}, nil
+}
+
+var qrLevels = map[pb.QRLevel]qr.Level{
+	pb.QRLevel_QR_LEVEL_UNSPECIFIED: qr.LevelMedium,
+	pb.QRLevel_QR_LEVEL_LOW:         qr.LevelLow,
+	pb.QRLevel_QR_LEVEL_MEDIUM:      qr.LevelMedium,
+	pb.QRLevel_QR_LEVEL_HIGH:        qr.LevelHigh,
+	pb.QRLevel_QR_LEVEL_HIGHEST:     qr.LevelHighest,
+}
+
+// serveCached checks cached URLs can be served: database is available or degraded mode is enabled
+func (s *Server) serveCached() bool {
+	if a, ok := s.db.(availability); ok && !a.Available() {
+		return s.degradedMode
+	}
+	return true
+}
+
+// dbStatusError converts database error to Unavailable status if database is unavailable
+// and to Unknown status with given message otherwise
+func dbStatusError(err error, msg string) error {
+	unavailableErr := &db.UnavailableError{}
+	if errors.As(err, &unavailableErr) {
+		return status.Error(codes.Unavailable, "database is unavailable")
+	}
+	return status.Error(codes.Unknown, msg)
+}
+
+// reasonError returns status with ErrorInfo detail of reason, so clients tell apart errors of the same code
+func reasonError(code codes.Code, reason, msg string) error {
+	st, err := status.New(code, msg).WithDetails(&errdetails.ErrorInfo{Reason: reason})
+	if err != nil {
+		return status.Error(code, msg)
+	}
+	return st.Err()
 }
@@ -3,8 +3,22 @@ package server
 import (
 	"context"
 	"github.com/stretchr/testify/assert"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"sort"
+	"strconv"
+	"strings"
 	"testing"
+	"time"
+	"url_shortener/pkg/auth"
+	"url_shortener/pkg/config"
+	"url_shortener/pkg/geoip"
 	"url_shortener/pkg/grpc"
+	"url_shortener/pkg/policy"
 	"url_shortener/pkg/short"
 )
 import "url_shortener/pkg/db"
@@ -12,18 +26,64 @@ import "url_shortener/pkg/db"
 type dbMock struct {
 	originalShort map[string]string
 	shortOriginal map[string]string
+	interstitial  map[string]bool
+	clicks        map[string]int64
+	// short URL -> disabled reason
+	disabled map[string]string
+	owner    map[string]string
+	metadata map[string]db.Metadata
+	source   map[string]string
+	password map[string]string
+	// short URL -> clicks left of click limited links
+	clicksLeft map[string]int64
+	maxClicks  map[string]int64
+	// short URL -> row with activation window and fallback URL
+	window      map[string]db.Row
+	rules       map[string]db.Rules
+	countryURLs map[string]db.CountryURLs
+	variants    map[string]db.Variants
 }
 
 func NewDB() *dbMock {
-	return &dbMock{originalShort: map[string]string{}, shortOriginal: map[string]string{}}
+	return &dbMock{
+		originalShort: map[string]string{},
+		shortOriginal: map[string]string{},
+		interstitial:  map[string]bool{},
+		clicks:        map[string]int64{},
+		disabled:      map[string]string{},
+		owner:         map[string]string{},
+		metadata:      map[string]db.Metadata{},
+		source:        map[string]string{},
+		password:      map[string]string{},
+		clicksLeft:    map[string]int64{},
+		maxClicks:     map[string]int64{},
+		window:        map[string]db.Row{},
+		rules:         map[string]db.Rules{},
+		countryURLs:   map[string]db.CountryURLs{},
+		variants:      map[string]db.Variants{},
+	}
 }
 
 func (d *dbMock) Close() error { return nil }
 
-func (d *dbMock) Add(_ context.Context, row db.Row) error {
+func (d *dbMock) Add(_ context.Context, row db.Row) (db.Row, error) {
+	if shortURL, ok := d.originalShort[row.OriginalURL]; ok {
+		return d.GetRow(context.Background(), shortURL)
+	}
 	d.originalShort[row.OriginalURL] = row.ShortURL
 	d.shortOriginal[row.ShortURL] = row.OriginalURL
-	return nil
+	d.interstitial[row.ShortURL] = row.Interstitial
+	d.owner[row.ShortURL] = row.Owner
+	d.metadata[row.ShortURL] = row.Metadata
+	d.source[row.ShortURL] = row.Source
+	d.password[row.ShortURL] = row.PasswordHash
+	d.maxClicks[row.ShortURL] = row.MaxClicks
+	d.clicksLeft[row.ShortURL] = row.MaxClicks
+	d.window[row.ShortURL] = db.Row{NotBefore: row.NotBefore, NotAfter: row.NotAfter, FallbackURL: row.FallbackURL}
+	d.rules[row.ShortURL] = row.Rules
+	d.countryURLs[row.ShortURL] = row.CountryURLs
+	d.variants[row.ShortURL] = row.Variants
+	return d.GetRow(context.Background(), row.ShortURL)
 }
 
 func (d *dbMock) GetOriginalURL(_ context.Context, shortURL string) (string, error) {
@@ -34,6 +94,129 @@ func (d *dbMock) GetOriginalURL(_ context.Context, shortURL string) (string, err
 	return originalURL, nil
 }
 
+func (d *dbMock) GetShortURL(_ context.Context, originalURL string) (string, error) {
+	shortURL, ok := d.originalShort[originalURL]
+	if !ok {
+		return "", &db.NoRowError{}
+	}
+	return shortURL, nil
+}
+
+func (d *dbMock) GetRow(_ context.Context, shortURL string) (db.Row, error) {
+	originalURL, ok := d.shortOriginal[shortURL]
+	if !ok {
+		return db.Row{}, &db.NoRowError{}
+	}
+	reason, disabled := d.disabled[shortURL]
+	return db.Row{
+		OriginalURL:    originalURL,
+		ShortURL:       shortURL,
+		Interstitial:   d.interstitial[shortURL],
+		Owner:          d.owner[shortURL],
+		Metadata:       d.metadata[shortURL],
+		Source:         d.source[shortURL],
+		PasswordHash:   d.password[shortURL],
+		MaxClicks:      d.maxClicks[shortURL],
+		ClicksLeft:     d.clicksLeft[shortURL],
+		NotBefore:      d.window[shortURL].NotBefore,
+		NotAfter:       d.window[shortURL].NotAfter,
+		FallbackURL:    d.window[shortURL].FallbackURL,
+		Rules:          d.rules[shortURL],
+		CountryURLs:    d.countryURLs[shortURL],
+		Variants:       d.variants[shortURL],
+		CreatedAt:      time.Date(2021, 8, 30, 10, 0, 0, 0, time.UTC),
+		UpdatedAt:      time.Date(2021, 8, 31, 10, 0, 0, 0, time.UTC),
+		Clicks:         d.clicks[shortURL],
+		Disabled:       disabled,
+		DisabledReason: reason,
+	}, nil
+}
+
+func (d *dbMock) UseClick(_ context.Context, shortURL string) (int64, error) {
+	if d.maxClicks[shortURL] == 0 || d.clicksLeft[shortURL] == 0 {
+		return 0, &db.ExhaustedError{}
+	}
+	d.clicksLeft[shortURL]--
+	return d.clicksLeft[shortURL], nil
+}
+
+func (d *dbMock) AddClicks(_ context.Context, shortURL string, n int64) error {
+	d.clicks[shortURL] += n
+	return nil
+}
+
+func (d *dbMock) AddVariantClicks(_ context.Context, shortURL string, variant int, n int64) error {
+	if variant < len(d.variants[shortURL]) {
+		d.variants[shortURL][variant].Clicks += n
+	}
+	return nil
+}
+
+func (d *dbMock) ListRows(ctx context.Context, after string, limit int) ([]db.Row, error) {
+	shortURLs := make([]string, 0, len(d.shortOriginal))
+	for shortURL := range d.shortOriginal {
+		if shortURL > after {
+			shortURLs = append(shortURLs, shortURL)
+		}
+	}
+	sort.Strings(shortURLs)
+	if len(shortURLs) > limit {
+		shortURLs = shortURLs[:limit]
+	}
+
+	rows := make([]db.Row, 0, len(shortURLs))
+	for _, shortURL := range shortURLs {
+		row, _ := d.GetRow(ctx, shortURL)
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+func (d *dbMock) DisableRow(_ context.Context, shortURL, reason string) error {
+	d.disabled[shortURL] = reason
+	return nil
+}
+
+// FindRows supports owner filter and short URL order only
+func (d *dbMock) FindRows(ctx context.Context, f db.Filter) ([]db.Row, error) {
+	after := ""
+	if f.After != nil {
+		after = f.After.ShortURL
+	}
+	all, _ := d.ListRows(ctx, after, len(d.shortOriginal))
+
+	rows := []db.Row{}
+	for _, row := range all {
+		if f.Owner != "" && row.Owner != f.Owner {
+			continue
+		}
+		if len(rows) == f.Limit {
+			break
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+func (d *dbMock) UpdateMetadata(_ context.Context, shortURL string, m db.Metadata, fields []string) (db.Metadata, error) {
+	if _, ok := d.shortOriginal[shortURL]; !ok {
+		return db.Metadata{}, &db.NoRowError{}
+	}
+	updated := d.metadata[shortURL]
+	for _, field := range fields {
+		switch field {
+		case db.MetadataTitle:
+			updated.Title = m.Title
+		case db.MetadataNotes:
+			updated.Notes = m.Notes
+		case db.MetadataTags:
+			updated.Tags = m.Tags
+		}
+	}
+	d.metadata[shortURL] = updated
+	return updated, nil
+}
+
 func initAll(lruSize int) (*Server, *dbMock, short.Shortener, error) {
 	_db := NewDB()
 	_sh := short.New()
@@ -64,12 +247,29 @@ func TestServer_Create(t *testing.T) {
 	}
 }
 
+func TestServer_CreateExisting(t *testing.T) {
+	serv, _db, _, err := initAll(10)
+	assert.Nil(t, err)
+
+	_db.originalShort["a"] = "custom"
+	_db.shortOriginal["custom"] = "a"
+
+	resp, err := serv.Create(context.Background(), &grpc.CreateRequest{OriginalUrl: "a"})
+	assert.Nil(t, err)
+	assert.Equal(t, "custom", resp.GetShortUrl())
+
+	// cached
+	resp, err = serv.Create(context.Background(), &grpc.CreateRequest{OriginalUrl: "a"})
+	assert.Nil(t, err)
+	assert.Equal(t, "custom", resp.GetShortUrl())
+}
+
 func TestServer_CreateEmpty(t *testing.T) {
 	serv, _, _, err := initAll(10)
 	assert.Nil(t, err)
 
 	_, err = serv.Create(context.Background(), &grpc.CreateRequest{OriginalUrl: ""})
-	assert.NotNil(t, err)
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
 }
 
 func TestServer_Get(t *testing.T) {
@@ -97,7 +297,7 @@ func TestServer_GetNotExist(t *testing.T) {
 	assert.Nil(t, err)
 
 	_, err = serv.Get(context.Background(), &grpc.GetRequest{ShortUrl: "not exist"})
-	assert.NotNil(t, err)
+	assert.Equal(t, codes.NotFound, status.Code(err))
 }
 
 func TestServer_GetEmpty(t *testing.T) {
@@ -105,5 +305,1039 @@ func TestServer_GetEmpty(t *testing.T) {
 	assert.Nil(t, err)
 
 	_, err = serv.Get(context.Background(), &grpc.GetRequest{ShortUrl: ""})
-	assert.NotNil(t, err)
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+// unavailableDB database with open circuit breaker
+type unavailableDB struct {
+	*dbMock
+}
+
+func (d *unavailableDB) Available() bool { return false }
+
+func (d *unavailableDB) GetOriginalURL(context.Context, string) (string, error) {
+	return "", &db.UnavailableError{}
+}
+
+func (d *unavailableDB) GetRow(context.Context, string) (db.Row, error) {
+	return db.Row{}, &db.UnavailableError{}
+}
+
+func (d *unavailableDB) AddClicks(context.Context, string, int64) error {
+	return &db.UnavailableError{}
+}
+
+func (d *unavailableDB) AddVariantClicks(context.Context, string, int, int64) error {
+	return &db.UnavailableError{}
+}
+
+func TestServer_GetUnavailable(t *testing.T) {
+	for _, degradedMode := range []bool{false, true} {
+		_db := &unavailableDB{dbMock: NewDB()}
+		serv, err := New(10, _db, short.New(), WithDegradedMode(degradedMode))
+		assert.Nil(t, err)
+
+		serv.lruShortOrig.Add("cached", db.Row{OriginalURL: "original", ShortURL: "cached"})
+
+		resp, err := serv.Get(context.Background(), &grpc.GetRequest{ShortUrl: "cached"})
+		if degradedMode {
+			assert.Nil(t, err)
+			assert.Equal(t, "original", resp.GetOriginalUrl())
+		} else {
+			assert.Equal(t, codes.Unavailable, status.Code(err))
+		}
+
+		_, err = serv.Get(context.Background(), &grpc.GetRequest{ShortUrl: "not cached"})
+		assert.Equal(t, codes.Unavailable, status.Code(err))
+	}
+}
+
+func TestServer_GetQRCode(t *testing.T) {
+	_db := NewDB()
+	serv, err := New(10, _db, short.New(), WithPublicURL("https://sho.rt/"))
+	assert.Nil(t, err)
+
+	_db.shortOriginal["3PjSsTTFog"] = "google.com"
+
+	resp, err := serv.GetQRCode(context.Background(), &grpc.GetQRCodeRequest{ShortUrl: "3PjSsTTFog"})
+	assert.Nil(t, err)
+	assert.Equal(t, "https://sho.rt/3PjSsTTFog", resp.GetUrl())
+	assert.Equal(t, "image/png", resp.GetContentType())
+	assert.NotEmpty(t, resp.GetImage())
+
+	resp, err = serv.GetQRCode(context.Background(), &grpc.GetQRCodeRequest{
+		ShortUrl: "3PjSsTTFog",
+		Size:     512,
+		Level:    grpc.QRLevel_QR_LEVEL_HIGH,
+		Format:   grpc.QRFormat_QR_FORMAT_SVG,
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, "image/svg+xml", resp.GetContentType())
+
+	_, err = serv.GetQRCode(context.Background(), &grpc.GetQRCodeRequest{ShortUrl: "3PjSsTTFog", Size: 10})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	_, err = serv.GetQRCode(context.Background(), &grpc.GetQRCodeRequest{ShortUrl: "3PjSsTTFog", Level: 100})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	_, err = serv.GetQRCode(context.Background(), &grpc.GetQRCodeRequest{ShortUrl: "not exist"})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+}
+
+func TestServer_VisitPreview(t *testing.T) {
+	_db := NewDB()
+	serv, err := New(10, _db, short.New())
+	assert.Nil(t, err)
+
+	resp, err := serv.Create(context.Background(), &grpc.CreateRequest{OriginalUrl: "google.com", Interstitial: true})
+	assert.Nil(t, err)
+	shortURL := resp.GetShortUrl()
+
+	for i := 0; i < 3; i++ {
+		link, err := serv.Visit(context.Background(), &grpc.ResolveRequest{ShortUrl: shortURL})
+		assert.Nil(t, err)
+		assert.Equal(t, "google.com", link.GetOriginalUrl())
+		assert.True(t, link.GetInterstitial())
+	}
+
+	// not flushed clicks are counted
+	preview, err := serv.Preview(context.Background(), &grpc.PreviewRequest{ShortUrl: shortURL})
+	assert.Nil(t, err)
+	assert.Equal(t, int64(3), preview.GetLink().GetClicks())
+	assert.Equal(t, "google.com", preview.GetLink().GetOriginalUrl())
+	assert.Equal(t, time.Date(2021, 8, 30, 10, 0, 0, 0, time.UTC), preview.GetLink().GetCreatedAt().AsTime())
+
+	serv.FlushClicks(context.Background())
+	assert.Equal(t, int64(3), _db.clicks[shortURL])
+
+	preview, err = serv.Preview(context.Background(), &grpc.PreviewRequest{ShortUrl: shortURL})
+	assert.Nil(t, err)
+	assert.Equal(t, int64(3), preview.GetLink().GetClicks())
+
+	_, err = serv.Visit(context.Background(), &grpc.ResolveRequest{ShortUrl: "not exist"})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+	_, err = serv.Preview(context.Background(), &grpc.PreviewRequest{ShortUrl: "not exist"})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+	_, err = serv.Preview(context.Background(), &grpc.PreviewRequest{})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestServer_Interstitial(t *testing.T) {
+	_db := NewDB()
+	serv, err := New(10, _db, short.New(), WithInterstitial(true))
+	assert.Nil(t, err)
+
+	resp, err := serv.Create(context.Background(), &grpc.CreateRequest{OriginalUrl: "google.com"})
+	assert.Nil(t, err)
+
+	link, err := serv.Visit(context.Background(), &grpc.ResolveRequest{ShortUrl: resp.GetShortUrl()})
+	assert.Nil(t, err)
+	assert.True(t, link.GetInterstitial())
+}
+
+func TestServer_CreateExistingInterstitial(t *testing.T) {
+	serv, _db, _, err := initAll(10)
+	assert.Nil(t, err)
+	uncached, err := New(10, _db, short.New())
+	assert.Nil(t, err)
+
+	direct, err := serv.Create(context.Background(), &grpc.CreateRequest{OriginalUrl: "https://example.com/direct"})
+	assert.Nil(t, err)
+	confirmed, err := serv.Create(context.Background(), &grpc.CreateRequest{OriginalUrl: "https://example.com/confirmed", Interstitial: true})
+	assert.Nil(t, err)
+
+	for _, s := range []*Server{serv, uncached} {
+		_, err = s.Create(context.Background(), &grpc.CreateRequest{OriginalUrl: "https://example.com/direct", Interstitial: true})
+		assert.Equal(t, codes.AlreadyExists, status.Code(err))
+		_, err = s.Create(context.Background(), &grpc.CreateRequest{OriginalUrl: "https://example.com/confirmed"})
+		assert.Equal(t, codes.AlreadyExists, status.Code(err))
+
+		resp, err := s.Create(context.Background(), &grpc.CreateRequest{OriginalUrl: "https://example.com/direct"})
+		assert.Nil(t, err)
+		assert.Equal(t, direct.GetShortUrl(), resp.GetShortUrl())
+		resp, err = s.Create(context.Background(), &grpc.CreateRequest{OriginalUrl: "https://example.com/confirmed", Interstitial: true})
+		assert.Nil(t, err)
+		assert.Equal(t, confirmed.GetShortUrl(), resp.GetShortUrl())
+	}
+}
+
+func TestServer_FlushClicksFailed(t *testing.T) {
+	_db := &unavailableDB{dbMock: NewDB()}
+	serv, err := New(10, _db, short.New())
+	assert.Nil(t, err)
+
+	serv.clicks.add("short", 2)
+	serv.clicks.addVariant("short", 1, 1)
+	serv.FlushClicks(context.Background())
+	assert.Equal(t, int64(2), serv.clicks.pending("short"))
+	assert.Equal(t, int64(1), serv.clicks.pendingVariant("short", 1))
+}
+
+func TestServer_Policy(t *testing.T) {
+	p, err := policy.New(config.PolicyConfig{
+		Enabled:        true,
+		Blocklist:      []string{"phishing.example"},
+		CheckRedirects: true,
+	})
+	assert.Nil(t, err)
+
+	_db := NewDB()
+	serv, err := New(10, _db, short.New(), WithPolicy(p))
+	assert.Nil(t, err)
+
+	_, err = serv.Create(context.Background(), &grpc.CreateRequest{OriginalUrl: "https://login.phishing.example/account"})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	_, err = serv.Create(context.Background(), &grpc.CreateRequest{OriginalUrl: "javascript:alert(1)"})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	resp, err := serv.Create(context.Background(), &grpc.CreateRequest{OriginalUrl: "https://example.com"})
+	assert.Nil(t, err)
+	_, err = serv.Visit(context.Background(), &grpc.ResolveRequest{ShortUrl: resp.GetShortUrl()})
+	assert.Nil(t, err)
+
+	// link created before rule is added
+	_db.originalShort["https://phishing.example"] = "old"
+	_db.shortOriginal["old"] = "https://phishing.example"
+
+	_, err = serv.Visit(context.Background(), &grpc.ResolveRequest{ShortUrl: "old"})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+}
+
+func TestServer_ApplyPolicy(t *testing.T) {
+	p, err := policy.New(config.PolicyConfig{
+		Enabled:   true,
+		Blocklist: []string{"phishing.example #phishing"},
+	})
+	assert.Nil(t, err)
+
+	_db := NewDB()
+	for shortURL, originalURL := range map[string]string{
+		"a": "https://example.com",
+		"b": "https://phishing.example/login",
+		"c": "https://www.phishing.example",
+	} {
+		_db.originalShort[originalURL] = shortURL
+		_db.shortOriginal[shortURL] = originalURL
+	}
+
+	serv, err := New(10, _db, short.New(), WithPolicy(p))
+	assert.Nil(t, err)
+
+	// cached before disabling
+	_, err = serv.Get(context.Background(), &grpc.GetRequest{ShortUrl: "b"})
+	assert.Nil(t, err)
+
+	resp, err := serv.ApplyPolicy(context.Background(), &grpc.ApplyPolicyRequest{DryRun: true})
+	assert.Nil(t, err)
+	assert.Equal(t, int64(3), resp.GetChecked())
+	assert.Len(t, resp.GetBlocked(), 2)
+	assert.Empty(t, _db.disabled)
+
+	resp, err = serv.ApplyPolicy(context.Background(), &grpc.ApplyPolicyRequest{})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"b", "c"}, []string{resp.GetBlocked()[0].GetShortUrl(), resp.GetBlocked()[1].GetShortUrl()})
+	assert.Equal(t, map[string]string{"b": "phishing", "c": "phishing"}, _db.disabled)
+
+	_, err = serv.Get(context.Background(), &grpc.GetRequest{ShortUrl: "b"})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+	_, err = serv.Get(context.Background(), &grpc.GetRequest{ShortUrl: "a"})
+	assert.Nil(t, err)
+
+	// disabled links aren't checked again
+	resp, err = serv.ApplyPolicy(context.Background(), &grpc.ApplyPolicyRequest{})
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), resp.GetChecked())
+	assert.Empty(t, resp.GetBlocked())
+
+	// rule destinations are checked too
+	_db.rules["a"] = db.Rules{{Device: db.DeviceIOS, DestinationURL: "https://phishing.example/app"}}
+	resp, err = serv.ApplyPolicy(context.Background(), &grpc.ApplyPolicyRequest{})
+	assert.Nil(t, err)
+	assert.Len(t, resp.GetBlocked(), 1)
+	assert.Equal(t, "destination https://phishing.example/app: phishing", _db.disabled["a"])
+}
+
+func TestServer_CreateChain(t *testing.T) {
+	_db := NewDB()
+	serv, err := New(10, _db, short.New(), WithChains(config.ChainsConfig{Shorteners: []string{"bit.ly"}}, "https://sho.rt"))
+	assert.Nil(t, err)
+
+	resp, err := serv.Create(context.Background(), &grpc.CreateRequest{OriginalUrl: "https://example.com"})
+	assert.Nil(t, err)
+
+	// link to own short link is the same link
+	chained, err := serv.Create(context.Background(), &grpc.CreateRequest{OriginalUrl: "https://sho.rt/" + resp.GetShortUrl()})
+	assert.Nil(t, err)
+	assert.Equal(t, resp.GetShortUrl(), chained.GetShortUrl())
+	assert.Equal(t, "https://example.com", chained.GetOriginalUrl())
+
+	_, err = serv.Create(context.Background(), &grpc.CreateRequest{OriginalUrl: "https://sho.rt/notexist"})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	_, err = serv.Create(context.Background(), &grpc.CreateRequest{OriginalUrl: "https://bit.ly/abc"})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	// loop created before chains detection
+	_db.originalShort["https://sho.rt/loop"] = "loop"
+	_db.shortOriginal["loop"] = "https://sho.rt/loop"
+
+	_, err = serv.Create(context.Background(), &grpc.CreateRequest{OriginalUrl: "https://sho.rt/loop"})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestServer_ListLinks(t *testing.T) {
+	serv, _db, _, err := initAll(10)
+	assert.Nil(t, err)
+
+	for _, shortURL := range []string{"a", "b", "c", "d", "e"} {
+		_db.originalShort["original "+shortURL] = shortURL
+		_db.shortOriginal[shortURL] = "original " + shortURL
+	}
+
+	req := &grpc.ListLinksRequest{PageSize: 2, Order: grpc.ListOrder_LIST_ORDER_SHORT_URL}
+	var shortURLs []string
+	for pages := 1; ; pages++ {
+		resp, err := serv.ListLinks(context.Background(), req)
+		assert.Nil(t, err)
+		for _, link := range resp.GetLinks() {
+			shortURLs = append(shortURLs, link.GetShortUrl())
+		}
+		if resp.GetNextPageToken() == "" {
+			assert.Equal(t, 3, pages)
+			break
+		}
+		req.PageToken = resp.GetNextPageToken()
+	}
+	assert.Equal(t, []string{"a", "b", "c", "d", "e"}, shortURLs)
+
+	// token of other filters
+	resp, err := serv.ListLinks(context.Background(), &grpc.ListLinksRequest{PageSize: 2})
+	assert.Nil(t, err)
+	_, err = serv.ListLinks(context.Background(), &grpc.ListLinksRequest{PageSize: 2, PageToken: resp.GetNextPageToken(), Owner: "oncall"})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	_, err = serv.ListLinks(context.Background(), &grpc.ListLinksRequest{PageToken: "invalid"})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	_, err = serv.ListLinks(context.Background(), &grpc.ListLinksRequest{PageSize: -1})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	_, err = serv.ListLinks(context.Background(), &grpc.ListLinksRequest{Domain: "http://"})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestServer_CreateOwner(t *testing.T) {
+	serv, _db, _, err := initAll(10)
+	assert.Nil(t, err)
+
+	ctx := auth.NewContext(context.Background(), auth.Identity{Name: "oncall"})
+	resp, err := serv.Create(ctx, &grpc.CreateRequest{OriginalUrl: "https://example.com"})
+	assert.Nil(t, err)
+	assert.Equal(t, "oncall", _db.owner[resp.GetShortUrl()])
+}
+
+func TestServer_Metadata(t *testing.T) {
+	serv, _, _, err := initAll(10)
+	assert.Nil(t, err)
+
+	owner := auth.NewContext(context.Background(), auth.Identity{Name: "oncall"})
+	resp, err := serv.Create(owner, &grpc.CreateRequest{
+		OriginalUrl: "https://example.com",
+		Metadata:    &grpc.Metadata{Title: " Launch ", Tags: []string{"Q3", "promo", "q3"}},
+	})
+	assert.Nil(t, err)
+
+	get, err := serv.Get(context.Background(), &grpc.GetRequest{ShortUrl: resp.GetShortUrl()})
+	assert.Nil(t, err)
+	assert.Equal(t, "Launch", get.GetMetadata().GetTitle())
+	assert.Equal(t, []string{"promo", "q3"}, get.GetMetadata().GetTags())
+
+	update, err := serv.UpdateMetadata(owner, &grpc.UpdateMetadataRequest{
+		ShortUrl:   resp.GetShortUrl(),
+		Metadata:   &grpc.Metadata{Notes: "landing page", Title: "ignored"},
+		UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"notes"}},
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, "Launch", update.GetMetadata().GetTitle())
+	assert.Equal(t, "landing page", update.GetMetadata().GetNotes())
+
+	// cached row is updated, notes aren't public
+	get, err = serv.Get(context.Background(), &grpc.GetRequest{ShortUrl: resp.GetShortUrl()})
+	assert.Nil(t, err)
+	assert.Equal(t, &grpc.Metadata{Title: "Launch", Tags: []string{"promo", "q3"}}, get.GetMetadata())
+	info, err := serv.GetLinkInfo(owner, &grpc.GetLinkInfoRequest{ShortUrl: resp.GetShortUrl()})
+	assert.Nil(t, err)
+	assert.Equal(t, "landing page", info.GetLink().GetMetadata().GetNotes())
+
+	// all fields without mask
+	update, err = serv.UpdateMetadata(owner, &grpc.UpdateMetadataRequest{ShortUrl: resp.GetShortUrl(), Metadata: &grpc.Metadata{Tags: []string{"done"}}})
+	assert.Nil(t, err)
+	assert.Equal(t, &grpc.Metadata{Tags: []string{"done"}}, update.GetMetadata())
+
+	_, err = serv.UpdateMetadata(context.Background(), &grpc.UpdateMetadataRequest{ShortUrl: resp.GetShortUrl()})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	admin := auth.NewContext(context.Background(), auth.Identity{Name: "admin", Admin: true})
+	_, err = serv.UpdateMetadata(admin, &grpc.UpdateMetadataRequest{ShortUrl: resp.GetShortUrl()})
+	assert.Nil(t, err)
+
+	_, err = serv.UpdateMetadata(admin, &grpc.UpdateMetadataRequest{ShortUrl: "notexist"})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+
+	_, err = serv.UpdateMetadata(admin, &grpc.UpdateMetadataRequest{
+		ShortUrl:   resp.GetShortUrl(),
+		UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"owner"}},
+	})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	_, err = serv.Create(context.Background(), &grpc.CreateRequest{
+		OriginalUrl: "https://example.org",
+		Metadata:    &grpc.Metadata{Tags: []string{"two words"}},
+	})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestServer_GetLinkInfo(t *testing.T) {
+	serv, _, _, err := initAll(10)
+	assert.Nil(t, err)
+
+	owner := auth.NewContext(context.Background(), auth.Identity{Name: "oncall"})
+	resp, err := serv.Create(owner, &grpc.CreateRequest{
+		OriginalUrl: "https://example.com",
+		Metadata:    &grpc.Metadata{Title: "Launch", Notes: "internal"},
+		Source:      grpc.LinkSource_LINK_SOURCE_CLI,
+	})
+	assert.Nil(t, err)
+
+	info, err := serv.GetLinkInfo(owner, &grpc.GetLinkInfoRequest{ShortUrl: resp.GetShortUrl()})
+	assert.Nil(t, err)
+	assert.Equal(t, "https://example.com", info.GetLink().GetOriginalUrl())
+	assert.Equal(t, "oncall", info.GetLink().GetOwner())
+	assert.Equal(t, grpc.LinkSource_LINK_SOURCE_CLI, info.GetLink().GetSource())
+	assert.Equal(t, "internal", info.GetLink().GetMetadata().GetNotes())
+	assert.Equal(t, time.Date(2021, 8, 30, 10, 0, 0, 0, time.UTC), info.GetLink().GetCreatedAt().AsTime())
+	assert.Equal(t, time.Date(2021, 8, 31, 10, 0, 0, 0, time.UTC), info.GetLink().GetUpdatedAt().AsTime())
+
+	// preview is public
+	preview, err := serv.Preview(context.Background(), &grpc.PreviewRequest{ShortUrl: resp.GetShortUrl()})
+	assert.Nil(t, err)
+	assert.Equal(t, "Launch", preview.GetLink().GetMetadata().GetTitle())
+	assert.Empty(t, preview.GetLink().GetMetadata().GetNotes())
+	assert.Empty(t, preview.GetLink().GetOwner())
+
+	_, err = serv.GetLinkInfo(context.Background(), &grpc.GetLinkInfoRequest{ShortUrl: resp.GetShortUrl()})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	// links without owner are created with API by default
+	resp, err = serv.Create(context.Background(), &grpc.CreateRequest{OriginalUrl: "https://example.org"})
+	assert.Nil(t, err)
+	info, err = serv.GetLinkInfo(context.Background(), &grpc.GetLinkInfoRequest{ShortUrl: resp.GetShortUrl()})
+	assert.Nil(t, err)
+	assert.Equal(t, grpc.LinkSource_LINK_SOURCE_API, info.GetLink().GetSource())
+
+	_, err = serv.GetLinkInfo(context.Background(), &grpc.GetLinkInfoRequest{ShortUrl: "notexist"})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+}
+
+func TestServer_Password(t *testing.T) {
+	serv, _db, _, err := initAll(10)
+	assert.Nil(t, err)
+
+	resp, err := serv.Create(context.Background(), &grpc.CreateRequest{OriginalUrl: "https://example.com/internal", Password: "secret"})
+	assert.Nil(t, err)
+	shortURL := resp.GetShortUrl()
+
+	_, err = serv.Get(context.Background(), &grpc.GetRequest{ShortUrl: shortURL})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+	assert.True(t, IsPasswordError(err))
+
+	_, err = serv.Get(context.Background(), &grpc.GetRequest{ShortUrl: shortURL, Password: "wrong"})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+	assert.True(t, IsPasswordError(err))
+
+	get, err := serv.Get(context.Background(), &grpc.GetRequest{ShortUrl: shortURL, Password: "secret"})
+	assert.Nil(t, err)
+	assert.Equal(t, "https://example.com/internal", get.GetOriginalUrl())
+
+	// cached row requires password too
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(PasswordMetadataKey, "secret"))
+	link, err := serv.Visit(ctx, &grpc.ResolveRequest{ShortUrl: shortURL})
+	assert.Nil(t, err)
+	assert.True(t, link.GetPasswordProtected())
+	_, err = serv.Visit(context.Background(), &grpc.ResolveRequest{ShortUrl: shortURL})
+	assert.True(t, IsPasswordError(err))
+
+	_, err = serv.Preview(context.Background(), &grpc.PreviewRequest{ShortUrl: shortURL})
+	assert.True(t, IsPasswordError(err))
+
+	// info and list of link without owner don't reveal destination without password
+	info, err := serv.GetLinkInfo(context.Background(), &grpc.GetLinkInfoRequest{ShortUrl: shortURL})
+	assert.Nil(t, err)
+	assert.True(t, info.GetLink().GetPasswordProtected())
+	assert.Empty(t, info.GetLink().GetOriginalUrl())
+	info, err = serv.GetLinkInfo(ctx, &grpc.GetLinkInfoRequest{ShortUrl: shortURL})
+	assert.Nil(t, err)
+	assert.Equal(t, "https://example.com/internal", info.GetLink().GetOriginalUrl())
+	admin := auth.NewContext(context.Background(), auth.Identity{Name: "admin", Admin: true})
+	info, err = serv.GetLinkInfo(admin, &grpc.GetLinkInfoRequest{ShortUrl: shortURL})
+	assert.Nil(t, err)
+	assert.Equal(t, "https://example.com/internal", info.GetLink().GetOriginalUrl())
+
+	list, err := serv.ListLinks(context.Background(), &grpc.ListLinksRequest{})
+	assert.Nil(t, err)
+	assert.Len(t, list.GetLinks(), 1)
+	assert.Empty(t, list.GetLinks()[0].GetOriginalUrl())
+	list, err = serv.ListLinks(admin, &grpc.ListLinksRequest{})
+	assert.Nil(t, err)
+	assert.Equal(t, "https://example.com/internal", list.GetLinks()[0].GetOriginalUrl())
+
+	// QR code doesn't reveal original URL
+	_, err = serv.GetQRCode(context.Background(), &grpc.GetQRCodeRequest{ShortUrl: shortURL})
+	assert.Nil(t, err)
+
+	_, err = serv.Create(context.Background(), &grpc.CreateRequest{OriginalUrl: "https://example.org", Password: strings.Repeat("p", 73)})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	// chain to protected link would reveal destination
+	chained, err := New(10, _db, short.New(), WithChains(config.ChainsConfig{}, "https://sho.rt"))
+	assert.Nil(t, err)
+	_, err = chained.Create(context.Background(), &grpc.CreateRequest{OriginalUrl: "https://sho.rt/" + shortURL})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	// disabled links aren't password errors
+	assert.False(t, IsPasswordError(disabledError(db.Row{Disabled: true})))
+}
+
+func TestServer_CreateExistingPassword(t *testing.T) {
+	serv, _db, _, err := initAll(10)
+	assert.Nil(t, err)
+
+	plain, err := serv.Create(context.Background(), &grpc.CreateRequest{OriginalUrl: "https://example.com/doc"})
+	assert.Nil(t, err)
+	protected, err := serv.Create(context.Background(), &grpc.CreateRequest{OriginalUrl: "https://example.com/internal", Password: "secret"})
+	assert.Nil(t, err)
+
+	// cached and stored links are checked
+	uncached, err := New(10, _db, short.New())
+	assert.Nil(t, err)
+	for _, s := range []*Server{serv, uncached} {
+		_, err = s.Create(context.Background(), &grpc.CreateRequest{OriginalUrl: "https://example.com/doc", Password: "secret"})
+		assert.Equal(t, codes.AlreadyExists, status.Code(err))
+		_, err = s.Create(context.Background(), &grpc.CreateRequest{OriginalUrl: "https://example.com/internal"})
+		assert.Equal(t, codes.AlreadyExists, status.Code(err))
+		_, err = s.Create(context.Background(), &grpc.CreateRequest{OriginalUrl: "https://example.com/internal", Password: "other"})
+		assert.Equal(t, codes.AlreadyExists, status.Code(err))
+
+		resp, err := s.Create(context.Background(), &grpc.CreateRequest{OriginalUrl: "https://example.com/doc"})
+		assert.Nil(t, err)
+		assert.Equal(t, plain.GetShortUrl(), resp.GetShortUrl())
+		resp, err = s.Create(context.Background(), &grpc.CreateRequest{OriginalUrl: "https://example.com/internal", Password: "secret"})
+		assert.Nil(t, err)
+		assert.Equal(t, protected.GetShortUrl(), resp.GetShortUrl())
+	}
+}
+
+func TestServer_ClickLimit(t *testing.T) {
+	serv, _db, _, err := initAll(10)
+	assert.Nil(t, err)
+
+	resp, err := serv.Create(context.Background(), &grpc.CreateRequest{OriginalUrl: "https://example.com/invite", MaxClicks: 2})
+	assert.Nil(t, err)
+	shortURL := resp.GetShortUrl()
+
+	get, err := serv.Get(context.Background(), &grpc.GetRequest{ShortUrl: shortURL})
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), get.GetClicksLeft())
+
+	// cached row doesn't bypass limit
+	link, err := serv.Visit(context.Background(), &grpc.ResolveRequest{ShortUrl: shortURL})
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), link.GetClicksLeft())
+	assert.Equal(t, int64(2), link.GetMaxClicks())
+
+	_, err = serv.Get(context.Background(), &grpc.GetRequest{ShortUrl: shortURL})
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+	_, err = serv.Visit(context.Background(), &grpc.ResolveRequest{ShortUrl: shortURL})
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+
+	// preview doesn't take clicks
+	preview, err := serv.Preview(context.Background(), &grpc.PreviewRequest{ShortUrl: shortURL})
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), preview.GetLink().GetClicksLeft())
+
+	// chain to limited link would bypass limit
+	chained, err := New(10, _db, short.New(), WithChains(config.ChainsConfig{}, "https://sho.rt"))
+	assert.Nil(t, err)
+	_, err = chained.Create(context.Background(), &grpc.CreateRequest{OriginalUrl: "https://sho.rt/" + shortURL})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	_, err = serv.Create(context.Background(), &grpc.CreateRequest{OriginalUrl: "https://example.org", MaxClicks: -1})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestServer_CreateExistingClickLimit(t *testing.T) {
+	serv, _db, _, err := initAll(10)
+	assert.Nil(t, err)
+
+	_, err = serv.Create(context.Background(), &grpc.CreateRequest{OriginalUrl: "https://example.com/doc"})
+	assert.Nil(t, err)
+	invite, err := serv.Create(context.Background(), &grpc.CreateRequest{OriginalUrl: "https://example.com/invite", MaxClicks: 1})
+	assert.Nil(t, err)
+
+	uncached, err := New(10, _db, short.New())
+	assert.Nil(t, err)
+	for _, s := range []*Server{serv, uncached} {
+		_, err = s.Create(context.Background(), &grpc.CreateRequest{OriginalUrl: "https://example.com/doc", MaxClicks: 1})
+		assert.Equal(t, codes.AlreadyExists, status.Code(err))
+		// plain link of invite would take its click
+		_, err = s.Create(context.Background(), &grpc.CreateRequest{OriginalUrl: "https://example.com/invite"})
+		assert.Equal(t, codes.AlreadyExists, status.Code(err))
+		_, err = s.Create(context.Background(), &grpc.CreateRequest{OriginalUrl: "https://example.com/invite", MaxClicks: 2})
+		assert.Equal(t, codes.AlreadyExists, status.Code(err))
+
+		resp, err := s.Create(context.Background(), &grpc.CreateRequest{OriginalUrl: "https://example.com/invite", MaxClicks: 1})
+		assert.Nil(t, err)
+		assert.Equal(t, invite.GetShortUrl(), resp.GetShortUrl())
+	}
+}
+
+func TestServer_ActivationWindow(t *testing.T) {
+	serv, _, _, err := initAll(10)
+	assert.Nil(t, err)
+
+	launch := time.Date(2021, 9, 1, 10, 0, 0, 0, time.UTC)
+	now := launch.Add(-time.Hour)
+	serv.now = func() time.Time { return now }
+
+	resp, err := serv.Create(context.Background(), &grpc.CreateRequest{
+		OriginalUrl: "https://example.com/launch",
+		NotBefore:   timestamppb.New(launch),
+		NotAfter:    timestamppb.New(launch.Add(24 * time.Hour)),
+		FallbackUrl: "https://example.com/soon",
+		MaxClicks:   10,
+	})
+	assert.Nil(t, err)
+	shortURL := resp.GetShortUrl()
+
+	get, err := serv.Get(context.Background(), &grpc.GetRequest{ShortUrl: shortURL})
+	assert.Nil(t, err)
+	assert.Equal(t, "https://example.com/soon", get.GetOriginalUrl())
+	assert.True(t, get.GetInactive())
+	assert.Equal(t, launch, get.GetValidUntil().AsTime())
+
+	// fallback doesn't take clicks
+	link, err := serv.Visit(context.Background(), &grpc.ResolveRequest{ShortUrl: shortURL})
+	assert.Nil(t, err)
+	assert.Equal(t, "https://example.com/soon", link.GetOriginalUrl())
+	assert.Equal(t, int64(10), link.GetClicksLeft())
+
+	// cached row is checked against current time
+	now = launch
+	get, err = serv.Get(context.Background(), &grpc.GetRequest{ShortUrl: shortURL})
+	assert.Nil(t, err)
+	assert.Equal(t, "https://example.com/launch", get.GetOriginalUrl())
+	assert.False(t, get.GetInactive())
+	assert.Equal(t, launch.Add(24*time.Hour), get.GetValidUntil().AsTime())
+	assert.Equal(t, int64(9), get.GetClicksLeft())
+
+	info, err := serv.GetLinkInfo(context.Background(), &grpc.GetLinkInfoRequest{ShortUrl: shortURL})
+	assert.Nil(t, err)
+	assert.Equal(t, launch, info.GetLink().GetNotBefore().AsTime())
+	assert.Equal(t, "https://example.com/soon", info.GetLink().GetFallbackUrl())
+
+	resp, err = serv.Create(context.Background(), &grpc.CreateRequest{
+		OriginalUrl: "https://example.com/sale",
+		NotAfter:    timestamppb.New(launch),
+	})
+	assert.Nil(t, err)
+	_, err = serv.Get(context.Background(), &grpc.GetRequest{ShortUrl: resp.GetShortUrl()})
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+	details := status.Convert(err).Details()
+	assert.Len(t, details, 1)
+	assert.Equal(t, InactiveReason, details[0].(*errdetails.ErrorInfo).GetReason())
+	_, err = serv.Preview(context.Background(), &grpc.PreviewRequest{ShortUrl: resp.GetShortUrl()})
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+
+	for _, req := range []*grpc.CreateRequest{
+		{OriginalUrl: "https://example.org", NotBefore: timestamppb.New(launch), NotAfter: timestamppb.New(launch)},
+		{OriginalUrl: "https://example.org", FallbackUrl: "https://example.org/soon"},
+	} {
+		_, err = serv.Create(context.Background(), req)
+		assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	}
+}
+
+func TestServer_CreateExistingWindow(t *testing.T) {
+	serv, _db, _, err := initAll(10)
+	assert.Nil(t, err)
+
+	launch := time.Date(2021, 9, 1, 10, 0, 0, 0, time.UTC)
+	scheduled := &grpc.CreateRequest{
+		OriginalUrl: "https://example.com/launch",
+		NotBefore:   timestamppb.New(launch),
+		FallbackUrl: "https://example.com/soon",
+	}
+	resp, err := serv.Create(context.Background(), scheduled)
+	assert.Nil(t, err)
+
+	uncached, err := New(10, _db, short.New())
+	assert.Nil(t, err)
+	for _, s := range []*Server{serv, uncached} {
+		for _, req := range []*grpc.CreateRequest{
+			{OriginalUrl: "https://example.com/launch"},
+			{OriginalUrl: "https://example.com/launch", NotBefore: timestamppb.New(launch.Add(time.Hour)), FallbackUrl: "https://example.com/soon"},
+			{OriginalUrl: "https://example.com/launch", NotBefore: timestamppb.New(launch), NotAfter: timestamppb.New(launch.Add(time.Hour)), FallbackUrl: "https://example.com/soon"},
+			{OriginalUrl: "https://example.com/launch", NotBefore: timestamppb.New(launch), FallbackUrl: "https://example.com/later"},
+		} {
+			_, err = s.Create(context.Background(), req)
+			assert.Equal(t, codes.AlreadyExists, status.Code(err), req.String())
+		}
+
+		existing, err := s.Create(context.Background(), scheduled)
+		assert.Nil(t, err)
+		assert.Equal(t, resp.GetShortUrl(), existing.GetShortUrl())
+	}
+
+	// scheduled link of plain one
+	_, err = serv.Create(context.Background(), &grpc.CreateRequest{OriginalUrl: "https://example.com"})
+	assert.Nil(t, err)
+	_, err = serv.Create(context.Background(), &grpc.CreateRequest{OriginalUrl: "https://example.com", NotBefore: timestamppb.New(launch)})
+	assert.Equal(t, codes.AlreadyExists, status.Code(err))
+}
+
+func TestServer_Rules(t *testing.T) {
+	serv, _db, _, err := initAll(10)
+	assert.Nil(t, err)
+	serv.now = func() time.Time { return time.Date(2021, 9, 1, 23, 30, 0, 0, time.UTC) }
+
+	resp, err := serv.Create(context.Background(), &grpc.CreateRequest{
+		OriginalUrl: "https://example.com/app",
+		MaxClicks:   10,
+		Rules: []*grpc.Rule{
+			{Device: grpc.DeviceClass_DEVICE_CLASS_IOS, DestinationUrl: "https://apps.apple.com/app"},
+			{Device: grpc.DeviceClass_DEVICE_CLASS_ANDROID, DestinationUrl: "https://play.google.com/app"},
+			{QueryParam: "ref", QueryValue: "promo", DestinationUrl: "https://example.com/promo"},
+			{Language: "DE", TimeStart: "22:00", TimeEnd: "06:00", DestinationUrl: "https://example.com/de/night"},
+		},
+	})
+	assert.Nil(t, err)
+	shortURL := resp.GetShortUrl()
+
+	iPhone := "Mozilla/5.0 (iPhone; CPU iPhone OS 14_7 like Mac OS X) AppleWebKit/605.1.15 Mobile/15E148"
+	pixel := "Mozilla/5.0 (Linux; Android 11; Pixel 5) AppleWebKit/537.36 Chrome/92.0 Mobile Safari/537.36"
+	firefox := "Mozilla/5.0 (X11; Linux x86_64; rv:91.0) Gecko/20100101 Firefox/91.0"
+	for _, tc := range []struct {
+		req  *grpc.ResolveRequest
+		url  string
+		rule int32
+	}{
+		{&grpc.ResolveRequest{UserAgent: iPhone}, "https://apps.apple.com/app", 1},
+		{&grpc.ResolveRequest{UserAgent: pixel, Query: map[string]string{"ref": "promo"}}, "https://play.google.com/app", 2},
+		{&grpc.ResolveRequest{UserAgent: firefox, Query: map[string]string{"ref": "promo"}}, "https://example.com/promo", 3},
+		{&grpc.ResolveRequest{UserAgent: firefox, Query: map[string]string{"ref": "mail"}}, "https://example.com/app", 0},
+		{&grpc.ResolveRequest{UserAgent: firefox, AcceptLanguage: "en-US,de-AT;q=0.5"}, "https://example.com/de/night", 4},
+		{&grpc.ResolveRequest{UserAgent: firefox, AcceptLanguage: "en-US,de;q=0"}, "https://example.com/app", 0},
+		{&grpc.ResolveRequest{}, "https://example.com/app", 0},
+	} {
+		tc.req.ShortUrl = shortURL
+		resolved, err := serv.Resolve(context.Background(), tc.req)
+		assert.Nil(t, err)
+		assert.Equal(t, tc.url, resolved.GetUrl())
+		assert.Equal(t, tc.rule, resolved.GetRule())
+	}
+
+	link, err := serv.Visit(context.Background(), &grpc.ResolveRequest{ShortUrl: shortURL, UserAgent: pixel})
+	assert.Nil(t, err)
+	assert.Equal(t, "https://play.google.com/app", link.GetOriginalUrl())
+	assert.Equal(t, int64(2), link.GetClicksLeft())
+
+	// Get returns default destination
+	get, err := serv.Get(context.Background(), &grpc.GetRequest{ShortUrl: shortURL})
+	assert.Nil(t, err)
+	assert.Equal(t, "https://example.com/app", get.GetOriginalUrl())
+
+	info, err := serv.GetLinkInfo(context.Background(), &grpc.GetLinkInfoRequest{ShortUrl: shortURL})
+	assert.Nil(t, err)
+	assert.Len(t, info.GetLink().GetRules(), 4)
+	assert.Equal(t, "de", info.GetLink().GetRules()[3].GetLanguage())
+	preview, err := serv.Preview(context.Background(), &grpc.PreviewRequest{ShortUrl: shortURL})
+	assert.Nil(t, err)
+	assert.Empty(t, preview.GetLink().GetRules())
+
+	for _, rule := range []*grpc.Rule{
+		{DestinationUrl: "https://example.org/any"},
+		{Device: grpc.DeviceClass_DEVICE_CLASS_IOS},
+		{TimeStart: "09:00", DestinationUrl: "https://example.org/day"},
+		{TimeStart: "9am", TimeEnd: "5pm", DestinationUrl: "https://example.org/day"},
+		{QueryValue: "promo", DestinationUrl: "https://example.org/promo"},
+		{Language: "de_AT", DestinationUrl: "https://example.org/de"},
+	} {
+		_, err = serv.Create(context.Background(), &grpc.CreateRequest{OriginalUrl: "https://example.org", Rules: []*grpc.Rule{rule}})
+		assert.Equal(t, codes.InvalidArgument, status.Code(err), rule.String())
+	}
+
+	// link of original URL has the same rules
+	uncached, err := New(10, _db, short.New())
+	assert.Nil(t, err)
+	for _, s := range []*Server{serv, uncached} {
+		for _, rules := range [][]*grpc.Rule{
+			nil,
+			{{Device: grpc.DeviceClass_DEVICE_CLASS_IOS, DestinationUrl: "https://apps.apple.com/app"}},
+		} {
+			_, err = s.Create(context.Background(), &grpc.CreateRequest{OriginalUrl: "https://example.com/app", MaxClicks: 10, Rules: rules})
+			assert.Equal(t, codes.AlreadyExists, status.Code(err))
+		}
+		existing, err := s.Create(context.Background(), &grpc.CreateRequest{
+			OriginalUrl: "https://example.com/app",
+			MaxClicks:   10,
+			Rules: []*grpc.Rule{
+				{Device: grpc.DeviceClass_DEVICE_CLASS_IOS, DestinationUrl: "https://apps.apple.com/app"},
+				{Device: grpc.DeviceClass_DEVICE_CLASS_ANDROID, DestinationUrl: "https://play.google.com/app"},
+				{QueryParam: "ref", QueryValue: "promo", DestinationUrl: "https://example.com/promo"},
+				{Language: "de", TimeStart: "22:00", TimeEnd: "06:00", DestinationUrl: "https://example.com/de/night"},
+			},
+		})
+		assert.Nil(t, err)
+		assert.Equal(t, shortURL, existing.GetShortUrl())
+	}
+
+	// chain to link with rules would drop them
+	chained, err := New(10, _db, short.New(), WithChains(config.ChainsConfig{}, "https://sho.rt"))
+	assert.Nil(t, err)
+	_, err = chained.Create(context.Background(), &grpc.CreateRequest{OriginalUrl: "https://sho.rt/" + shortURL})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestServer_CountryURLs(t *testing.T) {
+	serv, _db, _, err := initAll(10)
+	assert.Nil(t, err)
+	countries, err := geoip.Open("../geoip/testdata/countries.mmdb")
+	assert.Nil(t, err)
+	WithGeoIP(countries)(serv)
+
+	resp, err := serv.Create(context.Background(), &grpc.CreateRequest{
+		OriginalUrl: "https://example.com",
+		Rules:       []*grpc.Rule{{QueryParam: "ref", DestinationUrl: "https://example.com/ref"}},
+		CountryUrls: map[string]string{"gb": "https://example.co.uk", "JP": "https://example.jp"},
+	})
+	assert.Nil(t, err)
+	shortURL := resp.GetShortUrl()
+
+	for _, tc := range []struct {
+		req     *grpc.ResolveRequest
+		url     string
+		country string
+	}{
+		{&grpc.ResolveRequest{ClientIp: "81.2.69.142"}, "https://example.co.uk", "GB"},
+		{&grpc.ResolveRequest{ClientIp: "2001:218::1"}, "https://example.jp", "JP"},
+		{&grpc.ResolveRequest{ClientIp: "89.160.20.113"}, "https://example.com", "SE"},
+		{&grpc.ResolveRequest{ClientIp: "127.0.0.1"}, "https://example.com", ""},
+		{&grpc.ResolveRequest{ClientIp: "invalid"}, "https://example.com", ""},
+		// country of request overrides lookup
+		{&grpc.ResolveRequest{ClientIp: "81.2.69.142", Country: "jp"}, "https://example.jp", "JP"},
+		// rules are matched first
+		{&grpc.ResolveRequest{ClientIp: "81.2.69.142", Query: map[string]string{"ref": "mail"}}, "https://example.com/ref", ""},
+	} {
+		tc.req.ShortUrl = shortURL
+		resolved, err := serv.Resolve(context.Background(), tc.req)
+		assert.Nil(t, err)
+		assert.Equal(t, tc.url, resolved.GetUrl(), tc.req.String())
+		assert.Equal(t, tc.country, resolved.GetCountry(), tc.req.String())
+		assert.Equal(t, tc.url != "https://example.com" && tc.req.Query == nil, resolved.GetCountryMatched(), tc.req.String())
+	}
+
+	link, err := serv.Visit(context.Background(), &grpc.ResolveRequest{ShortUrl: shortURL, ClientIp: "81.2.69.142"})
+	assert.Nil(t, err)
+	assert.Equal(t, "https://example.co.uk", link.GetOriginalUrl())
+
+	info, err := serv.GetLinkInfo(context.Background(), &grpc.GetLinkInfoRequest{ShortUrl: shortURL})
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]string{"GB": "https://example.co.uk", "JP": "https://example.jp"}, info.GetLink().GetCountryUrls())
+	preview, err := serv.Preview(context.Background(), &grpc.PreviewRequest{ShortUrl: shortURL})
+	assert.Nil(t, err)
+	assert.Empty(t, preview.GetLink().GetCountryUrls())
+
+	for _, urls := range []map[string]string{
+		{"GBR": "https://example.co.uk"},
+		{"G1": "https://example.co.uk"},
+		{"DE": ""},
+		{"de": "https://example.de", "DE": "https://example.de"},
+	} {
+		_, err = serv.Create(context.Background(), &grpc.CreateRequest{OriginalUrl: "https://example.org", CountryUrls: urls})
+		assert.Equal(t, codes.InvalidArgument, status.Code(err), urls)
+	}
+
+	// link of original URL has the same country URLs
+	uncached, err := New(10, _db, short.New())
+	assert.Nil(t, err)
+	for _, s := range []*Server{serv, uncached} {
+		for _, urls := range []map[string]string{
+			nil,
+			{"GB": "https://example.co.uk"},
+			{"GB": "https://example.co.uk", "JP": "https://example.com/jp"},
+		} {
+			_, err = s.Create(context.Background(), &grpc.CreateRequest{
+				OriginalUrl: "https://example.com",
+				Rules:       []*grpc.Rule{{QueryParam: "ref", DestinationUrl: "https://example.com/ref"}},
+				CountryUrls: urls,
+			})
+			assert.Equal(t, codes.AlreadyExists, status.Code(err), urls)
+		}
+		existing, err := s.Create(context.Background(), &grpc.CreateRequest{
+			OriginalUrl: "https://example.com",
+			Rules:       []*grpc.Rule{{QueryParam: "ref", DestinationUrl: "https://example.com/ref"}},
+			CountryUrls: map[string]string{"JP": "https://example.jp", "GB": "https://example.co.uk"},
+		})
+		assert.Nil(t, err)
+		assert.Equal(t, shortURL, existing.GetShortUrl())
+	}
+
+	// without database only country of request is matched
+	noGeoIP, err := New(10, _db, short.New())
+	assert.Nil(t, err)
+	resolved, err := noGeoIP.Resolve(context.Background(), &grpc.ResolveRequest{ShortUrl: shortURL, ClientIp: "81.2.69.142"})
+	assert.Nil(t, err)
+	assert.Equal(t, "https://example.com", resolved.GetUrl())
+
+	// chain to link with country URLs would drop them
+	chained, err := New(10, _db, short.New(), WithChains(config.ChainsConfig{}, "https://sho.rt"))
+	assert.Nil(t, err)
+	_, err = chained.Create(context.Background(), &grpc.CreateRequest{OriginalUrl: "https://sho.rt/" + shortURL})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestServer_Variants(t *testing.T) {
+	serv, _db, _, err := initAll(10)
+	assert.Nil(t, err)
+
+	resp, err := serv.Create(context.Background(), &grpc.CreateRequest{
+		OriginalUrl: "https://example.com",
+		CountryUrls: map[string]string{"DE": "https://example.de"},
+		Variants: []*grpc.Variant{
+			{DestinationUrl: "https://example.com/a", Weight: 70, Clicks: 100},
+			{DestinationUrl: "https://example.com/b", Weight: 30},
+		},
+	})
+	assert.Nil(t, err)
+	shortURL := resp.GetShortUrl()
+
+	// visitor gets the same variant
+	urls := map[int32]string{1: "https://example.com/a", 2: "https://example.com/b"}
+	counts := map[int32]int{}
+	for i := 0; i < 1000; i++ {
+		req := &grpc.ResolveRequest{ShortUrl: shortURL, VisitorId: strconv.Itoa(i)}
+		first, err := serv.Resolve(context.Background(), req)
+		assert.Nil(t, err)
+		second, err := serv.Resolve(context.Background(), req)
+		assert.Nil(t, err)
+		assert.Equal(t, first.GetVariant(), second.GetVariant())
+		assert.Equal(t, urls[first.GetVariant()], first.GetUrl())
+		counts[first.GetVariant()]++
+	}
+	assert.InDelta(t, 700, counts[1], 60)
+	assert.InDelta(t, 300, counts[2], 60)
+
+	// client identity is used without visitor ID, anonymous visitors get random variant
+	for _, req := range []*grpc.ResolveRequest{{ClientIp: "192.0.2.1", UserAgent: "curl/7.68.0"}, {}} {
+		req.ShortUrl = shortURL
+		resolved, err := serv.Resolve(context.Background(), req)
+		assert.Nil(t, err)
+		assert.NotZero(t, resolved.GetVariant())
+	}
+	// country URLs take precedence
+	resolved, err := serv.Resolve(context.Background(), &grpc.ResolveRequest{ShortUrl: shortURL, Country: "DE", VisitorId: "1"})
+	assert.Nil(t, err)
+	assert.Equal(t, "https://example.de", resolved.GetUrl())
+	assert.Zero(t, resolved.GetVariant())
+
+	visitor := &grpc.ResolveRequest{ShortUrl: shortURL, VisitorId: "1"}
+	resolved, err = serv.Resolve(context.Background(), visitor)
+	assert.Nil(t, err)
+	for i := 0; i < 3; i++ {
+		link, err := serv.Visit(context.Background(), visitor)
+		assert.Nil(t, err)
+		assert.Equal(t, resolved.GetUrl(), link.GetOriginalUrl())
+	}
+
+	// per variant clicks include not flushed ones, clicks of request are ignored
+	variantClicks := func() []int64 {
+		info, err := serv.GetLinkInfo(context.Background(), &grpc.GetLinkInfoRequest{ShortUrl: shortURL})
+		assert.Nil(t, err)
+		var clicks []int64
+		for _, v := range info.GetLink().GetVariants() {
+			clicks = append(clicks, v.GetClicks())
+		}
+		return clicks
+	}
+	expected := []int64{0, 0}
+	expected[resolved.GetVariant()-1] = 3
+	assert.Equal(t, expected, variantClicks())
+	serv.FlushClicks(context.Background())
+	assert.Equal(t, expected, variantClicks())
+
+	preview, err := serv.Preview(context.Background(), &grpc.PreviewRequest{ShortUrl: shortURL})
+	assert.Nil(t, err)
+	assert.Empty(t, preview.GetLink().GetVariants())
+	get, err := serv.Get(context.Background(), &grpc.GetRequest{ShortUrl: shortURL})
+	assert.Nil(t, err)
+	assert.Equal(t, "https://example.com", get.GetOriginalUrl())
+
+	for _, variants := range [][]*grpc.Variant{
+		{{DestinationUrl: "https://example.org/a", Weight: 100}},
+		{{DestinationUrl: "https://example.org/a", Weight: 50}, {DestinationUrl: "https://example.org/b"}},
+		{{DestinationUrl: "https://example.org/a", Weight: 50}, {Weight: 50}},
+		{{DestinationUrl: "https://example.org/a", Weight: 50}, {DestinationUrl: "https://example.org/b", Weight: -50}},
+	} {
+		_, err = serv.Create(context.Background(), &grpc.CreateRequest{OriginalUrl: "https://example.org", Variants: variants})
+		assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	}
+
+	// link of original URL has the same variants, clicks don't differ them
+	uncached, err := New(10, _db, short.New())
+	assert.Nil(t, err)
+	for _, s := range []*Server{serv, uncached} {
+		for _, variants := range [][]*grpc.Variant{
+			nil,
+			{{DestinationUrl: "https://example.com/a", Weight: 50}, {DestinationUrl: "https://example.com/b", Weight: 50}},
+			{{DestinationUrl: "https://example.com/b", Weight: 30}, {DestinationUrl: "https://example.com/a", Weight: 70}},
+		} {
+			_, err = s.Create(context.Background(), &grpc.CreateRequest{
+				OriginalUrl: "https://example.com",
+				CountryUrls: map[string]string{"DE": "https://example.de"},
+				Variants:    variants,
+			})
+			assert.Equal(t, codes.AlreadyExists, status.Code(err))
+		}
+		existing, err := s.Create(context.Background(), &grpc.CreateRequest{
+			OriginalUrl: "https://example.com",
+			CountryUrls: map[string]string{"DE": "https://example.de"},
+			Variants: []*grpc.Variant{
+				{DestinationUrl: "https://example.com/a", Weight: 70},
+				{DestinationUrl: "https://example.com/b", Weight: 30},
+			},
+		})
+		assert.Nil(t, err)
+		assert.Equal(t, shortURL, existing.GetShortUrl())
+	}
+
+	// chain to link with variants would drop them
+	chained, err := New(10, _db, short.New(), WithChains(config.ChainsConfig{}, "https://sho.rt"))
+	assert.Nil(t, err)
+	_, err = chained.Create(context.Background(), &grpc.CreateRequest{OriginalUrl: "https://sho.rt/" + shortURL})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestDeviceClass(t *testing.T) {
+	for ua, device := range map[string]string{
+		"": "",
+		"Mozilla/5.0 (iPad; CPU OS 14_7 like Mac OS X) AppleWebKit/605.1.15 Mobile/15E148":       db.DeviceIOS,
+		"Mozilla/5.0 (Linux; Android 11; SM-T870) AppleWebKit/537.36 Chrome/92.0 Safari/537.36":  db.DeviceAndroid,
+		"Mozilla/5.0 (Mobile; rv:48.0) Gecko/48.0 Firefox/48.0 KAIOS/2.5":                        db.DeviceMobile,
+		"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 Chrome/92.0 Safari/537.36": db.DeviceDesktop,
+		"Mozilla/5.0 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)":               db.DeviceBot,
+		"facebookexternalhit/1.1": db.DeviceBot,
+	} {
+		assert.Equal(t, device, deviceClass(ua), ua)
+	}
 }
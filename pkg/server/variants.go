@@ -0,0 +1,103 @@
+package server
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math/rand"
+
+	"url_shortener/pkg/db"
+
+	pb "url_shortener/pkg/grpc"
+)
+
+const (
+	// maxVariants count of variants of link
+	maxVariants = 10
+	// maxVariantWeight weight of variant, weights are percents or parts of bigger total
+	maxVariantWeight = 10000
+)
+
+// variantsFromProto validates variants of create request, destinations are resolved by caller,
+// clicks of request are ignored
+func variantsFromProto(variants []*pb.Variant) (db.Variants, error) {
+	if len(variants) == 1 {
+		return nil, fmt.Errorf("single variant, at least 2 are required to split visits")
+	}
+	if len(variants) > maxVariants {
+		return nil, fmt.Errorf("more than %d variants", maxVariants)
+	}
+	var converted db.Variants
+	for i, v := range variants {
+		if v.GetDestinationUrl() == "" {
+			return nil, fmt.Errorf("variant %d: empty destination URL", i+1)
+		}
+		if v.GetWeight() <= 0 || v.GetWeight() > maxVariantWeight {
+			return nil, fmt.Errorf("variant %d: weight isn't in 1..%d", i+1, maxVariantWeight)
+		}
+		converted = append(converted, db.Variant{DestinationURL: v.GetDestinationUrl(), Weight: v.GetWeight()})
+	}
+	return converted, nil
+}
+
+func variantsToProto(variants db.Variants) []*pb.Variant {
+	var converted []*pb.Variant
+	for _, v := range variants {
+		converted = append(converted, &pb.Variant{
+			DestinationUrl: v.DestinationURL,
+			Weight:         v.Weight,
+			Clicks:         v.Clicks,
+		})
+	}
+	return converted
+}
+
+// sameVariants checks variants have the same destinations and weights, clicks aren't compared
+func sameVariants(a, b db.Variants) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].DestinationURL != b[i].DestinationURL || a[i].Weight != b[i].Weight {
+			return false
+		}
+	}
+	return true
+}
+
+// visitorID returns identity of visitor variants are chosen by: visitor ID of request or
+// client IP and User-Agent, empty if request has neither
+func visitorID(req *pb.ResolveRequest) string {
+	if req.GetVisitorId() != "" {
+		return req.GetVisitorId()
+	}
+	if req.GetClientIp() == "" {
+		return ""
+	}
+	return req.GetClientIp() + "\x00" + req.GetUserAgent()
+}
+
+// chooseVariant returns position of variant of row for visitor starting from 0, the same visitor
+// gets the same variant of link, anonymous visitors get random one
+func chooseVariant(row db.Row, visitor string) int {
+	var total int64
+	for _, v := range row.Variants {
+		total += int64(v.Weight)
+	}
+
+	var point int64
+	if visitor == "" {
+		point = rand.Int63n(total)
+	} else {
+		// short URL is hashed too, so visitor isn't put to the same part of every link
+		h := fnv.New64a()
+		_, _ = h.Write([]byte(row.ShortURL + "\x00" + visitor))
+		point = int64(h.Sum64() % uint64(total))
+	}
+	for i, v := range row.Variants {
+		if point < int64(v.Weight) {
+			return i
+		}
+		point -= int64(v.Weight)
+	}
+	return len(row.Variants) - 1
+}
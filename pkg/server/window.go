@@ -0,0 +1,79 @@
+package server
+
+import (
+	"fmt"
+	"time"
+
+	"google.golang.org/grpc/codes"
+
+	"url_shortener/pkg/db"
+
+	pb "url_shortener/pkg/grpc"
+)
+
+// InactiveReason reason of ErrorInfo detail of link outside of activation window without fallback
+const InactiveReason = "LINK_INACTIVE"
+
+// windowFromProto validates activation window of create request
+func windowFromProto(req *pb.CreateRequest) (notBefore, notAfter time.Time, err error) {
+	if req.GetNotBefore() != nil {
+		if err := req.GetNotBefore().CheckValid(); err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("invalid not before time: %w", err)
+		}
+		notBefore = req.GetNotBefore().AsTime()
+	}
+	if req.GetNotAfter() != nil {
+		if err := req.GetNotAfter().CheckValid(); err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("invalid not after time: %w", err)
+		}
+		notAfter = req.GetNotAfter().AsTime()
+	}
+	if !notBefore.IsZero() && !notAfter.IsZero() && !notBefore.Before(notAfter) {
+		return time.Time{}, time.Time{}, fmt.Errorf("not before time isn't before not after time")
+	}
+	if req.GetFallbackUrl() != "" && notBefore.IsZero() && notAfter.IsZero() {
+		return time.Time{}, time.Time{}, fmt.Errorf("fallback URL of link without activation window")
+	}
+	return notBefore, notAfter, nil
+}
+
+// sameWindow checks rows have the same activation window and fallback URL,
+// database stores times with microsecond precision
+func sameWindow(a, b db.Row) bool {
+	return a.NotBefore.Truncate(time.Microsecond).Equal(b.NotBefore.Truncate(time.Microsecond)) &&
+		a.NotAfter.Truncate(time.Microsecond).Equal(b.NotAfter.Truncate(time.Microsecond)) &&
+		a.FallbackURL == b.FallbackURL
+}
+
+// isActive checks time is in activation window of row
+func isActive(row db.Row, now time.Time) bool {
+	return (row.NotBefore.IsZero() || !now.Before(row.NotBefore)) && (row.NotAfter.IsZero() || now.Before(row.NotAfter))
+}
+
+// destination returns URL link resolves to at now: original URL of active link or fallback URL
+// of inactive one, inactive links without fallback are FailedPrecondition with InactiveReason. Window is checked on
+// every call, so cached rows don't outlive it
+func destination(row db.Row, now time.Time) (url string, active bool, err error) {
+	if isActive(row, now) {
+		return row.OriginalURL, true, nil
+	}
+	if row.FallbackURL != "" {
+		return row.FallbackURL, false, nil
+	}
+	if now.Before(row.NotBefore) {
+		return "", false, reasonError(codes.FailedPrecondition, InactiveReason,
+			"link isn't active until "+row.NotBefore.UTC().Format(time.RFC3339))
+	}
+	return "", false, reasonError(codes.FailedPrecondition, InactiveReason, "link expired at "+row.NotAfter.UTC().Format(time.RFC3339))
+}
+
+// validUntil returns time destination of row changes after now, zero time if never
+func validUntil(row db.Row, now time.Time) time.Time {
+	if now.Before(row.NotBefore) {
+		return row.NotBefore
+	}
+	if now.Before(row.NotAfter) {
+		return row.NotAfter
+	}
+	return time.Time{}
+}